@@ -0,0 +1,351 @@
+package ntfs_ea
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// BackupStreamID is dwStreamId of WIN32_STREAM_ID, the type of a stream in the format of BackupRead and BackupWrite.
+type BackupStreamID uint32
+
+// Stream types of BackupRead, see https://learn.microsoft.com/en-us/windows/win32/api/winbase/ns-winbase-win32_stream_id
+const (
+	BackupData               BackupStreamID = 1  // BACKUP_DATA, the unnamed data stream
+	BackupEaData             BackupStreamID = 2  // BACKUP_EA_DATA, chained FILE_FULL_EA_INFORMATION entries
+	BackupSecurityData       BackupStreamID = 3  // BACKUP_SECURITY_DATA, security descriptor
+	BackupAlternateData      BackupStreamID = 4  // BACKUP_ALTERNATE_DATA, named data stream
+	BackupLink               BackupStreamID = 5  // BACKUP_LINK, hard link information
+	BackupPropertyData       BackupStreamID = 6  // BACKUP_PROPERTY_DATA
+	BackupObjectID           BackupStreamID = 7  // BACKUP_OBJECT_ID
+	BackupReparseData        BackupStreamID = 8  // BACKUP_REPARSE_DATA
+	BackupSparseBlock        BackupStreamID = 9  // BACKUP_SPARSE_BLOCK, data preceded by its offset in the stream
+	BackupTxfsData           BackupStreamID = 10 // BACKUP_TXFS_DATA
+	BackupGhostedFileExtents BackupStreamID = 11 // BACKUP_GHOSTED_FILE_EXTENTS
+)
+
+// dwStreamAttributes of WIN32_STREAM_ID.
+const (
+	StreamNormalAttribute        = 0x0
+	StreamModifiedWhenRead       = 0x1
+	StreamContainsSecurity       = 0x2
+	StreamContainsProperties     = 0x4
+	StreamSparseAttribute        = 0x8
+	StreamContainsGhostedExtents = 0x10
+)
+
+const (
+	backupHeaderSize      = 20 // uint32 id, uint32 attributes, int64 size, uint32 name size
+	backupSparseOffsetLen = 8
+	maxBackupNameSize     = 0xffff
+	maxBackupEaDataSize   = 1 << 20
+)
+
+func (id BackupStreamID) String() string {
+	switch id {
+	case BackupData:
+		return "BACKUP_DATA"
+	case BackupEaData:
+		return "BACKUP_EA_DATA"
+	case BackupSecurityData:
+		return "BACKUP_SECURITY_DATA"
+	case BackupAlternateData:
+		return "BACKUP_ALTERNATE_DATA"
+	case BackupLink:
+		return "BACKUP_LINK"
+	case BackupPropertyData:
+		return "BACKUP_PROPERTY_DATA"
+	case BackupObjectID:
+		return "BACKUP_OBJECT_ID"
+	case BackupReparseData:
+		return "BACKUP_REPARSE_DATA"
+	case BackupSparseBlock:
+		return "BACKUP_SPARSE_BLOCK"
+	case BackupTxfsData:
+		return "BACKUP_TXFS_DATA"
+	case BackupGhostedFileExtents:
+		return "BACKUP_GHOSTED_FILE_EXTENTS"
+	}
+
+	return fmt.Sprintf("BackupStreamID(%d)", uint32(id))
+}
+
+// BackupHeader is WIN32_STREAM_ID of a stream.
+type BackupHeader struct {
+	ID         BackupStreamID
+	Attributes uint32
+	Size       int64  // size of the stream data, excluding Offset of BACKUP_SPARSE_BLOCK
+	Name       string // name of BACKUP_ALTERNATE_DATA, e.g. ":Zone.Identifier:$DATA"
+	Offset     int64  // offset of the data in the stream for BACKUP_SPARSE_BLOCK
+}
+
+// BackupStreamReader reads streams in the format of BackupRead, the data of each stream is read with Read after Next.
+type BackupStreamReader struct {
+	r         io.Reader
+	bytesLeft int64
+	hdr       *BackupHeader
+}
+
+// NewBackupStreamReader returns BackupStreamReader reading from r.
+func NewBackupStreamReader(r io.Reader) *BackupStreamReader {
+	return &BackupStreamReader{r: r}
+}
+
+// Next skips the rest of the current stream and returns the header of the next one, io.EOF is returned at the end.
+func (r *BackupStreamReader) Next() (*BackupHeader, error) {
+	if r.bytesLeft > 0 {
+		if _, err := io.CopyN(io.Discard, r.r, r.bytesLeft); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		r.bytesLeft = 0
+	}
+
+	var raw [backupHeaderSize]byte
+	if _, err := io.ReadFull(r.r, raw[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated WIN32_STREAM_ID: %w", err)
+		}
+		return nil, err
+	}
+
+	hdr := &BackupHeader{
+		ID:         BackupStreamID(binary.LittleEndian.Uint32(raw[0:])),
+		Attributes: binary.LittleEndian.Uint32(raw[4:]),
+		Size:       int64(binary.LittleEndian.Uint64(raw[8:])),
+	}
+	if hdr.Size < 0 {
+		return nil, fmt.Errorf("invalid size %d of %s", hdr.Size, hdr.ID)
+	}
+
+	nameSize := binary.LittleEndian.Uint32(raw[16:])
+	if nameSize%2 != 0 || nameSize > maxBackupNameSize {
+		return nil, fmt.Errorf("invalid name size %d of %s", nameSize, hdr.ID)
+	}
+	if nameSize != 0 {
+		name := make([]byte, nameSize)
+		if _, err := io.ReadFull(r.r, name); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		hdr.Name = decodeUTF16LE(name)
+	}
+
+	if hdr.ID == BackupSparseBlock {
+		if hdr.Size < backupSparseOffsetLen {
+			return nil, fmt.Errorf("%s of %d bytes is too short for its offset", hdr.ID, hdr.Size)
+		}
+
+		var offset [backupSparseOffsetLen]byte
+		if _, err := io.ReadFull(r.r, offset[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		hdr.Offset = int64(binary.LittleEndian.Uint64(offset[:]))
+		hdr.Size -= backupSparseOffsetLen
+	}
+
+	r.bytesLeft = hdr.Size
+	r.hdr = hdr
+
+	return hdr, nil
+}
+
+// Read reads the data of the current stream, io.EOF is returned at the end of it.
+func (r *BackupStreamReader) Read(p []byte) (int, error) {
+	if r.bytesLeft == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.bytesLeft {
+		p = p[:r.bytesLeft]
+	}
+
+	n, err := r.r.Read(p)
+	r.bytesLeft -= int64(n)
+	if errors.Is(err, io.EOF) && r.bytesLeft > 0 {
+		err = io.ErrUnexpectedEOF
+	} else if r.bytesLeft == 0 && err == nil {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// Eas reads the rest of the current BACKUP_EA_DATA stream and returns EAs in it.
+func (r *BackupStreamReader) Eas() ([]EaInfo, error) {
+	if r.hdr == nil || r.hdr.ID != BackupEaData {
+		return nil, errors.New("current stream is not BACKUP_EA_DATA")
+	}
+	if r.bytesLeft > maxBackupEaDataSize {
+		return nil, fmt.Errorf("BACKUP_EA_DATA of %d bytes is too large", r.bytesLeft)
+	}
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFullInfoBuf(buf)
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+func decodeUTF16LE(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+
+	return string(utf16.Decode(u))
+}
+
+// BackupStreamWriter writes streams in the format of BackupWrite, the data of each stream is written with Write after WriteHeader.
+type BackupStreamWriter struct {
+	w         io.Writer
+	bytesLeft int64
+}
+
+// NewBackupStreamWriter returns BackupStreamWriter writing into w.
+func NewBackupStreamWriter(w io.Writer) *BackupStreamWriter {
+	return &BackupStreamWriter{w: w}
+}
+
+// WriteHeader writes the header of the next stream, all data of the previous stream should be written.
+func (w *BackupStreamWriter) WriteHeader(hdr *BackupHeader) error {
+	if w.bytesLeft != 0 {
+		return fmt.Errorf("%d bytes of the previous stream are not written", w.bytesLeft)
+	}
+	if hdr.Size < 0 {
+		return fmt.Errorf("invalid size %d of %s", hdr.Size, hdr.ID)
+	}
+
+	var name []byte
+	for _, c := range utf16.Encode([]rune(hdr.Name)) {
+		name = binary.LittleEndian.AppendUint16(name, c)
+	}
+	if len(name) > maxBackupNameSize {
+		return fmt.Errorf("name of %s is too long", hdr.ID)
+	}
+
+	size := hdr.Size
+	if hdr.ID == BackupSparseBlock {
+		size += backupSparseOffsetLen
+	}
+
+	b := binary.LittleEndian.AppendUint32(nil, uint32(hdr.ID))
+	b = binary.LittleEndian.AppendUint32(b, hdr.Attributes)
+	b = binary.LittleEndian.AppendUint64(b, uint64(size))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(name)))
+	b = append(b, name...)
+	if hdr.ID == BackupSparseBlock {
+		b = binary.LittleEndian.AppendUint64(b, uint64(hdr.Offset))
+	}
+
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	w.bytesLeft = hdr.Size
+
+	return nil
+}
+
+// Write writes the data of the current stream, writing more than its size is an error.
+func (w *BackupStreamWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.bytesLeft {
+		return 0, fmt.Errorf("%d bytes exceed the rest of the stream of %d bytes", len(p), w.bytesLeft)
+	}
+
+	n, err := w.w.Write(p)
+	w.bytesLeft -= int64(n)
+
+	return n, err
+}
+
+// WriteEas writes eas as a BACKUP_EA_DATA stream, EAs with empty value are skipped.
+func (w *BackupStreamWriter) WriteEas(eas []EaInfo) error {
+	var set []EaInfo
+	for _, ea := range eas {
+		if len(ea.EaValue) != 0 {
+			set = append(set, ea)
+		}
+	}
+
+	buf, err := convertToFullInfoBuf(set)
+	if err != nil {
+		return err
+	}
+
+	if err = w.WriteHeader(&BackupHeader{ID: BackupEaData, Size: int64(len(buf))}); err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf)
+
+	return err
+}
+
+// EditBackupEas copies streams in the format of BackupRead from r into w, replacing EAs in BACKUP_EA_DATA with the result of fn.
+// fn is called with nil if there is no EA stream, then the stream is added at the end. The EA stream is dropped when fn returns no EA.
+func EditBackupEas(r io.Reader, w io.Writer, fn func(eas []EaInfo) ([]EaInfo, error)) error {
+	br, bw := NewBackupStreamReader(r), NewBackupStreamWriter(w)
+	edited := false
+
+	for {
+		hdr, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if hdr.ID != BackupEaData {
+			if err = bw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err = io.Copy(bw, br); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if edited {
+			return errors.New("more than one BACKUP_EA_DATA stream")
+		}
+		edited = true
+
+		eas, err := br.Eas()
+		if err != nil {
+			return err
+		}
+		if err = writeEditedEas(bw, eas, fn); err != nil {
+			return err
+		}
+	}
+
+	if edited {
+		return nil
+	}
+
+	return writeEditedEas(bw, nil, fn)
+}
+
+func writeEditedEas(bw *BackupStreamWriter, eas []EaInfo, fn func(eas []EaInfo) ([]EaInfo, error)) error {
+	eas, err := fn(eas)
+	if err != nil {
+		return err
+	}
+
+	for _, ea := range eas {
+		if len(ea.EaValue) != 0 {
+			return bw.WriteEas(eas)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// testBackupBlob returns streams as BackupRead returns for a file with data, an ADS, EAs and a sparse block.
+func testBackupBlob(t *testing.T, eas []EaInfo) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	bw := NewBackupStreamWriter(&buf)
+
+	for _, s := range []struct {
+		hdr  BackupHeader
+		data string
+	}{
+		{BackupHeader{ID: BackupSecurityData, Attributes: StreamContainsSecurity}, "security"},
+		{BackupHeader{ID: BackupData}, "file content"},
+		{BackupHeader{ID: BackupAlternateData, Name: ":Zone.Identifier:$DATA"}, "[ZoneTransfer]"},
+		{BackupHeader{ID: BackupSparseBlock, Offset: 0x10000, Attributes: StreamSparseAttribute}, "sparse"},
+	} {
+		hdr := s.hdr
+		hdr.Size = int64(len(s.data))
+		if err := bw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bw.Write([]byte(s.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if eas != nil {
+		if err := bw.WriteEas(eas); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func TestBackupStream(t *testing.T) {
+	eas := []EaInfo{
+		{EaName: "APPVERSION", EaValue: []byte("1.0")},
+		{Flags: NeedEa, EaName: "REQUIRED", EaValue: []byte{1, 2, 3}},
+	}
+	blob := testBackupBlob(t, eas)
+
+	// WIN32_STREAM_ID of the ADS with UTF-16LE name
+	adsOffset := 2*backupHeaderSize + len("security") + len("file content")
+	if !bytes.Equal(blob[adsOffset:adsOffset+backupHeaderSize+4], []byte{
+		4, 0, 0, 0, 0, 0, 0, 0, 14, 0, 0, 0, 0, 0, 0, 0, 44, 0, 0, 0, ':', 0, 'Z', 0,
+	}) {
+		t.Fatalf("Unexpected header: %x", blob[adsOffset:adsOffset+backupHeaderSize+4])
+	}
+
+	br := NewBackupStreamReader(bytes.NewReader(blob))
+	var ids []BackupStreamID
+	for {
+		hdr, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, hdr.ID)
+
+		switch hdr.ID {
+		case BackupData:
+			// left unread to be skipped by Next
+		case BackupAlternateData:
+			data, _ := io.ReadAll(br)
+			if hdr.Name != ":Zone.Identifier:$DATA" || string(data) != "[ZoneTransfer]" {
+				t.Fatalf("Unexpected ADS %q: %q", hdr.Name, data)
+			}
+		case BackupSparseBlock:
+			data, _ := io.ReadAll(br)
+			if hdr.Offset != 0x10000 || hdr.Size != 6 || string(data) != "sparse" {
+				t.Fatalf("Unexpected sparse block %+v: %q", hdr, data)
+			}
+		case BackupEaData:
+			decoded, err := br.Eas()
+			if err != nil || !reflect.DeepEqual(decoded, eas) {
+				t.Fatalf("Unexpected EAs: %v, %v", decoded, err)
+			}
+		}
+	}
+
+	expected := []BackupStreamID{BackupSecurityData, BackupData, BackupAlternateData, BackupSparseBlock, BackupEaData}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("Unexpected streams %v", ids)
+	}
+
+	br = NewBackupStreamReader(bytes.NewReader(blob[:len(blob)-1]))
+	for {
+		if _, err := br.Next(); err != nil {
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("Expected io.ErrUnexpectedEOF, got %v", err)
+			}
+			break
+		}
+		if _, err := io.ReadAll(br); err != nil {
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("Expected io.ErrUnexpectedEOF, got %v", err)
+			}
+			break
+		}
+	}
+
+	bw := NewBackupStreamWriter(io.Discard)
+	if err := bw.WriteHeader(&BackupHeader{ID: BackupData, Size: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bw.Write([]byte("abc")); err == nil {
+		t.Fatal("Expected error for writing over the stream size")
+	}
+	if err := bw.WriteHeader(&BackupHeader{ID: BackupData}); err == nil {
+		t.Fatal("Expected error for incomplete stream")
+	}
+}
+
+func TestEditBackupEas(t *testing.T) {
+	eas := []EaInfo{{EaName: "APPVERSION", EaValue: []byte("1.0")}}
+	updated := []EaInfo{{EaName: "APPVERSION", EaValue: []byte("2.0")}}
+
+	var out bytes.Buffer
+	err := EditBackupEas(bytes.NewReader(testBackupBlob(t, eas)), &out, func(current []EaInfo) ([]EaInfo, error) {
+		if !reflect.DeepEqual(current, eas) {
+			t.Fatalf("Unexpected EAs: %v", current)
+		}
+		return updated, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), testBackupBlob(t, updated)) {
+		t.Fatal("Other streams should be kept as they are")
+	}
+
+	// add EA stream
+	out.Reset()
+	if err = EditBackupEas(bytes.NewReader(testBackupBlob(t, nil)), &out, func(current []EaInfo) ([]EaInfo, error) {
+		if current != nil {
+			t.Fatalf("Unexpected EAs: %v", current)
+		}
+		return updated, nil
+	}); err != nil || !bytes.Equal(out.Bytes(), testBackupBlob(t, updated)) {
+		t.Fatalf("EA stream should be added: %v", err)
+	}
+
+	// drop EA stream
+	out.Reset()
+	if err = EditBackupEas(bytes.NewReader(testBackupBlob(t, eas)), &out, func([]EaInfo) ([]EaInfo, error) {
+		return nil, nil
+	}); err != nil || !bytes.Equal(out.Bytes(), testBackupBlob(t, nil)) {
+		t.Fatalf("EA stream should be dropped: %v", err)
+	}
+}
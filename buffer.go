@@ -0,0 +1,185 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	"github.com/Snshadow/ntfs-ea/internal/w32api"
+	"github.com/nyaosorg/go-windows-mbcs"
+)
+
+const (
+	NeedEa = w32api.FILE_NEED_EA
+
+	fullInfoHeaderSize = 8 // 4 + 1 + 1 + 2
+	getInfoHeaderSize  = 5 // 4 + 1
+)
+
+// EaInfo is a simplified struct of FILE_FULL_EA_INFORMATION, see https://learn.microsoft.com/en-us/windows-hardware/drivers/ddi/wdm/ns-wdm-_file_full_ea_information
+type EaInfo struct {
+	Flags   uint8
+	EaName  string
+	EaValue []byte
+}
+
+// invalidEaNameChars are characters which are not allowed in FAT file names, which NTFS does not allow in EA names either.
+const invalidEaNameChars = "\"*+,/:;<=>?[\\]|"
+
+// ValidateEaName checks that name can be used as a name of EA, it should be 1 to 255 bytes long in the active code page
+// and should not have control characters or any of "*+,/:;<=>?[\]|.
+func ValidateEaName(name string) error {
+	if name == "" {
+		return fmt.Errorf("EA name is empty")
+	}
+
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(invalidEaNameChars, c) {
+			return fmt.Errorf("EA name %q has invalid character %q", name, c)
+		}
+	}
+
+	buf, err := strToEaNameBuffer(name)
+	if err != nil {
+		return fmt.Errorf("EA name %q can not be converted to the active code page: %w", name, err)
+	}
+	if len(buf) > 0xff {
+		return fmt.Errorf("EA name %q is too long", name)
+	}
+
+	return nil
+}
+
+func strToEaNameBuffer(s string) ([]int8, error) {
+	buf, err := mbcs.Utf8ToAnsi(s, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	eaName := unsafe.Slice((*int8)(unsafe.Pointer(&buf[0])), len(buf))
+
+	return eaName, nil
+}
+
+func convertToFullInfoBuf(arr []EaInfo) ([]byte, error) {
+	var wholeInfoLen uint32
+	var wholeBuf bytes.Buffer
+
+	for i := range arr {
+		eaEnt := arr[i]
+		eaName, err := strToEaNameBuffer(eaEnt.EaName)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(eaName) > 0xff {
+			return nil, fmt.Errorf("EA name is too long")
+		}
+
+		fullInfoLen := fullInfoHeaderSize + uint32(len(eaName)) + 1 + uint32(len(eaEnt.EaValue)) // add 1 for null terminator
+		padSize := fullInfoLen & 3                                                               // for adding zeros to end to entry
+		if padSize != 0 {
+			fullInfoLen += 4 - padSize // align by 4 bytes, in case of entries are buffered
+		}
+		wholeInfoLen += fullInfoLen
+
+		if wholeInfoLen > 0xffff {
+			// if the total size of EA info is larger than 64KB bytes, this EaSetEaFile fails with STATUS_EA_TOO_LARGE,
+			// if it goes a lot larger(potential bug(?)), it will write the data up to the limit without erroring,
+			// causing inconsistent data
+			return nil, fmt.Errorf("EA info data is larger than 64KB")
+		}
+
+		buf := make([]byte, fullInfoLen)
+		fullEa := (*w32api.FILE_FULL_EA_INFORMATION)(unsafe.Pointer(&buf[0]))
+
+		fullEa.Flags = eaEnt.Flags
+		fullEa.EaNameLength = uint8(len(eaName))
+		fullEa.EaValueLength = uint16(len(eaEnt.EaValue))
+
+		if i < len(arr)-1 {
+			fullEa.NextEntryOffset = fullInfoLen
+		}
+
+		wholeBuf.Write(buf[:fullInfoHeaderSize])
+		wholeBuf.Write(unsafe.Slice((*byte)(unsafe.Pointer(&eaName[0])), len(eaName)))
+		wholeBuf.WriteByte(0) // null terminator
+		wholeBuf.Write(eaEnt.EaValue)
+
+		if padSize > 0 {
+			wholeBuf.Write(make([]byte, 4-padSize))
+		}
+	}
+
+	return wholeBuf.Bytes(), nil
+}
+
+// parseFullInfoBuf converts a buffer of chained FILE_FULL_EA_INFORMATION entries, as returned by NtQueryEaFile, into EaInfo slice.
+func parseFullInfoBuf(buf []byte) ([]EaInfo, error) {
+	var eaInfoArr []EaInfo
+
+	for offset := 0; offset < len(buf); {
+		if len(buf)-offset < fullInfoHeaderSize {
+			return eaInfoArr, fmt.Errorf("EA entry at offset %d is truncated", offset)
+		}
+
+		nextOffset := binary.LittleEndian.Uint32(buf[offset:])
+		nameLen := int(buf[offset+5])
+		valueLen := int(binary.LittleEndian.Uint16(buf[offset+6:]))
+
+		nameStart := offset + fullInfoHeaderSize
+		valueStart := nameStart + nameLen + 1 // skip null terminator
+		if valueStart+valueLen > len(buf) {
+			return eaInfoArr, fmt.Errorf("EA entry at offset %d exceeds the buffer", offset)
+		}
+
+		eaInfo := EaInfo{
+			Flags: buf[offset+4],
+		}
+
+		name, err := mbcs.AnsiToUtf8(buf[nameStart:nameStart+nameLen], 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to get name of EA:", err)
+		} else {
+			eaInfo.EaName = name
+		}
+
+		eaInfo.EaValue = make([]byte, valueLen)
+		copy(eaInfo.EaValue, buf[valueStart:valueStart+valueLen])
+
+		eaInfoArr = append(eaInfoArr, eaInfo)
+		if nextOffset == 0 {
+			break
+		}
+
+		offset += int(nextOffset)
+	}
+
+	return eaInfoArr, nil
+}
+
+// filterEaInfo returns EAs in eas with names in queryName in the order of queryName, for names which do not exist, an EaInfo with
+// empty EaValue is returned as NtQueryEaFile does. eas is returned as is if queryName is empty.
+func filterEaInfo(eas []EaInfo, queryName []string) []EaInfo {
+	if len(queryName) == 0 {
+		return eas
+	}
+
+	eaInfoArr := make([]EaInfo, 0, len(queryName))
+	for _, name := range queryName {
+		found := EaInfo{EaName: eaNameKey(name)}
+		for _, ea := range eas {
+			if eaNameKey(ea.EaName) == found.EaName {
+				found = ea
+				break
+			}
+		}
+
+		eaInfoArr = append(eaInfoArr, found)
+	}
+
+	return eaInfoArr
+}
@@ -0,0 +1,451 @@
+package ntfs_ea
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EA bundle
+//
+// A bundle keeps EA sets of a whole tree in a single tar archive, so it can be inspected with any tar tool:
+//
+//	manifest.json      format version, creation time, root and an entry for each path with its SHA-256 checksum
+//	sets/000001.cbor   EA set of the first path in the format of MarshalEaSetsCBOR
+//	sets/000002.cbor   ...
+//
+// Paths are slash separated and relative to the root, and EA names are stored as strings, so a bundle taken with one
+// EaStore can be restored with another one, e.g. from FileStore in Windows into XattrStore on an ntfs-3g mount in Linux.
+
+// BundleVersion is the version of the bundle format written by this package.
+const BundleVersion = 1
+
+const (
+	bundleManifestName = "manifest.json"
+	maxBundleEntrySize = 1 << 20 // an EA set is within 64KB, even in base64
+	// the manifest has an entry of a few hundred bytes for every path, which may be millions of paths for a whole volume
+	maxBundleManifestSize = 1 << 30
+)
+
+var (
+	// ErrBundle is returned when a bundle is malformed or its checksum does not match.
+	ErrBundle = errors.New("invalid EA bundle")
+	// ErrBundleVerify is returned for paths whose EAs differ from the bundle after restoring.
+	ErrBundleVerify = errors.New("restored EAs do not match the bundle")
+)
+
+// Bundle is EA sets of a tree.
+type Bundle struct {
+	Version   int
+	CreatedAt time.Time
+	Root      string              // root the bundle was created from, for information
+	Sets      map[string][]EaInfo // EA sets keyed by slash separated path relative to Root
+}
+
+type bundleManifest struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Root      string        `json:"root,omitempty"`
+	Files     []bundleEntry `json:"files"`
+}
+
+type bundleEntry struct {
+	Path   string `json:"path"`
+	Entry  string `json:"entry"` // name of the tar entry
+	Eas    int    `json:"eas"`   // number of EAs
+	Size   int    `json:"size"`  // size of the packed EA set
+	SHA256 string `json:"sha256"`
+}
+
+// PathFilter selects slash separated relative paths with patterns of path.Match. A pattern matches a path if it matches the path
+// or any of its parent directories, and a pattern without '/' is matched against each path element, e.g. "*.txt" matches "a/b.txt"
+// and "tmp" matches "a/tmp/b". Paths matching any of Exclude are not selected, and if Include is not empty, only paths matching any of it are.
+type PathFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// Match reports whether p is selected by f, an error is returned for a malformed pattern.
+func (f *PathFilter) Match(p string) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+
+	elems := strings.Split(p, "/")
+	match := func(patterns []string) (bool, error) {
+		for _, pattern := range patterns {
+			hasSlash := strings.Contains(pattern, "/")
+			for i := range elems {
+				name := elems[i]
+				if hasSlash {
+					name = strings.Join(elems[:i+1], "/")
+				}
+
+				ok, err := path.Match(pattern, name)
+				if err != nil {
+					return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+				}
+				if ok {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+
+	if excluded, err := match(f.Exclude); err != nil || excluded {
+		return false, err
+	}
+	if len(f.Include) == 0 {
+		return true, nil
+	}
+
+	return match(f.Include)
+}
+
+// BundleOptions configures CreateBundle.
+type BundleOptions struct {
+	Walk   *WalkOptions // options to walk the tree with
+	Filter *PathFilter
+}
+
+// CreateBundle walks the tree rooted at root with CollectEaSets and writes EA sets of the selected paths as a bundle into w.
+// Nothing is written if the walk fails.
+func CreateBundle(w io.Writer, root string, opts *BundleOptions) (*Bundle, error) {
+	if opts == nil {
+		opts = &BundleOptions{}
+	}
+
+	sets, err := CollectEaSets(root, opts.Walk)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{Version: BundleVersion, CreatedAt: time.Now().UTC(), Root: root, Sets: make(map[string][]EaInfo, len(sets))}
+	for p, eas := range sets {
+		ok, err := opts.Filter.Match(p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			b.Sets[p] = eas
+		}
+	}
+
+	if err = WriteBundle(w, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// WriteBundle writes b as a bundle into w. Paths with an empty EA set are kept, so RestoreOptions.Exact removes their EAs.
+func WriteBundle(w io.Writer, b *Bundle) error {
+	paths := make([]string, 0, len(b.Sets))
+	for p := range b.Sets {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	m := bundleManifest{Version: BundleVersion, CreatedAt: b.CreatedAt, Root: b.Root, Files: make([]bundleEntry, 0, len(paths))}
+	entries := make([][]byte, 0, len(paths))
+
+	for i, p := range paths {
+		eas := b.Sets[p]
+
+		data, err := MarshalEaSetsCBOR(map[string][]EaInfo{p: eas}, nil)
+		if err != nil {
+			return err
+		}
+		size, _ := eaSetSize(eas)
+
+		m.Files = append(m.Files, bundleEntry{
+			Path:   p,
+			Entry:  fmt.Sprintf("sets/%06d.cbor", i+1),
+			Eas:    len(eas),
+			Size:   size,
+			SHA256: sha256Hex(data),
+		})
+		entries = append(entries, data)
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	writeEntry := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: b.CreatedAt, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err = writeEntry(bundleManifestName, manifest); err != nil {
+		return err
+	}
+	for i, data := range entries {
+		if err = writeEntry(m.Files[i].Entry, data); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// ReadBundle reads a bundle written by WriteBundle and verifies the checksum of every EA set.
+func ReadBundle(r io.Reader) (*Bundle, error) {
+	tr := tar.NewReader(r)
+
+	next := func(limit int64) (*tar.Header, error) {
+		hdr, err := tr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Size > limit {
+			return nil, fmt.Errorf("%w: %s of %d bytes is too large", ErrBundle, hdr.Name, hdr.Size)
+		}
+		return hdr, nil
+	}
+	readEntry := func() (string, []byte, error) {
+		hdr, err := next(maxBundleEntrySize)
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := io.ReadAll(tr)
+		return hdr.Name, data, err
+	}
+
+	hdr, err := next(maxBundleManifestSize)
+	if errors.Is(err, io.EOF) || (err == nil && hdr.Name != bundleManifestName) {
+		return nil, fmt.Errorf("%w: %s is not the first entry", ErrBundle, bundleManifestName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the manifest is decoded as it is read, since it can be much larger than an EA set
+	var m bundleManifest
+	if err = json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBundle, bundleManifestName, err)
+	}
+	if m.Version != BundleVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBundle, m.Version)
+	}
+
+	b := &Bundle{Version: m.Version, CreatedAt: m.CreatedAt, Root: m.Root, Sets: make(map[string][]EaInfo, len(m.Files))}
+
+	for _, e := range m.Files {
+		name, data, err := readEntry()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: %s of %s is missing", ErrBundle, e.Entry, e.Path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name != e.Entry {
+			return nil, fmt.Errorf("%w: expected %s for %s, got %s", ErrBundle, e.Entry, e.Path, name)
+		}
+		if sha256Hex(data) != e.SHA256 {
+			return nil, fmt.Errorf("%w: checksum of %s for %s does not match", ErrBundle, e.Entry, e.Path)
+		}
+
+		sets, err := UnmarshalEaSetsCBOR(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrBundle, e.Entry, err)
+		}
+		eas, ok := sets[e.Path]
+		if !ok || len(sets) != 1 || len(eas) != e.Eas {
+			return nil, fmt.Errorf("%w: %s does not have the EA set of %s", ErrBundle, e.Entry, e.Path)
+		}
+		if _, ok = b.Sets[e.Path]; ok {
+			return nil, fmt.Errorf("%w: path %q appears more than once", ErrBundle, e.Path)
+		}
+
+		b.Sets[e.Path] = eas
+	}
+
+	if name, _, err := readEntry(); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = fmt.Errorf("%w: unexpected entry %s", ErrBundle, name)
+		}
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// RestoreOptions configures RestoreBundle, the zero value restores every path with the default store.
+type RestoreOptions struct {
+	Store              EaStore // DefaultStore() if nil
+	FollowReparsePoint bool
+	Filter             *PathFilter
+
+	// Remap replaces leading path elements of relative paths in the bundle before they are joined to the root,
+	// e.g. {"old/dir": "new/dir"}, the longest matching prefix is used.
+	Remap map[string]string
+
+	// Exact removes EAs of each path which are not in the bundle, so the path has exactly the EA set in the bundle.
+	// A path with an empty EA set in the bundle has all of its EAs removed.
+	Exact bool
+
+	// Verify queries EAs of each path after writing and reports paths missing any EA of the bundle, EAs which
+	// were not in the bundle are ignored unless Exact is set.
+	Verify bool
+}
+
+// RestoreReport is the result of RestoreBundle.
+type RestoreReport struct {
+	Restored   []string          // target paths EAs are written into
+	Skipped    []string          // paths in the bundle not selected by the filter
+	Failed     []*fs.PathError   // target paths failed to restore or verify
+	Mismatched []PathDiff        // differences from the bundle found by verification, keyed by target path
+	Remapped   map[string]string // target paths of remapped paths in the bundle
+}
+
+// RemapPath replaces leading path elements of slash separated p with remap, see RestoreOptions.Remap.
+func RemapPath(p string, remap map[string]string) string {
+	best := ""
+	for prefix := range remap {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if (p == prefix || strings.HasPrefix(p, prefix+"/")) && len(prefix) >= len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return p
+	}
+
+	replacement, ok := remap[best]
+	if !ok {
+		replacement = remap[best+"/"]
+	}
+
+	return path.Join(strings.TrimSuffix(replacement, "/"), strings.TrimPrefix(p[len(best):], "/"))
+}
+
+// RestoreBundle writes EA sets in b into paths under root with EaWriteFile, EAs which are not in the bundle are kept unless opts.Exact is set.
+// Failures of paths do not stop the restore, they are in the report and returned together as *WalkError.
+// Nothing is written if a path, or the path remapped from it, is absolute or escapes root, or two paths are remapped to the same path, and a path through a symbolic link
+// or reparse point under root fails.
+func RestoreBundle(b *Bundle, root string, opts *RestoreOptions) (*RestoreReport, error) {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+
+	store, err := storeOrDefault(opts.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(b.Sets))
+	remapped := make(map[string]string, len(b.Sets))
+	for p, eas := range b.Sets {
+		// paths come from the bundle, they and their remapped paths must stay under root
+		if err := validateSetPath(p); err != nil {
+			return nil, &fs.PathError{Op: "restore", Path: p, Err: err}
+		}
+		rel := RemapPath(p, opts.Remap)
+		if err := validateSetPath(rel); err != nil {
+			return nil, &fs.PathError{Op: "restore", Path: p, Err: err}
+		}
+		// two paths written into the same target would overwrite each other
+		if other, ok := remapped[path.Clean(rel)]; ok {
+			return nil, &fs.PathError{Op: "restore", Path: p, Err: fmt.Errorf("%q and %q are both restored into %q", other, p, rel)}
+		}
+		remapped[path.Clean(rel)] = p
+		if err := ValidateEaSet(eas); err != nil {
+			return nil, &fs.PathError{Op: "restore", Path: p, Err: err}
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	report := &RestoreReport{}
+
+	for _, p := range paths {
+		ok, err := opts.Filter.Match(p)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			report.Skipped = append(report.Skipped, p)
+			continue
+		}
+
+		rel := RemapPath(p, opts.Remap)
+		if rel != p {
+			if report.Remapped == nil {
+				report.Remapped = make(map[string]string)
+			}
+			report.Remapped[p] = rel
+		}
+		target := filepath.Join(root, filepath.FromSlash(rel))
+		if err := checkSetTarget(root, rel, opts.FollowReparsePoint); err != nil {
+			report.Failed = append(report.Failed, &fs.PathError{Op: "restore", Path: target, Err: err})
+			continue
+		}
+
+		eas := b.Sets[p]
+		toWrite := eas
+		if opts.Exact {
+			current, err := store.QueryFileEa(target, opts.FollowReparsePoint)
+			if err != nil {
+				report.Failed = append(report.Failed, &fs.PathError{Op: "query", Path: target, Err: err})
+				continue
+			}
+			// EAs only in the current set are removed by writing them with empty value
+			if extra := DiffEas(eas, current).Added; len(extra) != 0 {
+				toWrite = append([]EaInfo{}, eas...)
+				for _, c := range extra {
+					toWrite = append(toWrite, EaInfo{EaName: c.Name})
+				}
+			}
+		}
+		if len(toWrite) == 0 {
+			continue
+		}
+
+		if err = store.EaWriteFile(target, opts.FollowReparsePoint, toWrite...); err != nil {
+			report.Failed = append(report.Failed, &fs.PathError{Op: "restore", Path: target, Err: err})
+			continue
+		}
+		report.Restored = append(report.Restored, target)
+
+		if !opts.Verify {
+			continue
+		}
+
+		restored, err := store.QueryFileEa(target, opts.FollowReparsePoint)
+		if err != nil {
+			report.Failed = append(report.Failed, &fs.PathError{Op: "verify", Path: target, Err: err})
+			continue
+		}
+
+		d := DiffEas(eas, restored)
+		if !opts.Exact {
+			d.Added = nil
+		}
+		if !d.Empty() {
+			report.Mismatched = append(report.Mismatched, PathDiff{Path: target, EaDiff: *d})
+			report.Failed = append(report.Failed, &fs.PathError{Op: "verify", Path: target, Err: ErrBundleVerify})
+		}
+	}
+
+	if len(report.Failed) != 0 {
+		return report, &WalkError{Errors: report.Failed}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,253 @@
+package ntfs_ea
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// flaglessStore drops EA flags as Samba does.
+type flaglessStore struct {
+	EaStore
+}
+
+func (s flaglessStore) EaWriteFile(path string, followReparsePoint bool, eas ...EaInfo) error {
+	stored := make([]EaInfo, len(eas))
+	for i, ea := range eas {
+		stored[i] = EaInfo{EaName: ea.EaName, EaValue: ea.EaValue}
+	}
+
+	return s.EaStore.EaWriteFile(path, followReparsePoint, stored...)
+}
+
+func TestBundle(t *testing.T) {
+	root := createTestTree(t, "a.txt", "sub/b.txt", "sub/c.log", "skip/d.txt")
+	store := NewMemStore()
+
+	for _, f := range []string{"a.txt", "sub/b.txt", "sub/c.log", "skip/d.txt"} {
+		err := store.EaWriteFile(filepath.Join(root, filepath.FromSlash(f)), false,
+			EaInfo{Flags: NeedEa, EaName: "NAME", EaValue: []byte(f)}, EaInfo{EaName: "COMMON", EaValue: []byte{0, 1}})
+		if err != nil {
+			t.Fatalf("EaWriteFile failed: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	created, err := CreateBundle(&buf, root, &BundleOptions{
+		Walk:   &WalkOptions{Store: store},
+		Filter: &PathFilter{Exclude: []string{"skip"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateBundle failed: %v", err)
+	}
+
+	b, err := ReadBundle(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadBundle failed: %v", err)
+	}
+	if b.Version != BundleVersion || b.Root != root || !b.CreatedAt.Equal(created.CreatedAt) || !reflect.DeepEqual(b.Sets, created.Sets) {
+		t.Fatalf("Unexpected bundle: %+v", b)
+	}
+	if len(b.Sets) != 3 || b.Sets["skip/d.txt"] != nil {
+		t.Fatalf("Unexpected paths: %v", b.Sets)
+	}
+
+	target := createTestTree(t)
+	dst := NewMemStore()
+	report, err := RestoreBundle(b, target, &RestoreOptions{
+		Store:  dst,
+		Filter: &PathFilter{Include: []string{"*.txt"}},
+		Remap:  map[string]string{"sub": "moved/sub"},
+		Verify: true,
+	})
+	if err != nil {
+		t.Fatalf("RestoreBundle failed: %v", err)
+	}
+
+	wantRestored := []string{filepath.Join(target, "a.txt"), filepath.Join(target, "moved", "sub", "b.txt")}
+	if !reflect.DeepEqual(report.Restored, wantRestored) || !reflect.DeepEqual(report.Skipped, []string{"sub/c.log"}) ||
+		!reflect.DeepEqual(report.Remapped, map[string]string{"sub/b.txt": "moved/sub/b.txt"}) {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	eas, err := dst.QueryFileEa(wantRestored[1], false)
+	if err != nil || !reflect.DeepEqual(eas, b.Sets["sub/b.txt"]) {
+		t.Fatalf("Unexpected EAs: %v, %v", eas, err)
+	}
+
+	// flags are lost, which verification reports
+	report, err = RestoreBundle(b, target, &RestoreOptions{Store: flaglessStore{NewMemStore()}, Verify: true})
+	if !errors.Is(err, ErrBundleVerify) || len(report.Mismatched) != 3 || len(report.Mismatched[0].FlagsChanged) != 1 {
+		t.Fatalf("Expected verification failure, got %+v, %v", report, err)
+	}
+}
+
+func TestReadBundleCorrupted(t *testing.T) {
+	b := &Bundle{Sets: map[string][]EaInfo{"a": {{EaName: "A", EaValue: []byte("value")}}}}
+
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// rewrite the bundle with modify applied to each entry, entries for which it returns nil are dropped
+	rewrite := func(modify func(name string, data []byte) []byte) []byte {
+		var out bytes.Buffer
+		tr, tw := tar.NewReader(bytes.NewReader(buf.Bytes())), tar.NewWriter(&out)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			data, _ := io.ReadAll(tr)
+			if data = modify(hdr.Name, data); data == nil {
+				continue
+			}
+			hdr.Size = int64(len(data))
+			tw.WriteHeader(hdr)
+			tw.Write(data)
+		}
+		tw.Close()
+		return out.Bytes()
+	}
+
+	for _, corrupted := range [][]byte{
+		rewrite(func(name string, data []byte) []byte {
+			if name == "sets/000001.cbor" {
+				data[len(data)-1] ^= 1
+			}
+			return data
+		}),
+		rewrite(func(name string, data []byte) []byte {
+			if name == "sets/000001.cbor" {
+				return nil
+			}
+			return data
+		}),
+		rewrite(func(name string, data []byte) []byte {
+			if name == bundleManifestName {
+				return bytes.Replace(data, []byte(`"version": 1`), []byte(`"version": 9`), 1)
+			}
+			return data
+		}),
+		{},
+	} {
+		if _, err := ReadBundle(bytes.NewReader(corrupted)); !errors.Is(err, ErrBundle) {
+			t.Fatalf("Expected ErrBundle for corrupted bundle, got %v", err)
+		}
+	}
+}
+
+func TestRemapPath(t *testing.T) {
+	remap := map[string]string{"a": "x", "a/b/": "y/", "c": ""}
+	for p, want := range map[string]string{
+		"a":     "x",
+		"a/f":   "x/f",
+		"a/b/f": "y/f",
+		"ab/f":  "ab/f",
+		"c/f":   "f",
+	} {
+		if got := RemapPath(p, remap); got != want {
+			t.Fatalf("RemapPath(%q) = %q, expected %q", p, got, want)
+		}
+	}
+}
+
+func TestBundleManyPaths(t *testing.T) {
+	b := &Bundle{Sets: make(map[string][]EaInfo)}
+	for i := 0; i < 10000; i++ {
+		b.Sets[fmt.Sprintf("some/deeply/nested/directory/file%05d.txt", i)] = []EaInfo{{EaName: "A", EaValue: []byte{byte(i)}}}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadBundle(&buf)
+	if err != nil {
+		t.Fatalf("ReadBundle failed: %v", err)
+	}
+	if !reflect.DeepEqual(read.Sets, b.Sets) {
+		t.Fatal("Unexpected sets")
+	}
+}
+
+func TestRestoreBundleOutsideRoot(t *testing.T) {
+	eas := []EaInfo{{EaName: "A", EaValue: []byte("1")}}
+
+	for _, tc := range []struct {
+		sets  map[string][]EaInfo
+		remap map[string]string
+	}{
+		{sets: map[string][]EaInfo{"a": eas, "../x": eas}},
+		{sets: map[string][]EaInfo{"a": eas, "/etc/x": eas}},
+		{sets: map[string][]EaInfo{"a": eas, "b": eas}, remap: map[string]string{"b": "../b"}},
+		{sets: map[string][]EaInfo{"a/x": eas, "b/x": eas}, remap: map[string]string{"b": "a/"}},
+	} {
+		store := NewMemStore()
+		if _, err := RestoreBundle(&Bundle{Sets: tc.sets}, "/root", &RestoreOptions{Store: store, Remap: tc.remap}); err == nil {
+			t.Fatalf("Expected error for %v, %v", tc.sets, tc.remap)
+		}
+		if len(store.eas) != 0 {
+			t.Fatalf("Nothing should be written, got %v", store.eas)
+		}
+	}
+}
+
+func TestRestoreBundleThroughSymlink(t *testing.T) {
+	root := createTestTree(t, "file.txt")
+	outside := createTestTree(t, "passwd")
+	if err := os.Symlink(outside, filepath.Join(root, "a")); err != nil {
+		t.Skipf("Can not create symbolic link: %v", err)
+	}
+
+	eas := []EaInfo{{EaName: "A", EaValue: []byte("1")}}
+	store := NewMemStore()
+
+	report, err := RestoreBundle(&Bundle{Sets: map[string][]EaInfo{"a/passwd": eas, "b/passwd": eas, "file.txt": eas}}, root,
+		&RestoreOptions{Store: store, Remap: map[string]string{"b": "a/deeper"}})
+	if err == nil || len(report.Failed) != 2 {
+		t.Fatalf("Expected paths through the symbolic link to fail, got %+v, %v", report, err)
+	}
+	if !reflect.DeepEqual(report.Restored, []string{filepath.Join(root, "file.txt")}) {
+		t.Fatalf("Unexpected restored paths: %v", report.Restored)
+	}
+	if eas, _ := store.QueryFileEa(filepath.Join(outside, "passwd"), false); len(eas) != 0 {
+		t.Fatalf("EAs were written outside of the root: %v", eas)
+	}
+}
+
+func TestBundleEmptySet(t *testing.T) {
+	root := createTestTree(t, "a.txt")
+	target := filepath.Join(root, "a.txt")
+	store := NewMemStore()
+	if err := store.EaWriteFile(target, false, EaInfo{EaName: "A", EaValue: []byte("1")}); err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, &Bundle{Sets: map[string][]EaInfo{"a.txt": {}}}); err != nil {
+		t.Fatalf("WriteBundle failed: %v", err)
+	}
+	b, err := ReadBundle(&buf)
+	if err != nil {
+		t.Fatalf("ReadBundle failed: %v", err)
+	}
+	if eas, ok := b.Sets["a.txt"]; !ok || len(eas) != 0 {
+		t.Fatalf("Expected the empty EA set to be kept, got %v", b.Sets)
+	}
+
+	if _, err = RestoreBundle(b, root, &RestoreOptions{Store: store, Exact: true}); err != nil {
+		t.Fatalf("RestoreBundle failed: %v", err)
+	}
+	if eas, _ := store.QueryFileEa(target, false); len(eas) != 0 {
+		t.Fatalf("Expected EAs to be removed, got %v", eas)
+	}
+}
@@ -0,0 +1,186 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Minimal CBOR(RFC 8949) for the EA export format, only unsigned integers, byte strings, text strings, arrays and maps
+// with text keys are supported. Encoding follows the core deterministic encoding requirements: integers and lengths
+// in the shortest form, definite lengths and map keys sorted by their encoded bytes.
+
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+
+	maxCBORDepth = 16
+)
+
+var errCBOR = errors.New("invalid CBOR")
+
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= 0xff:
+		return append(b, major|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+func appendCBORUint(b []byte, n uint64) []byte {
+	return appendCBORHead(b, cborUint, n)
+}
+
+func appendCBORBytes(b, v []byte) []byte {
+	return append(appendCBORHead(b, cborBytes, uint64(len(v))), v...)
+}
+
+func appendCBORText(b []byte, s string) []byte {
+	return append(appendCBORHead(b, cborText, uint64(len(s))), s...)
+}
+
+// appendCBORMap appends a map of text keys and encoded values, keys are sorted by their encoded bytes.
+func appendCBORMap(b []byte, entries map[string][]byte) []byte {
+	type entry struct {
+		key   []byte
+		value []byte
+	}
+
+	sorted := make([]entry, 0, len(entries))
+	for key, value := range entries {
+		sorted = append(sorted, entry{appendCBORText(nil, key), value})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].key, sorted[j].key) < 0
+	})
+
+	b = appendCBORHead(b, cborMap, uint64(len(entries)))
+	for _, e := range sorted {
+		b = append(b, e.key...)
+		b = append(b, e.value...)
+	}
+
+	return b
+}
+
+// decodeCBOR decodes a single CBOR item filling the whole data into uint64, []byte, string, []any or map[string]any.
+func decodeCBOR(data []byte) (any, error) {
+	d := cborDecoder{data: data}
+
+	v, err := d.item(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.offset != len(data) {
+		return nil, fmt.Errorf("%w: %d trailing bytes", errCBOR, len(data)-d.offset)
+	}
+
+	return v, nil
+}
+
+type cborDecoder struct {
+	data   []byte
+	offset int
+}
+
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.offset >= len(d.data) {
+		return 0, 0, fmt.Errorf("%w: unexpected end of data", errCBOR)
+	}
+
+	major, info := d.data[d.offset]>>5, d.data[d.offset]&0x1f
+	d.offset++
+
+	size := 0
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		return 0, 0, fmt.Errorf("%w: unsupported additional information %d at offset %d", errCBOR, info, d.offset-1)
+	}
+
+	if len(d.data)-d.offset < size {
+		return 0, 0, fmt.Errorf("%w: unexpected end of data", errCBOR)
+	}
+
+	var n uint64
+	for _, c := range d.data[d.offset : d.offset+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.offset += size
+
+	return major, n, nil
+}
+
+func (d *cborDecoder) item(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", errCBOR)
+	}
+
+	start := d.offset
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	// every element takes at least a byte, which also bounds lengths of strings
+	if major != cborUint && n > uint64(len(d.data)-d.offset) {
+		return nil, fmt.Errorf("%w: length %d at offset %d exceeds the data", errCBOR, n, start)
+	}
+
+	switch major {
+	case cborUint:
+		return n, nil
+	case cborBytes, cborText:
+		s := d.data[d.offset : d.offset+int(n)]
+		d.offset += int(n)
+		if major == cborText {
+			return string(s), nil
+		}
+		return append([]byte{}, s...), nil
+	case cborArray:
+		arr := make([]any, n)
+		for i := range arr {
+			if arr[i], err = d.item(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case cborMap:
+		m := make(map[string]any, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: map key at offset %d is not a text string", errCBOR, start)
+			}
+			if _, ok = m[k]; ok {
+				return nil, fmt.Errorf("%w: duplicate map key %q", errCBOR, k)
+			}
+			if m[k], err = d.item(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported major type %d at offset %d", errCBOR, major, start)
+}
@@ -0,0 +1,450 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Chunked EA values
+//
+// A value which does not fit in a single EA is stored as a manifest EA with the requested name and chunk EAs named "<name>.CHUNK<index>.<id>",
+// where id is random for each written value and recorded in the manifest. So the new chunks never overwrite the chunks the current manifest
+// points to, and chunks of values of different files sharing a companion file do not collide.
+// The manifest value is chunkManifestMagic followed by JSON of chunkManifest, which records the size and SHA-256 of the whole value and each chunk,
+// and the file each chunk is stored in. Chunks are placed in the file of the manifest while the 64KB EA budget of the file allows,
+// then in the companion files in the given order.
+
+const (
+	// DefaultChunkSize is the size of chunks used when ChunkOptions.ChunkSize is not set, it leaves room for a 255 bytes long EA name in a 64KB EA set.
+	DefaultChunkSize = 0xf000
+
+	chunkManifestMagic   = "EACHUNKS"
+	chunkManifestVersion = 1
+
+	maxEaSetSize = 0xffff
+)
+
+var (
+	// ErrChunkMissing is returned when a chunk listed in the manifest can not be found.
+	ErrChunkMissing = errors.New("EA chunk is missing")
+	// ErrChunkCorrupted is returned when a chunk or the reassembled value does not match its checksum.
+	ErrChunkCorrupted = errors.New("EA chunk is corrupted")
+)
+
+// ChunkOptions configures WriteChunkedEa, ReadChunkedEa and RemoveChunkedEa.
+type ChunkOptions struct {
+	Store              EaStore // DefaultStore() if nil
+	FollowReparsePoint bool
+	ChunkSize          int // DefaultChunkSize if not positive
+
+	// Companions are existing files which can hold chunks that do not fit in the EA budget of the target file,
+	// they are recorded in the manifest relative to the directory of the target file if possible.
+	Companions []string
+}
+
+type chunkEntry struct {
+	File   int    `json:"file"` // 0 for the target file, 1.. for companions
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type chunkManifest struct {
+	Version    int          `json:"version"`
+	ID         string       `json:"id"` // identifies chunks of the value in their names
+	Size       int          `json:"size"`
+	SHA256     string       `json:"sha256"`
+	Companions []string     `json:"companions,omitempty"`
+	Chunks     []chunkEntry `json:"chunks"`
+}
+
+func chunkEaName(name, id string, index int) string {
+	return name + ".CHUNK" + strconv.Itoa(index) + "." + id
+}
+
+// newChunkID returns a random id for chunks of a value which is not used by any chunk name in eas of the files.
+func newChunkID(name string, chunks int, files [][]EaInfo) (string, error) {
+	used := make(map[string]bool)
+	for _, eas := range files {
+		for _, ea := range eas {
+			used[eaNameKey(ea.EaName)] = true
+		}
+	}
+
+	b := make([]byte, 4)
+	for retry := 0; retry < 8; retry++ {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		id := hex.EncodeToString(b)
+
+		free := true
+		for i := 0; i < chunks && free; i++ {
+			free = !used[eaNameKey(chunkEaName(name, id, i))]
+		}
+		if free {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("no free chunk name for EA %s", name)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// eaEntrySize returns the size of a FILE_FULL_EA_INFORMATION entry with the given name and value length, aligned by 4 bytes.
+func eaEntrySize(nameLen, valueLen int) int {
+	return (fullInfoHeaderSize + nameLen + 1 + valueLen + 3) &^ 3
+}
+
+// eaSetSize returns the size of the packed EA set, which is limited to 64KB.
+func eaSetSize(eas []EaInfo) (int, error) {
+	size := 0
+	for _, ea := range eas {
+		name, err := strToEaNameBuffer(ea.EaName)
+		if err != nil {
+			return 0, err
+		}
+
+		size += eaEntrySize(len(name), len(ea.EaValue))
+	}
+
+	return size, nil
+}
+
+func (opts *ChunkOptions) orDefault() (*ChunkOptions, EaStore, error) {
+	if opts == nil {
+		opts = &ChunkOptions{}
+	}
+
+	store, err := storeOrDefault(opts.Store)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return opts, store, nil
+}
+
+func parseChunkManifest(value []byte) (*chunkManifest, bool, error) {
+	if !bytes.HasPrefix(value, []byte(chunkManifestMagic)) {
+		return nil, false, nil
+	}
+
+	var m chunkManifest
+	if err := json.Unmarshal(value[len(chunkManifestMagic):], &m); err != nil {
+		return nil, true, fmt.Errorf("invalid EA chunk manifest: %w", err)
+	}
+	if m.Version != chunkManifestVersion {
+		return nil, true, fmt.Errorf("unsupported EA chunk manifest version %d", m.Version)
+	}
+
+	return &m, true, nil
+}
+
+// chunkFiles returns the file for each file index of the manifest.
+func (m *chunkManifest) chunkFiles(path string) []string {
+	files := []string{path}
+	for _, c := range m.Companions {
+		if !filepath.IsAbs(c) {
+			c = filepath.Join(filepath.Dir(path), c)
+		}
+		files = append(files, c)
+	}
+
+	return files
+}
+
+// queryChunkManifest returns the manifest EA of name in path, the manifest is nil if the EA does not exist or is not a manifest.
+func queryChunkManifest(store EaStore, path, name string, followReparsePoint bool) (EaInfo, *chunkManifest, error) {
+	eas, err := store.QueryFileEa(path, followReparsePoint, name)
+	if err != nil {
+		return EaInfo{}, nil, err
+	}
+
+	var ea EaInfo
+	for _, e := range eas {
+		if eaNameKey(e.EaName) == eaNameKey(name) {
+			ea = e
+		}
+	}
+
+	m, _, err := parseChunkManifest(ea.EaValue)
+
+	return ea, m, err
+}
+
+// removeChunks removes chunk EAs listed in m, missing chunks and files are ignored.
+func removeChunks(store EaStore, path, name string, m *chunkManifest, followReparsePoint bool) error {
+	files := m.chunkFiles(path)
+
+	toRemove := make(map[int][]EaInfo)
+	for i, c := range m.Chunks {
+		if c.File < 0 || c.File >= len(files) {
+			continue
+		}
+		toRemove[c.File] = append(toRemove[c.File], EaInfo{EaName: chunkEaName(name, m.ID, i)})
+	}
+
+	for fileIdx, eas := range toRemove {
+		err := store.EaWriteFile(files[fileIdx], followReparsePoint, eas...)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteChunkedEa writes value as EA with name into path, splitting it into chunks if it is larger than the chunk size.
+// New chunks are written under fresh names before the manifest is switched to them, and chunks of a previously written value with
+// the same name are removed after that, so the previous value is kept if writing fails. The EA budget should have room for both
+// the previous chunks and the new chunks while writing.
+// A value which is not split is written as a plain EA, it should not start with "EACHUNKS" to be read back by ReadChunkedEa.
+func WriteChunkedEa(path, name string, flags uint8, value []byte, opts *ChunkOptions) error {
+	opts, store, err := opts.orDefault()
+	if err != nil {
+		return err
+	}
+
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	_, oldManifest, err := queryChunkManifest(store, path, name, opts.FollowReparsePoint)
+	if err != nil {
+		return err
+	}
+
+	if len(value) <= chunkSize {
+		err = store.EaWriteFile(path, opts.FollowReparsePoint, EaInfo{Flags: flags, EaName: name, EaValue: value})
+	} else {
+		err = writeChunks(store, path, name, flags, value, chunkSize, opts)
+	}
+	if err != nil || oldManifest == nil {
+		return err
+	}
+
+	// the manifest does not point to the previous chunks anymore
+	return removeChunks(store, path, name, oldManifest, opts.FollowReparsePoint)
+}
+
+// writeChunks writes value split by chunkSize and then its manifest, chunks are named with a new id.
+func writeChunks(store EaStore, path, name string, flags uint8, value []byte, chunkSize int, opts *ChunkOptions) error {
+	m := chunkManifest{
+		Version: chunkManifestVersion,
+		Size:    len(value),
+		SHA256:  sha256Hex(value),
+	}
+
+	for _, c := range opts.Companions {
+		if filepath.IsAbs(c) == filepath.IsAbs(path) {
+			if rel, err := filepath.Rel(filepath.Dir(path), c); err == nil {
+				c = rel
+			}
+		}
+		m.Companions = append(m.Companions, c)
+	}
+	files := m.chunkFiles(path)
+
+	var chunks [][]byte
+	for off := 0; off < len(value); off += chunkSize {
+		end := off + chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		chunks = append(chunks, value[off:end])
+		m.Chunks = append(m.Chunks, chunkEntry{File: len(files) - 1, Size: end - off, SHA256: sha256Hex(value[off:end])})
+	}
+
+	var err error
+	current := make([][]EaInfo, len(files))
+	for i, f := range files {
+		if current[i], err = store.QueryFileEa(f, opts.FollowReparsePoint); err != nil {
+			return err
+		}
+	}
+
+	if m.ID, err = newChunkID(name, len(chunks), current); err != nil {
+		return err
+	}
+
+	// the manifest with every chunk in the last file is the largest one, reserve it in the target file
+	maxManifest, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	nameBuf, err := strToEaNameBuffer(chunkEaName(name, m.ID, len(chunks)))
+	if err != nil {
+		return err
+	}
+	chunkNameLen := len(nameBuf)
+
+	manifestNameBuf, err := strToEaNameBuffer(name)
+	if err != nil {
+		return err
+	}
+
+	free := make([]int, len(files))
+	for i, eas := range current {
+
+		if i == 0 {
+			// the manifest EA is replaced
+			eas, err = mergeEaInfo(eas, []EaInfo{{EaName: name}})
+			if err != nil {
+				return err
+			}
+		}
+
+		used, err := eaSetSize(eas)
+		if err != nil {
+			return err
+		}
+
+		free[i] = maxEaSetSize - used
+		if i == 0 {
+			free[i] -= eaEntrySize(len(manifestNameBuf), len(chunkManifestMagic)+len(maxManifest))
+		}
+	}
+
+	toWrite := make([][]EaInfo, len(files))
+	fileIdx := 0
+	for i, chunk := range chunks {
+		size := eaEntrySize(chunkNameLen, len(chunk))
+		for fileIdx < len(files) && free[fileIdx] < size {
+			fileIdx++
+		}
+		if fileIdx == len(files) {
+			return fmt.Errorf("EA value of %d bytes does not fit in the EA budget of %d file(s)", len(value), len(files))
+		}
+
+		free[fileIdx] -= size
+		m.Chunks[i].File = fileIdx
+		toWrite[fileIdx] = append(toWrite[fileIdx], EaInfo{EaName: chunkEaName(name, m.ID, i), EaValue: chunk})
+	}
+
+	for i, eas := range toWrite {
+		if len(eas) == 0 {
+			continue
+		}
+		if err = store.EaWriteFile(files[i], opts.FollowReparsePoint, eas...); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return store.EaWriteFile(path, opts.FollowReparsePoint, EaInfo{
+		Flags:   flags,
+		EaName:  name,
+		EaValue: append([]byte(chunkManifestMagic), manifest...),
+	})
+}
+
+// WriteChunkedEaWithFile writes the content of the file in src as chunked EA like WriteChunkedEa, it is not limited to 65528 bytes as WriteEaWithFile.
+func WriteChunkedEaWithFile(dst string, src string, name string, flags uint8, opts *ChunkOptions) error {
+	buf, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return WriteChunkedEa(dst, name, flags, buf, opts)
+}
+
+// ReadChunkedEa queries EA with name in path and reassembles its chunks if it is a manifest written by WriteChunkedEa.
+// EA which is not chunked is returned as is, ErrEaNotFound is returned if the EA does not exist and ErrChunkMissing or ErrChunkCorrupted
+// is returned if a chunk can not be found or is not valid.
+func ReadChunkedEa(path, name string, opts *ChunkOptions) (EaInfo, error) {
+	opts, store, err := opts.orDefault()
+	if err != nil {
+		return EaInfo{}, err
+	}
+
+	ea, m, err := queryChunkManifest(store, path, name, opts.FollowReparsePoint)
+	if err != nil {
+		return EaInfo{}, err
+	}
+	if len(ea.EaValue) == 0 {
+		return EaInfo{}, fmt.Errorf("%w: %s in %s", ErrEaNotFound, name, path)
+	}
+	if m == nil {
+		return ea, nil
+	}
+
+	files := m.chunkFiles(path)
+
+	value := make([]byte, 0, m.Size)
+	for i, c := range m.Chunks {
+		chunkName := chunkEaName(name, m.ID, i)
+		if c.File < 0 || c.File >= len(files) {
+			return EaInfo{}, fmt.Errorf("%w: %s is in unknown file %d", ErrChunkMissing, chunkName, c.File)
+		}
+
+		eas, err := store.QueryFileEa(files[c.File], opts.FollowReparsePoint, chunkName)
+		if errors.Is(err, os.ErrNotExist) {
+			return EaInfo{}, fmt.Errorf("%w: %s in %s: %v", ErrChunkMissing, chunkName, files[c.File], err)
+		}
+		if err != nil {
+			return EaInfo{}, err
+		}
+
+		var chunk []byte
+		for _, e := range eas {
+			if eaNameKey(e.EaName) == eaNameKey(chunkName) {
+				chunk = e.EaValue
+			}
+		}
+
+		if len(chunk) == 0 {
+			return EaInfo{}, fmt.Errorf("%w: %s in %s", ErrChunkMissing, chunkName, files[c.File])
+		}
+		if len(chunk) != c.Size || sha256Hex(chunk) != c.SHA256 {
+			return EaInfo{}, fmt.Errorf("%w: %s in %s", ErrChunkCorrupted, chunkName, files[c.File])
+		}
+
+		value = append(value, chunk...)
+	}
+
+	if len(value) != m.Size || sha256Hex(value) != m.SHA256 {
+		return EaInfo{}, fmt.Errorf("%w: reassembled value of %s does not match the manifest", ErrChunkCorrupted, name)
+	}
+
+	ea.EaValue = value
+
+	return ea, nil
+}
+
+// RemoveChunkedEa removes EA with name from path, including its chunks if it is chunked.
+func RemoveChunkedEa(path, name string, opts *ChunkOptions) error {
+	opts, store, err := opts.orDefault()
+	if err != nil {
+		return err
+	}
+
+	_, m, err := queryChunkManifest(store, path, name, opts.FollowReparsePoint)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		if err = removeChunks(store, path, name, m, opts.FollowReparsePoint); err != nil {
+			return err
+		}
+	}
+
+	return store.EaWriteFile(path, opts.FollowReparsePoint, EaInfo{EaName: name})
+}
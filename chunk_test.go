@@ -0,0 +1,176 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkedEa(t *testing.T) {
+	root := createTestTree(t, "target.txt", "companion1.txt", "companion2.txt")
+	target := filepath.Join(root, "target.txt")
+	store := NewMemStore()
+
+	opts := &ChunkOptions{
+		Store:      store,
+		Companions: []string{filepath.Join(root, "companion1.txt"), filepath.Join(root, "companion2.txt")},
+	}
+
+	value := make([]byte, 150000)
+	rand.New(rand.NewSource(1)).Read(value)
+
+	err := store.EaWriteFile(target, false, EaInfo{EaName: "OTHER", EaValue: []byte("other value")})
+	if err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+
+	err = WriteChunkedEa(target, "BIGEA", NeedEa, value, opts)
+	if err != nil {
+		t.Fatalf("WriteChunkedEa failed: %v", err)
+	}
+
+	ea, err := ReadChunkedEa(target, "bigea", opts)
+	if err != nil {
+		t.Fatalf("ReadChunkedEa failed: %v", err)
+	}
+	if ea.Flags != NeedEa || !bytes.Equal(ea.EaValue, value) {
+		t.Fatalf("Reassembled EA mismatch: flags 0x%x, %d bytes", ea.Flags, len(ea.EaValue))
+	}
+
+	for _, p := range opts.Companions {
+		if eas, _ := store.QueryFileEa(p, false); len(eas) == 0 {
+			t.Fatalf("Expected chunks in %s", p)
+		}
+	}
+
+	// the smaller value replaces the chunks with a plain EA
+	err = WriteChunkedEa(target, "BIGEA", 0, []byte("small"), opts)
+	if err != nil {
+		t.Fatalf("WriteChunkedEa failed: %v", err)
+	}
+
+	eas, _ := store.QueryFileEa(opts.Companions[1], false)
+	if len(eas) != 0 {
+		t.Fatalf("Expected stale chunks to be removed, got %d EAs", len(eas))
+	}
+
+	ea, err = ReadChunkedEa(target, "BIGEA", opts)
+	if err != nil || string(ea.EaValue) != "small" {
+		t.Fatalf("Unexpected plain EA: %v, %v", ea, err)
+	}
+
+	if err = WriteChunkedEa(target, "BIGEA", 0, value, &ChunkOptions{Store: store}); err == nil {
+		t.Fatalf("Expected error for value larger than the EA budget without companions")
+	}
+
+	if _, err = ReadChunkedEa(target, "MISSING", opts); !errors.Is(err, ErrEaNotFound) {
+		t.Fatalf("Expected ErrEaNotFound, got %v", err)
+	}
+}
+
+func TestChunkedEaRewrite(t *testing.T) {
+	root := createTestTree(t, "target.txt")
+	target := filepath.Join(root, "target.txt")
+	store := NewMemStore()
+	opts := &ChunkOptions{Store: store, ChunkSize: 1000}
+
+	value := bytes.Repeat([]byte("first value "), 300)
+	if err := WriteChunkedEa(target, "DATA", 0, value, opts); err != nil {
+		t.Fatalf("WriteChunkedEa failed: %v", err)
+	}
+
+	// the new value does not fit, the previous value is kept
+	if err := WriteChunkedEa(target, "DATA", 0, make([]byte, 70000), opts); err == nil {
+		t.Fatal("Expected error for value larger than the EA budget")
+	}
+	if ea, err := ReadChunkedEa(target, "DATA", opts); err != nil || !bytes.Equal(ea.EaValue, value) {
+		t.Fatalf("Previous value should be kept: %d bytes, %v", len(ea.EaValue), err)
+	}
+
+	// chunks of the new value have fresh names and the previous ones are removed
+	_, first, err := queryChunkManifest(store, target, "DATA", false)
+	if err != nil || first == nil {
+		t.Fatalf("Expected a chunk manifest: %v", err)
+	}
+	value = bytes.Repeat([]byte("second value "), 200)
+	if err := WriteChunkedEa(target, "DATA", 0, value, opts); err != nil {
+		t.Fatalf("WriteChunkedEa failed: %v", err)
+	}
+	if ea, err := ReadChunkedEa(target, "DATA", opts); err != nil || !bytes.Equal(ea.EaValue, value) {
+		t.Fatalf("Unexpected value: %d bytes, %v", len(ea.EaValue), err)
+	}
+
+	_, second, err := queryChunkManifest(store, target, "DATA", false)
+	if err != nil || second == nil || second.ID == first.ID {
+		t.Fatalf("Expected a chunk manifest with a new id: %+v, %v", second, err)
+	}
+	eas, _ := store.QueryFileEa(target, false, "DATA", chunkEaName("DATA", second.ID, 0), chunkEaName("DATA", second.ID, 1), chunkEaName("DATA", second.ID, 2))
+	if all, _ := store.QueryFileEa(target, false); len(all) != 4 || len(eas) != 4 {
+		t.Fatalf("Expected the manifest and 3 chunks of the second value, got %d EAs", len(all))
+	}
+}
+
+func TestChunkedEaErrors(t *testing.T) {
+	root := createTestTree(t, "target.txt")
+	target := filepath.Join(root, "target.txt")
+	store := NewMemStore()
+	opts := &ChunkOptions{Store: store, ChunkSize: 1000}
+
+	value := bytes.Repeat([]byte("chunked value "), 300)
+
+	if err := WriteChunkedEa(target, "DATA", 0, value, opts); err != nil {
+		t.Fatalf("WriteChunkedEa failed: %v", err)
+	}
+
+	_, m, err := queryChunkManifest(store, target, "DATA", false)
+	if err != nil || m == nil {
+		t.Fatalf("Expected a chunk manifest: %v", err)
+	}
+
+	if err := store.EaWriteFile(target, false, EaInfo{EaName: chunkEaName("DATA", m.ID, 1), EaValue: []byte("tampered")}); err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+	if _, err := ReadChunkedEa(target, "DATA", opts); !errors.Is(err, ErrChunkCorrupted) {
+		t.Fatalf("Expected ErrChunkCorrupted, got %v", err)
+	}
+
+	if err := store.EaWriteFile(target, false, EaInfo{EaName: chunkEaName("DATA", m.ID, 1)}); err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+	if _, err := ReadChunkedEa(target, "DATA", opts); !errors.Is(err, ErrChunkMissing) {
+		t.Fatalf("Expected ErrChunkMissing, got %v", err)
+	}
+
+	if err := RemoveChunkedEa(target, "DATA", opts); err != nil {
+		t.Fatalf("RemoveChunkedEa failed: %v", err)
+	}
+	if eas, _ := store.QueryFileEa(target, false); len(eas) != 0 {
+		t.Fatalf("Expected all EAs to be removed, got %v", eas)
+	}
+}
+
+func TestChunkedEaSharedCompanion(t *testing.T) {
+	root := createTestTree(t, "a.txt", "b.txt", "companion.txt")
+	store := NewMemStore()
+	opts := &ChunkOptions{Store: store, Companions: []string{filepath.Join(root, "companion.txt")}}
+
+	// each value is larger than the EA budget of its file, so both have chunks in the companion
+	values := map[string][]byte{}
+	for i, f := range []string{"a.txt", "b.txt"} {
+		values[f] = make([]byte, 80000)
+		rand.New(rand.NewSource(int64(i))).Read(values[f])
+
+		if err := WriteChunkedEa(filepath.Join(root, f), "BIGEA", 0, values[f], opts); err != nil {
+			t.Fatalf("WriteChunkedEa failed for %s: %v", f, err)
+		}
+	}
+
+	for f, value := range values {
+		ea, err := ReadChunkedEa(filepath.Join(root, f), "BIGEA", opts)
+		if err != nil || !bytes.Equal(ea.EaValue, value) {
+			t.Fatalf("Unexpected value of %s: %d bytes, %v", f, len(ea.EaValue), err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+//go:generate go run github.com/josephspurrier/goversioninfo/cmd/goversioninfo ea_history.json
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Snshadow/ntfs-ea"
+)
+
+func main() {
+	var dir, tag string
+	var followReparsePoint bool
+
+	defaultDir := os.Getenv("EA_HISTORY_DIR")
+	if defaultDir == "" {
+		defaultDir = ".ea_history"
+	}
+
+	flag.StringVar(&dir, "dir", defaultDir, "directory of the history, $EA_HISTORY_DIR or .ea_history by default")
+	flag.StringVar(&tag, "tag", "ea_history", "author or tool recorded with EA sets")
+	flag.BoolVar(&followReparsePoint, "follow-reparse-point", false, "follow reparse point")
+
+	progName := filepath.Base(os.Args[0])
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "%s keeps history of EA(Extended Attribute) sets of files, each EA set is stored once by its content.\n"+
+			"Usage: %s [flags] record [path]...\n"+
+			" or\n %s [flags] log [path]\n"+
+			" or\n %s [flags] show [path] [revision]\n"+
+			" or\n %s [flags] diff [path] [old revision] [new revision]\n"+
+			" or\n %s [flags] rollback [path] [revision]\n"+
+			" or\n %s [flags] paths\n"+
+			"A revision is a unique prefix of a hash, or @N for the Nth record in the log of the path with negative N counted from the last one.\n"+
+			"diff compares with the current EAs of the file if the new revision is omitted.\n\n",
+			progName, progName, progName, progName, progName, progName, progName)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	cmd, args := args[0], args[1:]
+	switch {
+	case cmd == "record" && len(args) != 0,
+		cmd == "log" && len(args) == 1,
+		cmd == "show" && len(args) == 2,
+		cmd == "diff" && (len(args) == 2 || len(args) == 3),
+		cmd == "rollback" && len(args) == 2,
+		cmd == "paths" && len(args) == 0:
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	h, err := ntfs_ea.OpenEaHistory(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open history: %v\n", err)
+		os.Exit(2)
+	}
+
+	switch cmd {
+	case "record":
+		failed := false
+		for _, path := range args {
+			entry, err := h.Observe(path, followReparsePoint, nil, tag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to record EAs of %s: %v\n", path, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s %s\n", entry.Hash[:12], entry.Path)
+		}
+		if failed {
+			os.Exit(2)
+		}
+
+	case "log":
+		entries, err := h.Log(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read history: %v\n", err)
+			os.Exit(2)
+		}
+		for i, e := range entries {
+			eas, err := h.Get(e.Hash)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read EA set %s: %v\n", e.Hash, err)
+				os.Exit(2)
+			}
+			fmt.Printf("@%d %s %s %d EAs %s\n", i, e.Hash[:12], e.Time.Local().Format("2006-01-02 15:04:05"), len(eas), e.Tag)
+		}
+
+	case "show":
+		hash, err := h.ResolveRevision(args[0], args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		eas, err := h.Get(hash)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read EA set %s: %v\n", hash, err)
+			os.Exit(2)
+		}
+		fmt.Println(hash)
+		for _, ea := range eas {
+			fmt.Printf("%s (flags 0x%x, %d bytes)\n", ea.EaName, ea.Flags, len(ea.EaValue))
+		}
+
+	case "diff":
+		var d *ntfs_ea.EaDiff
+		if len(args) == 3 {
+			d, err = h.Diff(args[0], args[1], args[2])
+		} else {
+			d, err = diffCurrent(h, args[0], args[1], followReparsePoint)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to compare EA sets: %v\n", err)
+			os.Exit(2)
+		}
+		fmt.Print(d)
+
+	case "rollback":
+		d, err := h.Rollback(args[0], args[1], followReparsePoint, nil, tag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to roll back EAs of %s: %v\n", args[0], err)
+			os.Exit(2)
+		}
+		fmt.Print(d)
+
+	case "paths":
+		paths, err := h.Paths()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read history: %v\n", err)
+			os.Exit(2)
+		}
+		for _, p := range paths {
+			fmt.Println(p)
+		}
+	}
+}
+
+// diffCurrent compares the EA set of rev with the current EAs of the file in path.
+func diffCurrent(h *ntfs_ea.EaHistory, path, rev string, followReparsePoint bool) (*ntfs_ea.EaDiff, error) {
+	hash, err := h.ResolveRevision(path, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := h.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	store := ntfs_ea.DefaultStore()
+	if store == nil {
+		return nil, ntfs_ea.ErrNoDefaultStore
+	}
+
+	current, err := store.QueryFileEa(path, followReparsePoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return ntfs_ea.DiffEas(old, current), nil
+}
@@ -0,0 +1,352 @@
+//go:generate go run github.com/josephspurrier/goversioninfo/cmd/goversioninfo gen_ea_accessors.json
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/Snshadow/ntfs-ea"
+)
+
+// goType is the Go type and codec used for a schema type.
+type goType struct {
+	GoType string
+	Codec  string
+	Import string
+}
+
+var goTypes = map[string]goType{
+	ntfs_ea.SchemaBinary:   {"[]byte", "ntfs_ea.RawCodec{}", ""},
+	ntfs_ea.SchemaUTF8:     {"string", "ntfs_ea.UTF8Codec{}", ""},
+	ntfs_ea.SchemaUTF16:    {"string", "ntfs_ea.UTF16Codec{}", ""},
+	ntfs_ea.SchemaUTF16Z:   {"string", "ntfs_ea.UTF16Codec{NulTerminated: true}", ""},
+	ntfs_ea.SchemaInt8:     {"int8", "ntfs_ea.IntCodec[int8]{}", ""},
+	ntfs_ea.SchemaInt16:    {"int16", "ntfs_ea.IntCodec[int16]{}", ""},
+	ntfs_ea.SchemaInt32:    {"int32", "ntfs_ea.IntCodec[int32]{}", ""},
+	ntfs_ea.SchemaInt64:    {"int64", "ntfs_ea.IntCodec[int64]{}", ""},
+	ntfs_ea.SchemaUint8:    {"uint8", "ntfs_ea.IntCodec[uint8]{}", ""},
+	ntfs_ea.SchemaUint16:   {"uint16", "ntfs_ea.IntCodec[uint16]{}", ""},
+	ntfs_ea.SchemaUint32:   {"uint32", "ntfs_ea.IntCodec[uint32]{}", ""},
+	ntfs_ea.SchemaUint64:   {"uint64", "ntfs_ea.IntCodec[uint64]{}", ""},
+	ntfs_ea.SchemaBool:     {"bool", "ntfs_ea.BoolCodec{}", ""},
+	ntfs_ea.SchemaFiletime: {"time.Time", "ntfs_ea.FiletimeCodec{}", "time"},
+	ntfs_ea.SchemaGUID:     {"ntfs_ea.GUID", "ntfs_ea.GUIDCodec{}", ""},
+	ntfs_ea.SchemaJSON:     {"json.RawMessage", "ntfs_ea.JSONCodec[json.RawMessage]{}", "encoding/json"},
+	ntfs_ea.SchemaOS2:      {"ntfs_ea.TypedValue", "ntfs_ea.TypedValueCodec{}", ""},
+}
+
+// reservedNames are the fields and methods of the generated type which accessors can not use.
+var reservedNames = map[string]bool{"Path": true, "FollowReparsePoint": true, "Store": true, "Validate": true}
+
+type accessor struct {
+	ntfs_ea.EaFieldSchema
+	goType
+	GoName string
+	Flags  string
+	Sample string // expression of a valid value for the round-trip test
+}
+
+type genData struct {
+	Command    string
+	SchemaFile string
+	Package    string
+	TypeName   string
+	SchemaVar  string
+	SchemaJSON string
+	Imports    []string
+	TestImport []string
+	Accessors  []accessor
+}
+
+// goName derives an exported Go name from an EA name, e.g. "APP.VERSION" into "AppVersion".
+func goName(eaName string) string {
+	var sb strings.Builder
+
+	for _, part := range strings.FieldsFunc(eaName, func(r rune) bool {
+		return !(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)))
+	}) {
+		sb.WriteString(strings.ToUpper(part[:1]))
+		sb.WriteString(strings.ToLower(part[1:]))
+	}
+
+	name := sb.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "Ea" + name
+	}
+
+	return name
+}
+
+// sampleString returns a string whose encoded size fits into the bounds of f.
+func sampleString(f ntfs_ea.EaFieldSchema) string {
+	unit, extra := 1, 0
+	switch f.Type {
+	case ntfs_ea.SchemaUTF16:
+		unit = 2
+	case ntfs_ea.SchemaUTF16Z:
+		unit, extra = 2, 2
+	case ntfs_ea.SchemaOS2:
+		extra = 4
+	}
+
+	n := 4
+	if f.MinSize != 0 && unit*n+extra < f.MinSize {
+		n = (f.MinSize - extra + unit - 1) / unit
+	}
+	if f.MaxSize != 0 && unit*n+extra > f.MaxSize {
+		n = (f.MaxSize - extra) / unit
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	return strings.Repeat("t", n)
+}
+
+// sampleExpr returns a Go expression of a value of f for the round-trip test, the first allowed value is used if any.
+func sampleExpr(f ntfs_ea.EaFieldSchema) (string, error) {
+	var allowed string
+	hasAllowed := len(f.Allowed) != 0
+	if hasAllowed {
+		allowed = f.Allowed[0]
+	}
+
+	switch f.Type {
+	case "", ntfs_ea.SchemaBinary:
+		b := bytes.Repeat([]byte{0xa5}, 4)
+		if f.MinSize > len(b) {
+			b = bytes.Repeat([]byte{0xa5}, f.MinSize)
+		}
+		if f.MaxSize != 0 && f.MaxSize < len(b) {
+			b = b[:f.MaxSize]
+		}
+		if hasAllowed {
+			var err error
+			if b, err = hex.DecodeString(allowed); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%#v", b), nil
+	case ntfs_ea.SchemaUTF8, ntfs_ea.SchemaUTF16, ntfs_ea.SchemaUTF16Z:
+		if hasAllowed {
+			return strconv.Quote(allowed), nil
+		}
+		return strconv.Quote(sampleString(f)), nil
+	case ntfs_ea.SchemaOS2:
+		if !hasAllowed {
+			allowed = sampleString(f)
+		}
+		return fmt.Sprintf("ntfs_ea.ASCIIValue(%q)", allowed), nil
+	case ntfs_ea.SchemaInt8, ntfs_ea.SchemaInt16, ntfs_ea.SchemaInt32, ntfs_ea.SchemaInt64:
+		if !hasAllowed {
+			return "1", nil
+		}
+		v, err := strconv.ParseInt(allowed, 0, 64)
+		return strconv.FormatInt(v, 10), err
+	case ntfs_ea.SchemaUint8, ntfs_ea.SchemaUint16, ntfs_ea.SchemaUint32, ntfs_ea.SchemaUint64:
+		if !hasAllowed {
+			return "1", nil
+		}
+		v, err := strconv.ParseUint(allowed, 0, 64)
+		return strconv.FormatUint(v, 10), err
+	case ntfs_ea.SchemaBool:
+		if !hasAllowed {
+			return "true", nil
+		}
+		v, err := strconv.ParseBool(allowed)
+		return strconv.FormatBool(v), err
+	case ntfs_ea.SchemaFiletime:
+		t := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+		if hasAllowed {
+			var err error
+			if t, err = time.Parse(time.RFC3339Nano, allowed); err != nil {
+				return "", err
+			}
+			t = t.UTC().Truncate(100 * time.Nanosecond)
+		}
+		return fmt.Sprintf("time.Date(%d, %d, %d, %d, %d, %d, %d, time.UTC)", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()), nil
+	case ntfs_ea.SchemaGUID:
+		g := ntfs_ea.GUID{Data1: 1, Data2: 2, Data3: 3, Data4: [8]byte{4, 5, 6, 7, 8, 9, 10, 11}}
+		if hasAllowed {
+			var err error
+			if g, err = ntfs_ea.ParseGUID(allowed); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%#v", g), nil
+	case ntfs_ea.SchemaJSON:
+		if !hasAllowed {
+			allowed = `{"test":true}`
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(allowed)); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("json.RawMessage(%q)", buf.String()), nil
+	}
+
+	return "", fmt.Errorf("unknown type %q", f.Type)
+}
+
+func generate(schema *ntfs_ea.EaSchema, schemaFile, pkg, typeName string) (code, test []byte, err error) {
+	if !token.IsIdentifier(typeName) || !token.IsExported(typeName) {
+		return nil, nil, fmt.Errorf("type name %q is not an exported identifier", typeName)
+	}
+
+	schemaJSON, err := json.MarshalIndent(schema, "", "\t")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := &genData{
+		Command:    "gen_ea_accessors",
+		SchemaFile: filepath.ToSlash(schemaFile),
+		Package:    pkg,
+		TypeName:   typeName,
+		SchemaVar:  strings.ToLower(typeName[:1]) + typeName[1:] + "Schema",
+		SchemaJSON: string(schemaJSON),
+	}
+
+	imports := map[string]bool{}
+	testImports := map[string]bool{}
+	methods := map[string]string{}
+
+	for _, f := range schema.Fields {
+		t := f.Type
+		if t == "" {
+			t = ntfs_ea.SchemaBinary
+		}
+
+		a := accessor{EaFieldSchema: f, goType: goTypes[t], GoName: f.GoName, Flags: "0"}
+		if a.GoName == "" {
+			a.GoName = goName(f.Name)
+		}
+		if !token.IsIdentifier(a.GoName) || !token.IsExported(a.GoName) {
+			return nil, nil, fmt.Errorf("%s: Go name %q is not an exported identifier", f.Name, a.GoName)
+		}
+
+		for _, m := range []string{a.GoName, "Set" + a.GoName, "Remove" + a.GoName} {
+			if reservedNames[m] {
+				return nil, nil, fmt.Errorf("%s: %s is reserved, set goName in the schema", f.Name, m)
+			}
+			if other, ok := methods[m]; ok {
+				return nil, nil, fmt.Errorf("%s: %s is also made for %s, set goName in the schema", f.Name, m, other)
+			}
+			methods[m] = f.Name
+		}
+
+		if f.NeedEa != nil && *f.NeedEa {
+			a.Flags = "ntfs_ea.NeedEa"
+		}
+
+		if a.Sample, err = sampleExpr(f); err != nil {
+			return nil, nil, fmt.Errorf("%s: invalid allowed value: %w", f.Name, err)
+		}
+
+		if a.Import != "" {
+			imports[a.Import] = true
+			testImports[a.Import] = true
+		}
+
+		data.Accessors = append(data.Accessors, a)
+	}
+
+	for imp := range imports {
+		data.Imports = append(data.Imports, imp)
+	}
+	sort.Strings(data.Imports)
+	for imp := range testImports {
+		data.TestImport = append(data.TestImport, imp)
+	}
+	sort.Strings(data.TestImport)
+
+	if code, err = execute(codeTemplate, data); err != nil {
+		return nil, nil, err
+	}
+	if test, err = execute(testTemplate, data); err != nil {
+		return nil, nil, err
+	}
+
+	return code, test, nil
+}
+
+func execute(tmpl *template.Template, data *genData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w\n%s", err, buf.Bytes())
+	}
+
+	return src, nil
+}
+
+func main() {
+	var schemaPath, typeName, pkg, output string
+	var noTest bool
+
+	flag.StringVar(&schemaPath, "schema", "", "path of the EA schema in JSON")
+	flag.StringVar(&typeName, "type", "", "name of the generated type")
+	flag.StringVar(&pkg, "package", os.Getenv("GOPACKAGE"), "package of the generated code, $GOPACKAGE set by go generate by default")
+	flag.StringVar(&output, "output", "", "path of the generated code, z<type>.go in lower case by default")
+	flag.BoolVar(&noTest, "no-test", false, "do not generate round-trip tests")
+
+	progName := filepath.Base(os.Args[0])
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "%s generates a Go type with typed accessors for EAs(Extended Attributes) declared in an EA schema, along with its round-trip tests.\nUsage: %s -schema [schema path] -type [type name]\nIn a Go source: //go:generate go run github.com/Snshadow/ntfs-ea/cmd/gen_ea_accessors -schema [schema path] -type [type name]\n\n", progName, progName)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if schemaPath == "" || typeName == "" || pkg == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if output == "" {
+		output = "z" + strings.ToLower(typeName) + ".go"
+	}
+
+	schema, err := ntfs_ea.LoadEaSchema(schemaPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading schema: %v\n", err)
+		os.Exit(2)
+	}
+
+	code, test, err := generate(schema, filepath.Base(schemaPath), pkg, typeName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating code: %v\n", err)
+		os.Exit(2)
+	}
+
+	if err = os.WriteFile(output, code, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing code: %v\n", err)
+		os.Exit(2)
+	}
+
+	if !noTest {
+		if err = os.WriteFile(strings.TrimSuffix(output, ".go")+"_test.go", test, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing test: %v\n", err)
+			os.Exit(2)
+		}
+	}
+}
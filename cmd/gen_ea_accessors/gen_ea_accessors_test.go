@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Snshadow/ntfs-ea"
+)
+
+func TestGoName(t *testing.T) {
+	for eaName, expected := range map[string]string{
+		"APPVERSION":  "Appversion",
+		"APP.VERSION": "AppVersion",
+		".LONGNAME":   "Longname",
+		"$LXUID":      "Lxuid",
+		"2ND_COPY":    "Ea2ndCopy",
+	} {
+		if name := goName(eaName); name != expected {
+			t.Fatalf("%q converted into %q, expected %q", eaName, name, expected)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	schema, err := ntfs_ea.LoadEaSchema("testdata/contract.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, test, err := generate(schema, "contract.json", "contract", "AppEas")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"func (e AppEas) AppVersion() (string, error)",
+		`ntfs_ea.SetTyped[string](e.Path, e.FollowReparsePoint, e.Store, "APP.VERSION", ntfs_ea.NeedEa, v, ntfs_ea.UTF8Codec{})`,
+		"func (e AppEas) SetInstanceID(v ntfs_ea.GUID) error",
+		"func (e AppEas) RemoveAppSettings() error",
+		"const appEasSchemaJSON = `{",
+	} {
+		if !bytes.Contains(code, []byte(expected)) {
+			t.Fatalf("Generated code does not have %q:\n%s", expected, code)
+		}
+	}
+
+	for _, expected := range []string{
+		"func TestAppEasRoundTrip(t *testing.T)",
+		`var want string = "stable"`,
+		"var want uint32 = 16",
+		"var want []byte = []byte{0xa5, 0xa5, 0xa5, 0xa5, 0xa5, 0xa5, 0xa5, 0xa5}",
+	} {
+		if !bytes.Contains(test, []byte(expected)) {
+			t.Fatalf("Generated test does not have %q:\n%s", expected, test)
+		}
+	}
+
+	for _, fields := range [][]ntfs_ea.EaFieldSchema{
+		{{Name: "PATH"}},
+		{{Name: "A.B"}, {Name: "A_B"}},
+		{{Name: "A", GoName: "lower"}},
+	} {
+		if _, _, err = generate(&ntfs_ea.EaSchema{Fields: fields}, "schema.json", "p", "T"); err == nil {
+			t.Fatalf("Expected error for %v", fields)
+		}
+	}
+}
+
+// TestGeneratedCompiles builds the generated code in a temporary module which uses this module and runs its round-trip tests,
+// so a template which generates broken code fails here.
+func TestGeneratedCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test in a temporary module")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command is not found")
+	}
+
+	schema, err := ntfs_ea.LoadEaSchema("testdata/contract.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, test, err := generate(schema, "contract.json", "contract", "AppEas")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goSum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	goMod := "module contract\n\ngo 1.20\n\nrequire github.com/Snshadow/ntfs-ea v0.0.0\n\nreplace github.com/Snshadow/ntfs-ea => " + strconv.Quote(root) + "\n"
+	for name, data := range map[string][]byte{
+		"go.mod":          []byte(goMod),
+		"go.sum":          goSum,
+		"zappeas.go":      code,
+		"zappeas_test.go": test,
+	} {
+		if err = os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goBin, "test", "-mod=mod", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOPROXY=off", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Generated code does not pass go test: %v\n%s\n%s", err, out, code)
+	}
+}
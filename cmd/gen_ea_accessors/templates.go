@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var funcs = template.FuncMap{
+	// goString returns s as a raw string literal if possible.
+	"goString": func(s string) string {
+		if !strconv.CanBackquote(strings.ReplaceAll(s, "\n", "")) {
+			return strconv.Quote(s)
+		}
+
+		return "`" + s + "`"
+	},
+}
+
+var codeTemplate = template.Must(template.New("code").Funcs(funcs).Parse(`// Code generated by {{.Command}} from {{.SchemaFile}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+
+	"github.com/Snshadow/ntfs-ea"
+)
+
+// {{.TypeName}} accesses EAs of the file in Path declared in {{.SchemaFile}}.
+type {{.TypeName}} struct {
+	Path               string
+	FollowReparsePoint bool
+	Store              ntfs_ea.EaStore // DefaultStore() if nil
+}
+
+const {{.SchemaVar}}JSON = {{goString .SchemaJSON}}
+
+var {{.SchemaVar}} = func() *ntfs_ea.EaSchema {
+	s, err := ntfs_ea.ParseEaSchema([]byte({{.SchemaVar}}JSON))
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}()
+
+// Validate checks EAs of the file against {{.SchemaFile}}.
+func (e {{$.TypeName}}) Validate() error {
+	return {{.SchemaVar}}.ValidateFile(e.Path, e.FollowReparsePoint, e.Store)
+}
+{{range .Accessors}}
+// {{.GoName}} returns {{.Name}}{{with .Description}}, {{.}}{{end}}. ntfs_ea.ErrEaNotFound is returned if it does not exist.
+func (e {{$.TypeName}}) {{.GoName}}() ({{.GoType}}, error) {
+	return ntfs_ea.GetTyped[{{.GoType}}](e.Path, e.FollowReparsePoint, e.Store, {{printf "%q" .Name}}, {{.Codec}})
+}
+
+// Set{{.GoName}} writes v as {{.Name}}.
+func (e {{$.TypeName}}) Set{{.GoName}}(v {{.GoType}}) error {
+	return ntfs_ea.SetTyped[{{.GoType}}](e.Path, e.FollowReparsePoint, e.Store, {{printf "%q" .Name}}, {{.Flags}}, v, {{.Codec}})
+}
+
+// Remove{{.GoName}} removes {{.Name}}.
+func (e {{$.TypeName}}) Remove{{.GoName}}() error {
+	store, err := e.store()
+	if err != nil {
+		return err
+	}
+
+	return store.EaWriteFile(e.Path, e.FollowReparsePoint, ntfs_ea.EaInfo{EaName: {{printf "%q" .Name}}})
+}
+{{end}}
+func (e {{.TypeName}}) store() (ntfs_ea.EaStore, error) {
+	if e.Store != nil {
+		return e.Store, nil
+	}
+
+	if store := ntfs_ea.DefaultStore(); store != nil {
+		return store, nil
+	}
+
+	return nil, ntfs_ea.ErrNoDefaultStore
+}
+`))
+
+var testTemplate = template.Must(template.New("test").Parse(`// Code generated by {{.Command}} from {{.SchemaFile}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+{{- range .TestImport}}
+	"{{.}}"
+{{- end}}
+
+	"github.com/Snshadow/ntfs-ea"
+)
+
+func Test{{.TypeName}}RoundTrip(t *testing.T) {
+	e := {{.TypeName}}{Path: "roundtrip", Store: ntfs_ea.NewMemStore()}
+{{range .Accessors}}
+	{
+		var want {{.GoType}} = {{.Sample}}
+		if err := e.Set{{.GoName}}(want); err != nil {
+			t.Fatalf("Failed to set {{.Name}}: %v", err)
+		}
+
+		got, err := e.{{.GoName}}()
+		if err != nil {
+			t.Fatalf("Failed to get {{.Name}}: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("{{.Name}} is %v, expected %v", got, want)
+		}
+	}
+{{end}}
+	if err := e.Validate(); err != nil {
+		t.Fatalf("Round-trip values do not conform to {{.SchemaFile}}: %v", err)
+	}
+{{range .Accessors}}
+	if err := e.Remove{{.GoName}}(); err != nil {
+		t.Fatalf("Failed to remove {{.Name}}: %v", err)
+	}
+	if _, err := e.{{.GoName}}(); !errors.Is(err, ntfs_ea.ErrEaNotFound) {
+		t.Fatalf("{{.Name}} should be removed, got %v", err)
+	}
+{{end -}}
+}
+`))
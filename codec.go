@@ -0,0 +1,333 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// ErrCodec is returned when a value can not be encoded into or decoded from EaValue.
+var ErrCodec = errors.New("invalid EA value for codec")
+
+// Codec converts between a Go value and EaValue.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(b []byte) (T, error)
+}
+
+// RawCodec stores bytes as they are.
+type RawCodec struct{}
+
+func (RawCodec) Encode(b []byte) ([]byte, error) {
+	return append([]byte{}, b...), nil
+}
+
+func (RawCodec) Decode(b []byte) ([]byte, error) {
+	return append([]byte{}, b...), nil
+}
+
+// UTF8Codec stores a string as UTF-8 without terminator.
+type UTF8Codec struct{}
+
+func (UTF8Codec) Encode(s string) ([]byte, error) {
+	if !utf8.ValidString(s) {
+		return nil, fmt.Errorf("%w: string is not valid UTF-8", ErrCodec)
+	}
+
+	return []byte(s), nil
+}
+
+func (UTF8Codec) Decode(b []byte) (string, error) {
+	if !utf8.Valid(b) {
+		return "", fmt.Errorf("%w: value is not valid UTF-8", ErrCodec)
+	}
+
+	return string(b), nil
+}
+
+// UTF16Codec stores a string as UTF-16LE, which Windows programs use as wide strings.
+// With NulTerminated the value ends with a NUL character as written by wcslen(s)+1 in C, and it is required when decoding.
+type UTF16Codec struct {
+	NulTerminated bool
+}
+
+func (c UTF16Codec) Encode(s string) ([]byte, error) {
+	if !utf8.ValidString(s) {
+		return nil, fmt.Errorf("%w: string is not valid UTF-8", ErrCodec)
+	}
+
+	u := utf16.Encode([]rune(s))
+	if c.NulTerminated {
+		u = append(u, 0)
+	}
+
+	b := make([]byte, 0, 2*len(u))
+	for _, c := range u {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+
+	return b, nil
+}
+
+func (c UTF16Codec) Decode(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", fmt.Errorf("%w: UTF-16 value has odd length %d", ErrCodec, len(b))
+	}
+
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+
+	if c.NulTerminated {
+		if len(u) == 0 || u[len(u)-1] != 0 {
+			return "", fmt.Errorf("%w: UTF-16 value is not NUL terminated", ErrCodec)
+		}
+		u = u[:len(u)-1]
+	}
+
+	return string(utf16.Decode(u)), nil
+}
+
+// FixedInt is an integer type with fixed width.
+type FixedInt interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// IntCodec stores an integer as little endian of its width, e.g. DWORD for uint32 and QWORD for uint64.
+type IntCodec[T FixedInt] struct{}
+
+func (IntCodec[T]) Encode(v T) ([]byte, error) {
+	return appendUintLE(nil, uint64(v), int(unsafe.Sizeof(v))), nil
+}
+
+func (IntCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	if size := int(unsafe.Sizeof(v)); len(b) != size {
+		return v, fmt.Errorf("%w: %T should be %d bytes, got %d", ErrCodec, v, size, len(b))
+	}
+
+	return T(uintLE(b)), nil
+}
+
+// BoolCodec stores a bool as a byte of 0 or 1.
+type BoolCodec struct{}
+
+func (BoolCodec) Encode(v bool) ([]byte, error) {
+	if v {
+		return []byte{1}, nil
+	}
+
+	return []byte{0}, nil
+}
+
+func (BoolCodec) Decode(b []byte) (bool, error) {
+	if len(b) != 1 || b[0] > 1 {
+		return false, fmt.Errorf("%w: bool should be a byte of 0 or 1, got %x", ErrCodec, b)
+	}
+
+	return b[0] == 1, nil
+}
+
+// FiletimeCodec stores time.Time as 8 bytes of Windows FILETIME, 100 nanoseconds since 1601-01-01 UTC in little endian.
+// The zero time is stored as 0 and 0 is decoded as the zero time, decoded times are in UTC. Other times from 1601-01-01 00:00:00,
+// whose FILETIME is also 0, and times after the largest FILETIME are rejected.
+type FiletimeCodec struct{}
+
+func (FiletimeCodec) Encode(t time.Time) ([]byte, error) {
+	ft, err := timeToFiletime(t)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCodec, err)
+	}
+
+	return binary.LittleEndian.AppendUint64(nil, ft), nil
+}
+
+func (FiletimeCodec) Decode(b []byte) (time.Time, error) {
+	if len(b) != 8 {
+		return time.Time{}, fmt.Errorf("%w: FILETIME should be 8 bytes, got %d", ErrCodec, len(b))
+	}
+
+	t, err := filetimeToTime(binary.LittleEndian.Uint64(b))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrCodec, err)
+	}
+
+	return t, nil
+}
+
+// GUID is a Windows GUID, Data1, Data2 and Data3 are stored in little endian.
+type GUID struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+// String returns g in the registry format, e.g. {6B29FC40-CA47-1067-B31D-00DD010662DA}.
+func (g GUID) String() string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}", g.Data1, g.Data2, g.Data3, g.Data4[:2], g.Data4[2:])
+}
+
+// ParseGUID parses a GUID in the format of String, braces are optional.
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+
+	t := strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	if len(t) != 36 || t[8] != '-' || t[13] != '-' || t[18] != '-' || t[23] != '-' {
+		return g, fmt.Errorf("invalid GUID %q", s)
+	}
+
+	b, err := hex.DecodeString(t[:8] + t[9:13] + t[14:18] + t[19:23] + t[24:])
+	if err != nil {
+		return g, fmt.Errorf("invalid GUID %q", s)
+	}
+
+	g.Data1 = binary.BigEndian.Uint32(b)
+	g.Data2 = binary.BigEndian.Uint16(b[4:])
+	g.Data3 = binary.BigEndian.Uint16(b[6:])
+	copy(g.Data4[:], b[8:])
+
+	return g, nil
+}
+
+// GUIDCodec stores GUID in its 16 bytes binary layout.
+type GUIDCodec struct{}
+
+func (GUIDCodec) Encode(g GUID) ([]byte, error) {
+	b := binary.LittleEndian.AppendUint32(nil, g.Data1)
+	b = binary.LittleEndian.AppendUint16(b, g.Data2)
+	b = binary.LittleEndian.AppendUint16(b, g.Data3)
+
+	return append(b, g.Data4[:]...), nil
+}
+
+func (GUIDCodec) Decode(b []byte) (GUID, error) {
+	var g GUID
+	if len(b) != 16 {
+		return g, fmt.Errorf("%w: GUID should be 16 bytes, got %d", ErrCodec, len(b))
+	}
+
+	g.Data1 = binary.LittleEndian.Uint32(b)
+	g.Data2 = binary.LittleEndian.Uint16(b[4:])
+	g.Data3 = binary.LittleEndian.Uint16(b[6:])
+	copy(g.Data4[:], b[8:])
+
+	return g, nil
+}
+
+// TypedValueCodec stores TypedValue in the OS/2 typed EA value format.
+type TypedValueCodec struct{}
+
+func (TypedValueCodec) Encode(v TypedValue) ([]byte, error) {
+	return v.Encode()
+}
+
+func (TypedValueCodec) Decode(b []byte) (TypedValue, error) {
+	v, err := DecodeTypedValue(b)
+	if err != nil {
+		return v, fmt.Errorf("%w: %v", ErrCodec, err)
+	}
+
+	return v, nil
+}
+
+// JSONCodec stores a value as JSON.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, fmt.Errorf("%w: %v", ErrCodec, err)
+	}
+
+	return v, nil
+}
+
+// GobCodec stores a value with encoding/gob, which can only be read by Go programs.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v); err != nil {
+		return v, fmt.Errorf("%w: %v", ErrCodec, err)
+	}
+
+	return v, nil
+}
+
+// NewCodecEa returns EaInfo with v encoded by codec.
+func NewCodecEa[T any](name string, flags uint8, v T, codec Codec[T]) (EaInfo, error) {
+	value, err := codec.Encode(v)
+	if err != nil {
+		return EaInfo{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return EaInfo{Flags: flags, EaName: name, EaValue: value}, nil
+}
+
+// DecodeEa decodes EaValue of ea with codec.
+func DecodeEa[T any](ea EaInfo, codec Codec[T]) (T, error) {
+	v, err := codec.Decode(ea.EaValue)
+	if err != nil {
+		return v, fmt.Errorf("%s: %w", ea.EaName, err)
+	}
+
+	return v, nil
+}
+
+// GetTyped queries the EA with name from the file in path and decodes it with codec, ErrEaNotFound is returned if it does not exist.
+// DefaultStore() is used if store is nil.
+func GetTyped[T any](path string, followReparsePoint bool, store EaStore, name string, codec Codec[T]) (T, error) {
+	var zero T
+
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return zero, err
+	}
+
+	ea, err := queryEa(store, path, followReparsePoint, name)
+	if err != nil {
+		return zero, err
+	}
+
+	return DecodeEa(ea, codec)
+}
+
+// SetTyped encodes v with codec and writes it as the EA with name and flags into the file in path,
+// the EA is removed if the encoded value is empty. DefaultStore() is used if store is nil.
+func SetTyped[T any](path string, followReparsePoint bool, store EaStore, name string, flags uint8, v T, codec Codec[T]) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	ea, err := NewCodecEa(name, flags, v, codec)
+	if err != nil {
+		return err
+	}
+
+	return store.EaWriteFile(path, followReparsePoint, ea)
+}
@@ -0,0 +1,124 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testCodec[T any](t *testing.T, codec Codec[T], v T, encoded []byte) {
+	t.Helper()
+
+	b, err := codec.Encode(v)
+	if err != nil {
+		t.Fatalf("Failed to encode %v: %v", v, err)
+	}
+	if encoded != nil && !bytes.Equal(b, encoded) {
+		t.Fatalf("%v encoded into %x, expected %x", v, b, encoded)
+	}
+
+	decoded, err := codec.Decode(b)
+	if err != nil {
+		t.Fatalf("Failed to decode %x: %v", b, err)
+	}
+	if !reflect.DeepEqual(decoded, v) {
+		t.Fatalf("%x decoded into %v, expected %v", b, decoded, v)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	testCodec[string](t, UTF8Codec{}, "héllo", []byte("héllo"))
+	testCodec[string](t, UTF16Codec{}, "Hé", []byte{'H', 0, 0xe9, 0})
+	testCodec[string](t, UTF16Codec{NulTerminated: true}, "Hé", []byte{'H', 0, 0xe9, 0, 0, 0})
+	testCodec[string](t, UTF16Codec{}, "😀", []byte{0x3d, 0xd8, 0x00, 0xde})
+	testCodec[uint32](t, IntCodec[uint32]{}, 0x01020304, []byte{4, 3, 2, 1})
+	testCodec[int16](t, IntCodec[int16]{}, -2, []byte{0xfe, 0xff})
+	testCodec[int64](t, IntCodec[int64]{}, -1, bytes.Repeat([]byte{0xff}, 8))
+	testCodec[uint8](t, IntCodec[uint8]{}, 0xab, []byte{0xab})
+	testCodec[time.Time](t, FiletimeCodec{}, time.Date(1970, 1, 1, 0, 0, 1, 0, time.UTC), []byte{0x80, 0x16, 0xd7, 0xd5, 0xde, 0xb1, 0x9d, 0x01})
+
+	g, err := ParseGUID("{6B29FC40-CA47-1067-B31D-00DD010662DA}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := g.String(); s != "{6B29FC40-CA47-1067-B31D-00DD010662DA}" {
+		t.Fatalf("Unexpected GUID string %s", s)
+	}
+	testCodec[GUID](t, GUIDCodec{}, g, []byte{0x40, 0xfc, 0x29, 0x6b, 0x47, 0xca, 0x67, 0x10, 0xb3, 0x1d, 0x00, 0xdd, 0x01, 0x06, 0x62, 0xda})
+
+	type config struct {
+		Name  string
+		Ports []int
+	}
+	testCodec[config](t, JSONCodec[config]{}, config{"app", []int{80, 443}}, []byte(`{"Name":"app","Ports":[80,443]}`))
+	testCodec[config](t, GobCodec[config]{}, config{"app", []int{80, 443}}, nil)
+}
+
+func TestCodecErrors(t *testing.T) {
+	for name, err := range map[string]error{
+		"utf8":      func() error { _, err := (UTF8Codec{}).Decode([]byte{0xff}); return err }(),
+		"utf16 odd": func() error { _, err := (UTF16Codec{}).Decode([]byte{1}); return err }(),
+		"utf16 nul": func() error { _, err := (UTF16Codec{NulTerminated: true}).Decode([]byte{'a', 0}); return err }(),
+		"int size":  func() error { _, err := (IntCodec[uint32]{}).Decode([]byte{1, 2}); return err }(),
+		"filetime":  func() error { _, err := (FiletimeCodec{}).Decode([]byte{1}); return err }(),
+		"filetime range": func() error {
+			_, err := (FiletimeCodec{}).Encode(time.Date(1600, 1, 1, 0, 0, 0, 0, time.UTC))
+			return err
+		}(),
+		"filetime epoch": func() error {
+			_, err := (FiletimeCodec{}).Encode(time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC))
+			return err
+		}(),
+		"guid": func() error { _, err := (GUIDCodec{}).Decode(make([]byte, 15)); return err }(),
+		"json": func() error { _, err := (JSONCodec[int]{}).Decode([]byte("x")); return err }(),
+		"gob":  func() error { _, err := (GobCodec[int]{}).Decode([]byte("x")); return err }(),
+	} {
+		if !errors.Is(err, ErrCodec) {
+			t.Fatalf("%s: expected ErrCodec, got %v", name, err)
+		}
+	}
+
+	for _, s := range []string{"", "6B29FC40-CA47-1067-B31D-00DD010662D", "6B29FC40CA47-1067-B31D-00DD010662DAA", "{6B29FC40-CA47-1067-B31D-00DD010662DX}"} {
+		if _, err := ParseGUID(s); err == nil {
+			t.Fatalf("Expected error for GUID %q", s)
+		}
+	}
+}
+
+func TestGetSetTyped(t *testing.T) {
+	store := NewMemStore()
+	path := "/file"
+
+	if err := SetTyped(path, false, store, "TITLE", NeedEa, "タイトル", Codec[string](UTF16Codec{NulTerminated: true})); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTyped[uint32](path, false, store, "COUNT", 0, 42, IntCodec[uint32]{}); err != nil {
+		t.Fatal(err)
+	}
+
+	title, err := GetTyped[string](path, false, store, "title", UTF16Codec{NulTerminated: true})
+	if err != nil || title != "タイトル" {
+		t.Fatalf("Unexpected title %q, %v", title, err)
+	}
+
+	eas, _ := store.QueryFileEa(path, false, "TITLE")
+	if eas[0].Flags != NeedEa {
+		t.Fatalf("Unexpected flags 0x%x", eas[0].Flags)
+	}
+
+	if _, err = GetTyped[GUID](path, false, store, "COUNT", GUIDCodec{}); !errors.Is(err, ErrCodec) {
+		t.Fatalf("Expected ErrCodec, got %v", err)
+	}
+	if _, err = GetTyped[uint32](path, false, store, "MISSING", IntCodec[uint32]{}); !errors.Is(err, ErrEaNotFound) {
+		t.Fatalf("Expected ErrEaNotFound, got %v", err)
+	}
+
+	if err = SetTyped[string](path, false, store, "TITLE", 0, "", UTF8Codec{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetTyped[string](path, false, store, "TITLE", UTF8Codec{}); !errors.Is(err, ErrEaNotFound) {
+		t.Fatalf("Expected the EA to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Compressed EA values
+//
+// A value written by the compression layer starts with compressMagic, compressVersion, a byte for Compression and the size of
+// the original value as unsigned varint, followed by the compressed data. Values which do not get smaller are stored with CompressionNone.
+// The magic starts with 0xFF which is neither ASCII nor UTF-8, so text values are never mistaken as compressed, and a value
+// whose header is not valid is returned as is by DecompressEaValue.
+
+// Compression is a method to compress EA values with.
+type Compression uint8
+
+const (
+	CompressionNone    Compression = iota // stored as is after the header
+	CompressionDeflate                    // compress/flate, with the best compression level
+)
+
+const (
+	compressMagic   = "\xffEAZ"
+	compressVersion = 1
+
+	// MaxDecompressedSize limits the size of a decompressed value to prevent decompression bombs.
+	MaxDecompressedSize = 64 << 20
+)
+
+// ErrCompressedValue is returned when a compressed EA value is broken or can not be decompressed.
+var ErrCompressedValue = errors.New("invalid compressed EA value")
+
+// CompressStats reports the size of an EA value before and after compression.
+type CompressStats struct {
+	EaName         string
+	Size           int // size of the original value
+	CompressedSize int // size of the value to be written, including the header
+	Method         Compression
+}
+
+// CompressReport reports the size of a whole EA set before and after compression, to be compared with the 64KB EA budget of a file.
+type CompressReport struct {
+	Entries        []CompressStats
+	SetSize        int // packed size of the original EA set
+	CompressedSize int // packed size of the compressed EA set
+}
+
+func compressHeader(method Compression, size int) []byte {
+	hdr := make([]byte, len(compressMagic)+2+binary.MaxVarintLen64)
+	copy(hdr, compressMagic)
+	hdr[len(compressMagic)] = compressVersion
+	hdr[len(compressMagic)+1] = byte(method)
+	n := binary.PutUvarint(hdr[len(compressMagic)+2:], uint64(size))
+
+	return hdr[:len(compressMagic)+2+n]
+}
+
+// parseCompressHeader returns the method, the size of the original value and the data after the header of value,
+// ok is false if value does not start with a valid header.
+func parseCompressHeader(value []byte) (method Compression, size uint64, data []byte, ok bool) {
+	if !bytes.HasPrefix(value, []byte(compressMagic)) || len(value) < len(compressMagic)+3 || value[len(compressMagic)] != compressVersion {
+		return 0, 0, nil, false
+	}
+
+	method = Compression(value[len(compressMagic)+1])
+	if method != CompressionNone && method != CompressionDeflate {
+		return 0, 0, nil, false
+	}
+
+	size, n := binary.Uvarint(value[len(compressMagic)+2:])
+	if n <= 0 {
+		return 0, 0, nil, false
+	}
+	data = value[len(compressMagic)+2+n:]
+	if method == CompressionNone && uint64(len(data)) != size {
+		return 0, 0, nil, false
+	}
+
+	return method, size, data, true
+}
+
+// CompressEaValue compresses value with method and prepends the header, the value is stored with CompressionNone if it does not get smaller.
+// An empty value stays empty as it means removing the EA.
+func CompressEaValue(value []byte, method Compression) ([]byte, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+
+	var buf bytes.Buffer
+
+	switch method {
+	case CompressionNone:
+	case CompressionDeflate:
+		buf.Write(compressHeader(method, len(value)))
+
+		fw, err := flate.NewWriter(&buf, flate.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = fw.Write(value); err != nil {
+			return nil, err
+		}
+		if err = fw.Close(); err != nil {
+			return nil, err
+		}
+
+		if buf.Len() < len(value) {
+			return buf.Bytes(), nil
+		}
+		buf.Reset()
+	default:
+		return nil, fmt.Errorf("unknown EA compression method %d", method)
+	}
+
+	buf.Write(compressHeader(CompressionNone, len(value)))
+	buf.Write(value)
+
+	return buf.Bytes(), nil
+}
+
+// IsCompressedEaValue reports whether value starts with a valid header of the compression layer.
+func IsCompressedEaValue(value []byte) bool {
+	_, _, _, ok := parseCompressHeader(value)
+
+	return ok
+}
+
+// DecompressEaValue decompresses value written by CompressEaValue, value without a valid header is returned as is.
+// An error is returned if the compressed data after a valid header is broken.
+func DecompressEaValue(value []byte) ([]byte, error) {
+	method, size, data, ok := parseCompressHeader(value)
+	if !ok {
+		return value, nil
+	}
+	if size > MaxDecompressedSize {
+		return nil, fmt.Errorf("%w: size %d in header exceeds %d", ErrCompressedValue, size, MaxDecompressedSize)
+	}
+
+	var r io.Reader
+	switch method {
+	case CompressionNone:
+		r = bytes.NewReader(data)
+	case CompressionDeflate:
+		fr := flate.NewReader(bytes.NewReader(data))
+		defer fr.Close()
+		r = fr
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(size)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCompressedValue, err)
+	}
+	if uint64(len(out)) != size {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrCompressedValue, size, len(out))
+	}
+
+	return out, nil
+}
+
+// CompressEas compresses values of eas with method and reports the size before and after compression.
+func CompressEas(eas []EaInfo, method Compression) ([]EaInfo, *CompressReport, error) {
+	report := &CompressReport{}
+	compressed := make([]EaInfo, len(eas))
+
+	for i, ea := range eas {
+		value, err := CompressEaValue(ea.EaValue, method)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		stats := CompressStats{
+			EaName:         ea.EaName,
+			Size:           len(ea.EaValue),
+			CompressedSize: len(value),
+		}
+		if len(value) != 0 {
+			stats.Method = Compression(value[len(compressMagic)+1])
+		}
+		report.Entries = append(report.Entries, stats)
+
+		compressed[i] = EaInfo{Flags: ea.Flags, EaName: ea.EaName, EaValue: value}
+	}
+
+	var err error
+	if report.SetSize, err = eaSetSize(eas); err != nil {
+		return nil, nil, err
+	}
+	if report.CompressedSize, err = eaSetSize(compressed); err != nil {
+		return nil, nil, err
+	}
+
+	return compressed, report, nil
+}
+
+// DecompressEas decompresses values of eas which were written by the compression layer, other values are kept as is.
+func DecompressEas(eas []EaInfo) ([]EaInfo, error) {
+	decompressed := make([]EaInfo, len(eas))
+
+	for i, ea := range eas {
+		value, err := DecompressEaValue(ea.EaValue)
+		if err != nil {
+			return nil, fmt.Errorf("EA %s: %w", ea.EaName, err)
+		}
+
+		decompressed[i] = EaInfo{Flags: ea.Flags, EaName: ea.EaName, EaValue: value}
+	}
+
+	return decompressed, nil
+}
+
+// CompressedStore is an EA store which compresses values on write and decompresses them on query with the wrapped store.
+// Values written without the layer are returned as is, unless they happen to start with a valid header of the layer.
+type CompressedStore struct {
+	Store EaStore // DefaultStore() if nil
+
+	// Method compresses values on write. The zero value CompressionNone writes values as they are without the header,
+	// so they can be read without the layer, while compressed values are still decompressed on query.
+	Method Compression
+
+	// OnCompress is called with the sizes of each EA set written, for budgeting against the 64KB limit.
+	OnCompress func(path string, report *CompressReport)
+}
+
+func (s *CompressedStore) QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]EaInfo, error) {
+	store, err := storeOrDefault(s.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	eas, err := store.QueryFileEa(path, followReparsePoint, queryName...)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecompressEas(eas)
+}
+
+func (s *CompressedStore) EaWriteFile(dstPath string, followReparsePoint bool, eaInfo ...EaInfo) error {
+	store, err := storeOrDefault(s.Store)
+	if err != nil {
+		return err
+	}
+
+	compressed, report := eaInfo, &CompressReport{}
+	if s.Method == CompressionNone {
+		for _, ea := range eaInfo {
+			report.Entries = append(report.Entries, CompressStats{EaName: ea.EaName, Size: len(ea.EaValue), CompressedSize: len(ea.EaValue)})
+		}
+		if report.SetSize, err = eaSetSize(eaInfo); err != nil {
+			return err
+		}
+		report.CompressedSize = report.SetSize
+	} else if compressed, report, err = CompressEas(eaInfo, s.Method); err != nil {
+		return err
+	}
+
+	if s.OnCompress != nil {
+		s.OnCompress(dstPath, report)
+	}
+
+	return store.EaWriteFile(dstPath, followReparsePoint, compressed...)
+}
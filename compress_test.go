@@ -0,0 +1,109 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressedStore(t *testing.T) {
+	root := createTestTree(t, "manifest.txt")
+	target := filepath.Join(root, "manifest.txt")
+	mem := NewMemStore()
+
+	var report *CompressReport
+	store := &CompressedStore{
+		Store:  mem,
+		Method: CompressionDeflate,
+		OnCompress: func(path string, r *CompressReport) {
+			report = r
+		},
+	}
+
+	manifest := bytes.Repeat([]byte(`{"name":"component","version":"1.0.0","hash":"0123456789abcdef"},`), 2000)
+
+	err := store.EaWriteFile(target, false,
+		EaInfo{EaName: "MANIFEST", EaValue: manifest},
+		EaInfo{EaName: "SHORT", EaValue: []byte("x")},
+	)
+	if err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+
+	if report == nil || report.SetSize <= maxEaSetSize || report.CompressedSize >= maxEaSetSize {
+		t.Fatalf("Unexpected compression report: %+v", report)
+	}
+	if report.Entries[1].Method != CompressionNone {
+		t.Fatalf("Expected short value to be stored without compression, got %+v", report.Entries[1])
+	}
+
+	raw, _ := mem.QueryFileEa(target, false, "MANIFEST")
+	if !IsCompressedEaValue(raw[0].EaValue) || len(raw[0].EaValue) >= len(manifest) {
+		t.Fatalf("Expected compressed value in the wrapped store")
+	}
+
+	eas, err := store.QueryFileEa(target, false)
+	if err != nil {
+		t.Fatalf("QueryFileEa failed: %v", err)
+	}
+	if len(eas) != 2 || !bytes.Equal(eas[0].EaValue, manifest) || string(eas[1].EaValue) != "x" {
+		t.Fatalf("EA data mismatch after decompression")
+	}
+
+	// values written without the layer are kept byte-exact
+	if err = mem.EaWriteFile(target, false, EaInfo{EaName: "PLAIN", EaValue: []byte("plain value")}); err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+	eas, _ = store.QueryFileEa(target, false, "PLAIN")
+	if string(eas[0].EaValue) != "plain value" {
+		t.Fatalf("Plain EA mismatch: %q", eas[0].EaValue)
+	}
+
+	// values which only look like the header are kept as well
+	for _, v := range []string{"EAZ\x00\x05hello", "EAZY value", "\xffEAZ", "\xffEAZ\x02\x00\x01a", "\xffEAZ\x01\x07\x01a", "\xffEAZ\x01\x00\x05a"} {
+		if err = mem.EaWriteFile(target, false, EaInfo{EaName: "PLAIN", EaValue: []byte(v)}); err != nil {
+			t.Fatalf("EaWriteFile failed: %v", err)
+		}
+		eas, err = store.QueryFileEa(target, false)
+		if err != nil {
+			t.Fatalf("QueryFileEa failed for %q: %v", v, err)
+		}
+		if plain := eas[len(eas)-1]; plain.EaName != "PLAIN" || string(plain.EaValue) != v {
+			t.Fatalf("Plain EA mismatch: %q, expected %q", plain.EaValue, v)
+		}
+	}
+}
+
+func TestDecompressEaValueErrors(t *testing.T) {
+	value, err := CompressEaValue(bytes.Repeat([]byte("a"), 1000), CompressionDeflate)
+	if err != nil {
+		t.Fatalf("CompressEaValue failed: %v", err)
+	}
+
+	if _, err = DecompressEaValue(value[:len(value)-2]); !errors.Is(err, ErrCompressedValue) {
+		t.Fatalf("Expected ErrCompressedValue for truncated value, got %v", err)
+	}
+
+	bomb := append(compressHeader(CompressionDeflate, MaxDecompressedSize+1), value[len(compressHeader(CompressionDeflate, 1000)):]...)
+	if _, err = DecompressEaValue(bomb); !errors.Is(err, ErrCompressedValue) {
+		t.Fatalf("Expected ErrCompressedValue for oversized value, got %v", err)
+	}
+}
+
+func TestCompressedStoreZeroMethod(t *testing.T) {
+	root := createTestTree(t, "a.txt")
+	target := filepath.Join(root, "a.txt")
+	mem := NewMemStore()
+	store := &CompressedStore{Store: mem}
+
+	if err := store.EaWriteFile(target, false, EaInfo{EaName: "PLAIN", EaValue: []byte("plain value")}); err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+
+	// the value is passed through without the header
+	raw, _ := mem.QueryFileEa(target, false, "PLAIN")
+	if len(raw) != 1 || string(raw[0].EaValue) != "plain value" {
+		t.Fatalf("Expected the value as is in the wrapped store, got %v", raw)
+	}
+}
@@ -0,0 +1,73 @@
+package ntfs_ea
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Cygwin and MSYS2 expose EAs of NTFS files to POSIX programs as extended attributes in the "user." namespace.
+// getxattr and setxattr strip the "user." prefix to get the EA name, and listxattr returns EA names, which NTFS keeps
+// in upper case, in lower case with the prefix, e.g. EA "APPVERSION" is listed as "user.appversion".
+
+// CygwinXattrPrefix is the only extended attribute namespace Cygwin maps to EAs.
+const CygwinXattrPrefix = "user."
+
+// CygwinXattrToEaName returns the EA name for the Cygwin extended attribute name, in upper case as QueryFileEa returns it.
+func CygwinXattrToEaName(xattr string) (string, error) {
+	if !strings.HasPrefix(xattr, CygwinXattrPrefix) {
+		return "", fmt.Errorf("extended attribute %q is not in the %s namespace, Cygwin does not map it to EA", xattr, CygwinXattrPrefix)
+	}
+
+	name := xattr[len(CygwinXattrPrefix):]
+	if err := ValidateEaName(name); err != nil {
+		return "", err
+	}
+
+	return eaNameKey(name), nil
+}
+
+// EaNameToCygwinXattr returns the extended attribute name Cygwin lists for the EA name.
+func EaNameToCygwinXattr(name string) string {
+	return CygwinXattrPrefix + strings.ToLower(name)
+}
+
+// EasToCygwinXattrs returns eas as Cygwin extended attributes. Flags of EAs are not kept as Cygwin does not expose them.
+func EasToCygwinXattrs(eas []EaInfo) map[string][]byte {
+	xattrs := make(map[string][]byte, len(eas))
+	for _, ea := range eas {
+		if len(ea.EaValue) != 0 {
+			xattrs[EaNameToCygwinXattr(ea.EaName)] = ea.EaValue
+		}
+	}
+
+	return xattrs
+}
+
+// CygwinXattrsToEas returns Cygwin extended attributes as EAs sorted by name, extended attributes with the same name
+// in different case are refused since they map to the same EA.
+func CygwinXattrsToEas(xattrs map[string][]byte) ([]EaInfo, error) {
+	xattrNames := make([]string, 0, len(xattrs))
+	for xattr := range xattrs {
+		xattrNames = append(xattrNames, xattr)
+	}
+	sort.Strings(xattrNames)
+
+	seen := make(map[string]string, len(xattrs))
+	eas := make([]EaInfo, 0, len(xattrs))
+
+	for _, xattr := range xattrNames {
+		name, err := CygwinXattrToEaName(xattr)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := seen[name]; ok {
+			return nil, fmt.Errorf("extended attributes %q and %q map to the same EA %s", prev, xattr, name)
+		}
+		seen[name] = xattr
+
+		eas = append(eas, EaInfo{EaName: name, EaValue: xattrs[xattr]})
+	}
+
+	return eas, nil
+}
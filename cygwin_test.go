@@ -0,0 +1,66 @@
+package ntfs_ea
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCygwinXattrNames(t *testing.T) {
+	for _, tc := range []struct {
+		xattr  string
+		eaName string
+	}{
+		{"user.appversion", "APPVERSION"},
+		{"user.AppVersion", "APPVERSION"},
+		{"user..longname", ".LONGNAME"},
+		{"user.$lxuid", "$LXUID"},
+		{"user.user.nested", "USER.NESTED"},
+	} {
+		name, err := CygwinXattrToEaName(tc.xattr)
+		if err != nil || name != tc.eaName {
+			t.Fatalf("%q mapped to %q(%v), expected %q", tc.xattr, name, err, tc.eaName)
+		}
+	}
+
+	for _, xattr := range []string{"trusted.foo", "security.selinux", "user.", "user.a*b", "user.a/b", "user.tab\tname"} {
+		if _, err := CygwinXattrToEaName(xattr); err == nil {
+			t.Fatalf("Expected error for %q", xattr)
+		}
+	}
+
+	for _, tc := range []struct {
+		eaName string
+		xattr  string
+	}{
+		{"APPVERSION", "user.appversion"},
+		{".LONGNAME", "user..longname"},
+		{"$LXUID", "user.$lxuid"},
+	} {
+		if xattr := EaNameToCygwinXattr(tc.eaName); xattr != tc.xattr {
+			t.Fatalf("%q mapped to %q, expected %q", tc.eaName, xattr, tc.xattr)
+		}
+	}
+}
+
+func TestCygwinXattrs(t *testing.T) {
+	eas := []EaInfo{
+		{EaName: "APPVERSION", EaValue: []byte("1.0")},
+		{EaName: "EMPTY"},
+		{Flags: NeedEa, EaName: "REQUIRED", EaValue: []byte("x")},
+	}
+
+	xattrs := EasToCygwinXattrs(eas)
+	expected := map[string][]byte{"user.appversion": []byte("1.0"), "user.required": []byte("x")}
+	if !reflect.DeepEqual(xattrs, expected) {
+		t.Fatalf("Unexpected xattrs: %q", xattrs)
+	}
+
+	back, err := CygwinXattrsToEas(xattrs)
+	if err != nil || len(back) != 2 || back[0].EaName != "APPVERSION" || back[1].EaName != "REQUIRED" {
+		t.Fatalf("Unexpected EAs: %v, %v", back, err)
+	}
+
+	if _, err = CygwinXattrsToEas(map[string][]byte{"user.a": nil, "user.A": nil}); err == nil {
+		t.Fatalf("Expected error for names differing only in case")
+	}
+}
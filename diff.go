@@ -0,0 +1,296 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EaChange describes the difference of an EA with the same name in two EA sets, Old or New is nil if the EA was added or removed.
+type EaChange struct {
+	Name string
+	Old  *EaInfo
+	New  *EaInfo
+}
+
+type eaChangeJSON struct {
+	Name     string `json:"name"`
+	OldFlags *uint8 `json:"oldFlags,omitempty"`
+	NewFlags *uint8 `json:"newFlags,omitempty"`
+	OldValue string `json:"oldValue,omitempty"` // hex
+	NewValue string `json:"newValue,omitempty"` // hex
+}
+
+// MarshalJSON encodes the change with flags as numbers and values as hex strings.
+func (c EaChange) MarshalJSON() ([]byte, error) {
+	j := eaChangeJSON{Name: c.Name}
+	if c.Old != nil {
+		j.OldFlags = &c.Old.Flags
+		j.OldValue = hex.EncodeToString(c.Old.EaValue)
+	}
+	if c.New != nil {
+		j.NewFlags = &c.New.Flags
+		j.NewValue = hex.EncodeToString(c.New.EaValue)
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes the change encoded by MarshalJSON.
+func (c *EaChange) UnmarshalJSON(data []byte) error {
+	var j eaChangeJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	decode := func(flags *uint8, value string) (*EaInfo, error) {
+		if flags == nil {
+			return nil, nil
+		}
+
+		v, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &EaInfo{Flags: *flags, EaName: j.Name, EaValue: v}, nil
+	}
+
+	var err error
+	c.Name = j.Name
+	if c.Old, err = decode(j.OldFlags, j.OldValue); err != nil {
+		return err
+	}
+	c.New, err = decode(j.NewFlags, j.NewValue)
+
+	return err
+}
+
+// EaDiff is the difference between two EA sets, names are compared case-insensitively as NTFS does.
+// A change of both flags and value is reported in Changed, FlagsChanged only has EAs whose value is the same.
+type EaDiff struct {
+	Added        []EaChange `json:"added,omitempty"`
+	Removed      []EaChange `json:"removed,omitempty"`
+	Changed      []EaChange `json:"changed,omitempty"`
+	FlagsChanged []EaChange `json:"flagsChanged,omitempty"`
+}
+
+// Empty reports whether the two EA sets are the same.
+func (d *EaDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.FlagsChanged) == 0
+}
+
+// String returns the diff in the text form of WriteText.
+func (d *EaDiff) String() string {
+	var sb strings.Builder
+	d.WriteText(&sb)
+
+	return sb.String()
+}
+
+// WriteText writes the diff in a line based text form, "+" for added, "-" for removed, "~" for changed flags and "*" for changed values followed by a hex diff.
+func (d *EaDiff) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+
+	for _, c := range d.Added {
+		fmt.Fprintf(&buf, "+ %s (flags 0x%x, %d bytes)\n", c.Name, c.New.Flags, len(c.New.EaValue))
+	}
+	for _, c := range d.Removed {
+		fmt.Fprintf(&buf, "- %s (flags 0x%x, %d bytes)\n", c.Name, c.Old.Flags, len(c.Old.EaValue))
+	}
+	for _, c := range d.FlagsChanged {
+		fmt.Fprintf(&buf, "~ %s flags 0x%x -> 0x%x\n", c.Name, c.Old.Flags, c.New.Flags)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&buf, "* %s", c.Name)
+		if c.Old.Flags != c.New.Flags {
+			fmt.Fprintf(&buf, " flags 0x%x -> 0x%x,", c.Old.Flags, c.New.Flags)
+		}
+		fmt.Fprintf(&buf, " %d -> %d bytes\n", len(c.Old.EaValue), len(c.New.EaValue))
+		writeHexDiff(&buf, c.Old.EaValue, c.New.EaValue)
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// writeHexDiff writes hex dump of both values by 16 bytes rows, rows that are the same are written once.
+func writeHexDiff(w io.Writer, oldValue, newValue []byte) {
+	oldRows := hexDumpRows(oldValue)
+	newRows := hexDumpRows(newValue)
+
+	for i := 0; i < len(oldRows) || i < len(newRows); i++ {
+		var oldRow, newRow string
+		if i < len(oldRows) {
+			oldRow = oldRows[i]
+		}
+		if i < len(newRows) {
+			newRow = newRows[i]
+		}
+
+		if oldRow == newRow {
+			fmt.Fprintf(w, "    %s\n", oldRow)
+			continue
+		}
+		if oldRow != "" {
+			fmt.Fprintf(w, "  - %s\n", oldRow)
+		}
+		if newRow != "" {
+			fmt.Fprintf(w, "  + %s\n", newRow)
+		}
+	}
+}
+
+func hexDumpRows(value []byte) []string {
+	return strings.Split(strings.TrimSuffix(hex.Dump(value), "\n"), "\n")
+}
+
+// DiffEas compares two EA sets and reports added, removed and changed EAs in the order of the EA sets.
+func DiffEas(oldEas, newEas []EaInfo) *EaDiff {
+	d := &EaDiff{}
+
+	oldByName := make(map[string]*EaInfo, len(oldEas))
+	for i := range oldEas {
+		oldByName[eaNameKey(oldEas[i].EaName)] = &oldEas[i]
+	}
+	newByName := make(map[string]*EaInfo, len(newEas))
+	for i := range newEas {
+		newByName[eaNameKey(newEas[i].EaName)] = &newEas[i]
+	}
+
+	for i := range oldEas {
+		oldEa := &oldEas[i]
+		newEa, ok := newByName[eaNameKey(oldEa.EaName)]
+		switch {
+		case !ok:
+			d.Removed = append(d.Removed, EaChange{Name: oldEa.EaName, Old: oldEa})
+		case !bytes.Equal(oldEa.EaValue, newEa.EaValue):
+			d.Changed = append(d.Changed, EaChange{Name: oldEa.EaName, Old: oldEa, New: newEa})
+		case oldEa.Flags != newEa.Flags:
+			d.FlagsChanged = append(d.FlagsChanged, EaChange{Name: oldEa.EaName, Old: oldEa, New: newEa})
+		}
+	}
+
+	for i := range newEas {
+		if _, ok := oldByName[eaNameKey(newEas[i].EaName)]; !ok {
+			d.Added = append(d.Added, EaChange{Name: newEas[i].EaName, New: &newEas[i]})
+		}
+	}
+
+	return d
+}
+
+// DiffFiles compares EA sets of two files with store, DefaultStore() is used if store is nil.
+func DiffFiles(oldPath, newPath string, followReparsePoint bool, store EaStore) (*EaDiff, error) {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return nil, err
+	}
+
+	oldEas, err := store.QueryFileEa(oldPath, followReparsePoint)
+	if err != nil {
+		return nil, err
+	}
+
+	newEas, err := store.QueryFileEa(newPath, followReparsePoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffEas(oldEas, newEas), nil
+}
+
+// PathDiff is the difference of EA sets for a path in DiffEaSets and DiffTrees.
+type PathDiff struct {
+	Path string `json:"path"`
+	EaDiff
+}
+
+// DiffEaSets compares EA sets keyed by path, e.g. from trees, snapshots or exported dumps, and returns differences of paths sorted by path.
+// A path which only exists in one of them is compared with an empty EA set.
+func DiffEaSets(oldSets, newSets map[string][]EaInfo) []PathDiff {
+	paths := make(map[string]struct{}, len(oldSets)+len(newSets))
+	for path := range oldSets {
+		paths[path] = struct{}{}
+	}
+	for path := range newSets {
+		paths[path] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var diffs []PathDiff
+	for _, path := range sorted {
+		d := DiffEas(oldSets[path], newSets[path])
+		if !d.Empty() {
+			diffs = append(diffs, PathDiff{Path: path, EaDiff: *d})
+		}
+	}
+
+	return diffs
+}
+
+// CollectEaSets walks the tree rooted at root with WalkEas and returns EA sets of paths which have EAs, keyed by slash separated path relative to root.
+func CollectEaSets(root string, opts *WalkOptions) (map[string][]EaInfo, error) {
+	var mu sync.Mutex
+	sets := make(map[string][]EaInfo)
+
+	err := WalkEas(root, func(path string, eas []EaInfo) error {
+		if len(eas) == 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		sets[filepath.ToSlash(rel)] = eas
+		mu.Unlock()
+
+		return nil
+	}, opts)
+
+	return sets, err
+}
+
+// DiffTrees compares EA sets of paths with the same relative path in two trees, e.g. a reference install and an actual install.
+func DiffTrees(oldRoot, newRoot string, opts *WalkOptions) ([]PathDiff, error) {
+	oldSets, err := CollectEaSets(oldRoot, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	newSets, err := CollectEaSets(newRoot, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffEaSets(oldSets, newSets), nil
+}
+
+// WriteDiffText writes diffs of paths with EaDiff.WriteText, each preceded by the path.
+func WriteDiffText(w io.Writer, diffs []PathDiff) error {
+	for _, d := range diffs {
+		if _, err := fmt.Fprintf(w, "%s:\n", d.Path); err != nil {
+			return err
+		}
+		if err := d.WriteText(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
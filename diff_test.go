@@ -0,0 +1,86 @@
+package ntfs_ea
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffEas(t *testing.T) {
+	oldEas := []EaInfo{
+		{EaName: "KEPT", EaValue: []byte("same")},
+		{EaName: "REMOVED", EaValue: []byte("gone")},
+		{EaName: "FLAGS", EaValue: []byte("flag only")},
+		{EaName: "VALUE", EaValue: []byte("old value")},
+	}
+	newEas := []EaInfo{
+		{EaName: "kept", EaValue: []byte("same")},
+		{Flags: NeedEa, EaName: "flags", EaValue: []byte("flag only")},
+		{EaName: "Value", EaValue: []byte("new value")},
+		{EaName: "ADDED", EaValue: []byte("new")},
+	}
+
+	d := DiffEas(oldEas, newEas)
+	if len(d.Added) != 1 || d.Added[0].Name != "ADDED" {
+		t.Fatalf("Unexpected added: %v", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Name != "REMOVED" {
+		t.Fatalf("Unexpected removed: %v", d.Removed)
+	}
+	if len(d.FlagsChanged) != 1 || d.FlagsChanged[0].Name != "FLAGS" {
+		t.Fatalf("Unexpected flags changed: %v", d.FlagsChanged)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Name != "VALUE" {
+		t.Fatalf("Unexpected changed: %v", d.Changed)
+	}
+
+	text := d.String()
+	for _, line := range []string{"+ ADDED", "- REMOVED", "~ FLAGS flags 0x0 -> 0x80", "* VALUE 9 -> 9 bytes", "  - 00000000  6f 6c 64", "  + 00000000  6e 65 77"} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("Expected %q in diff text:\n%s", line, text)
+		}
+	}
+
+	buf, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Failed to marshal diff: %v", err)
+	}
+
+	var decoded EaDiff
+	if err = json.Unmarshal(buf, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal diff: %v", err)
+	}
+	if decoded.String() != text {
+		t.Fatalf("Diff mismatch after JSON round trip:\n%s\nexpected:\n%s", decoded.String(), text)
+	}
+
+	if !DiffEas(oldEas, oldEas).Empty() {
+		t.Fatalf("Expected empty diff for the same EA set")
+	}
+}
+
+func TestDiffTrees(t *testing.T) {
+	oldRoot := createTestTree(t, "a.txt", "sub/b.txt")
+	newRoot := createTestTree(t, "a.txt", "sub/b.txt")
+	store := NewMemStore()
+
+	write := func(path string, ea EaInfo) {
+		if err := store.EaWriteFile(path, false, ea); err != nil {
+			t.Fatalf("EaWriteFile failed: %v", err)
+		}
+	}
+
+	write(filepath.Join(oldRoot, "a.txt"), EaInfo{EaName: "SAME", EaValue: []byte("value")})
+	write(filepath.Join(newRoot, "a.txt"), EaInfo{EaName: "SAME", EaValue: []byte("value")})
+	write(filepath.Join(newRoot, "sub", "b.txt"), EaInfo{EaName: "NEW", EaValue: []byte("value")})
+
+	diffs, err := DiffTrees(oldRoot, newRoot, &WalkOptions{Store: store})
+	if err != nil {
+		t.Fatalf("DiffTrees failed: %v", err)
+	}
+
+	if len(diffs) != 1 || diffs[0].Path != "sub/b.txt" || len(diffs[0].Added) != 1 {
+		t.Fatalf("Unexpected diffs: %v", diffs)
+	}
+}
@@ -0,0 +1,553 @@
+package ntfs_ea
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nyaosorg/go-windows-mbcs"
+)
+
+// EA export format
+//
+// EA sets keyed by path are exported as a document of the same structure in JSON and CBOR:
+//
+//	{
+//	  "version": 1,
+//	  "files": [
+//	    {
+//	      "path": "dir/file.txt",
+//	      "size": 24,
+//	      "eas": [
+//	        {"name": "APPVERSION", "nameBytes": "QVBQVkVSU0lPTg==", "flags": 0, "encoding": "utf8", "value": "1.0"}
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// Files are sorted by path and EAs are kept in the given order. "nameBytes" is the name in the active code page as stored in
+// FILE_FULL_EA_INFORMATION, base64 in JSON, and "size" is the size of the packed FILE_FULL_EA_INFORMATION buffer.
+// "value" is a string in "encoding", except that CBOR has values other than utf8 as byte strings.
+// CBOR is written in the deterministic encoding of RFC 8949, so the same EA sets are always exported into the same bytes.
+
+// EaExportVersion is the version of the export format written by this package.
+const EaExportVersion = 1
+
+// ErrEaExport is returned when an exported document is malformed or has EA sets which can not be written.
+var ErrEaExport = errors.New("invalid EA export")
+
+// ValueEncoding is the encoding of EA values in exported documents.
+type ValueEncoding string
+
+const (
+	ValueAuto   ValueEncoding = ""       // utf8 for valid UTF-8, base64 otherwise
+	ValueUTF8   ValueEncoding = "utf8"   // the value as a string, only for valid UTF-8
+	ValueBase64 ValueEncoding = "base64" // standard base64 with padding
+	ValueHex    ValueEncoding = "hex"    // lower case hex
+)
+
+// ExportOptions configures MarshalEaSetsJSON and MarshalEaSetsCBOR.
+type ExportOptions struct {
+	Encoding ValueEncoding
+}
+
+type exportedEa struct {
+	Name      string        `json:"name"`
+	NameBytes []byte        `json:"nameBytes,omitempty"`
+	Flags     uint8         `json:"flags"`
+	Encoding  ValueEncoding `json:"encoding"`
+	Value     string        `json:"value"`
+
+	raw []byte // value decoded from Value, or a byte string of CBOR
+}
+
+type exportedSet struct {
+	Path string       `json:"path"`
+	Size *int         `json:"size,omitempty"`
+	Eas  []exportedEa `json:"eas"`
+}
+
+type eaExport struct {
+	Version int           `json:"version"`
+	Files   []exportedSet `json:"files"`
+}
+
+// ValidateEaSet checks that eas can be written into a file at once: names are valid without duplicates and the packed set is within 64KB.
+func ValidateEaSet(eas []EaInfo) error {
+	seen := make(map[string]struct{}, len(eas))
+	for _, ea := range eas {
+		if err := ValidateEaName(ea.EaName); err != nil {
+			return err
+		}
+		if _, ok := seen[eaNameKey(ea.EaName)]; ok {
+			return fmt.Errorf("EA %s appears more than once", eaNameKey(ea.EaName))
+		}
+		seen[eaNameKey(ea.EaName)] = struct{}{}
+	}
+
+	size, err := eaSetSize(eas)
+	if err != nil {
+		return err
+	}
+	if size > maxEaSetSize {
+		return fmt.Errorf("EA set of %d bytes exceeds %d bytes", size, maxEaSetSize)
+	}
+
+	return nil
+}
+
+// validateSetPath checks that the path of an EA set stays under the root it is relative to: it is not absolute, has no volume name
+// and does not start with "..". Backslashes are taken as separators, as they are on Windows.
+func validateSetPath(p string) error {
+	slashed := strings.ReplaceAll(p, "\\", "/")
+	if p == "" || path.IsAbs(slashed) || filepath.IsAbs(p) || filepath.VolumeName(p) != "" || (len(p) >= 2 && p[1] == ':') {
+		return fmt.Errorf("path %q is not relative", p)
+	}
+	if c := path.Clean(slashed); c == ".." || strings.HasPrefix(c, "../") {
+		return fmt.Errorf("path %q is outside of the root", p)
+	}
+
+	return nil
+}
+
+// checkSetTarget refuses the path p of an EA set under root if an existing element of it is a symbolic link or another reparse point,
+// so EAs can not be written outside of root through a link inside of it. The last element is only checked if followReparsePoint is set,
+// otherwise the EAs are written into the link itself.
+func checkSetTarget(root, p string, followReparsePoint bool) error {
+	elems := strings.Split(filepath.Clean(filepath.FromSlash(p)), string(filepath.Separator))
+	if !followReparsePoint {
+		elems = elems[:len(elems)-1]
+	}
+
+	cur := root
+	for _, elem := range elems {
+		cur = filepath.Join(cur, elem)
+
+		fi, err := os.Lstat(cur)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if isReparsePoint(fs.FileInfoToDirEntry(fi)) {
+			return fmt.Errorf("path %q is through a symbolic link or reparse point %s", p, cur)
+		}
+	}
+
+	return nil
+}
+
+func newEaExport(sets map[string][]EaInfo, opts *ExportOptions) (*eaExport, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+
+	paths := make([]string, 0, len(sets))
+	for path := range sets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	doc := &eaExport{Version: EaExportVersion, Files: make([]exportedSet, 0, len(paths))}
+
+	for _, path := range paths {
+		var eas []EaInfo
+		for _, ea := range sets[path] {
+			if len(ea.EaValue) != 0 {
+				eas = append(eas, ea)
+			}
+		}
+
+		if err := ValidateEaSet(eas); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		size, _ := eaSetSize(eas)
+
+		set := exportedSet{Path: path, Size: &size, Eas: make([]exportedEa, 0, len(eas))}
+		for _, ea := range eas {
+			e, err := newExportedEa(ea, opts.Encoding)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			set.Eas = append(set.Eas, e)
+		}
+
+		doc.Files = append(doc.Files, set)
+	}
+
+	return doc, nil
+}
+
+func newExportedEa(ea EaInfo, encoding ValueEncoding) (exportedEa, error) {
+	nameBytes, err := mbcs.Utf8ToAnsi(ea.EaName, 0)
+	if err != nil {
+		return exportedEa{}, err
+	}
+
+	if encoding == ValueAuto {
+		encoding = ValueBase64
+		if utf8.Valid(ea.EaValue) {
+			encoding = ValueUTF8
+		}
+	}
+
+	e := exportedEa{Name: ea.EaName, NameBytes: nameBytes, Flags: ea.Flags, Encoding: encoding, raw: ea.EaValue}
+
+	switch encoding {
+	case ValueUTF8:
+		if !utf8.Valid(ea.EaValue) {
+			return e, fmt.Errorf("value of EA %s is not valid UTF-8", ea.EaName)
+		}
+		e.Value = string(ea.EaValue)
+	case ValueBase64:
+		e.Value = base64.StdEncoding.EncodeToString(ea.EaValue)
+	case ValueHex:
+		e.Value = hex.EncodeToString(ea.EaValue)
+	default:
+		return e, fmt.Errorf("unknown value encoding %q", string(encoding))
+	}
+
+	return e, nil
+}
+
+// eaSets validates doc and returns its EA sets.
+func (doc *eaExport) eaSets() (map[string][]EaInfo, error) {
+	if doc.Version != EaExportVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrEaExport, doc.Version)
+	}
+
+	sets := make(map[string][]EaInfo, len(doc.Files))
+
+	for _, set := range doc.Files {
+		if _, ok := sets[set.Path]; ok {
+			return nil, fmt.Errorf("%w: path %q appears more than once", ErrEaExport, set.Path)
+		}
+		if err := validateSetPath(set.Path); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEaExport, err)
+		}
+
+		eas, err := set.eaInfos()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrEaExport, set.Path, err)
+		}
+		sets[set.Path] = eas
+	}
+
+	return sets, nil
+}
+
+func (set *exportedSet) eaInfos() ([]EaInfo, error) {
+	eas := make([]EaInfo, 0, len(set.Eas))
+	size := 0
+
+	for _, e := range set.Eas {
+		ea, nameLen, err := e.eaInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		eas = append(eas, ea)
+		size += eaEntrySize(nameLen, len(ea.EaValue))
+	}
+
+	// the size is checked with names as exported, the active code page of the exporter may differ
+	if set.Size != nil && *set.Size != size {
+		return nil, fmt.Errorf("packed size should be %d, got %d", size, *set.Size)
+	}
+
+	if err := ValidateEaSet(eas); err != nil {
+		return nil, err
+	}
+
+	return eas, nil
+}
+
+// eaInfo returns the EA and the length of its name as exported.
+func (e *exportedEa) eaInfo() (EaInfo, int, error) {
+	ea := EaInfo{Flags: e.Flags, EaName: e.Name}
+
+	if ea.EaName == "" && len(e.NameBytes) != 0 {
+		name, err := mbcs.AnsiToUtf8(e.NameBytes, 0)
+		if err != nil {
+			return ea, 0, fmt.Errorf("name %x can not be converted from the active code page: %w", e.NameBytes, err)
+		}
+		ea.EaName = name
+	}
+
+	nameLen := len(e.NameBytes)
+	if nameLen == 0 {
+		nameBytes, err := mbcs.Utf8ToAnsi(ea.EaName, 0)
+		if err != nil {
+			return ea, 0, fmt.Errorf("EA name %q can not be converted to the active code page: %w", ea.EaName, err)
+		}
+		nameLen = len(nameBytes)
+	}
+
+	var err error
+	switch {
+	case e.raw != nil:
+		ea.EaValue = e.raw
+	case e.Encoding == ValueUTF8:
+		ea.EaValue = []byte(e.Value)
+	case e.Encoding == ValueBase64:
+		ea.EaValue, err = base64.StdEncoding.DecodeString(e.Value)
+	case e.Encoding == ValueHex:
+		ea.EaValue, err = hex.DecodeString(e.Value)
+	default:
+		return ea, 0, fmt.Errorf("unknown value encoding %q of EA %s", string(e.Encoding), ea.EaName)
+	}
+	if err != nil {
+		return ea, 0, fmt.Errorf("invalid %s value of EA %s: %w", e.Encoding, ea.EaName, err)
+	}
+	if len(ea.EaValue) == 0 {
+		return ea, 0, fmt.Errorf("EA %s has empty value", ea.EaName)
+	}
+
+	return ea, nameLen, nil
+}
+
+// MarshalEaSetsJSON exports EA sets keyed by path as JSON, EAs with empty value are skipped.
+func MarshalEaSetsJSON(sets map[string][]EaInfo, opts *ExportOptions) ([]byte, error) {
+	doc, err := newEaExport(sets, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// UnmarshalEaSetsJSON imports EA sets exported by MarshalEaSetsJSON, every set is validated with ValidateEaSet.
+func UnmarshalEaSetsJSON(data []byte) (map[string][]EaInfo, error) {
+	var doc eaExport
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEaExport, err)
+	}
+
+	return doc.eaSets()
+}
+
+// MarshalEaSetsCBOR exports EA sets keyed by path as CBOR, EAs with empty value are skipped.
+func MarshalEaSetsCBOR(sets map[string][]EaInfo, opts *ExportOptions) ([]byte, error) {
+	doc, err := newEaExport(sets, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	files := appendCBORHead(nil, cborArray, uint64(len(doc.Files)))
+	for _, set := range doc.Files {
+		eas := appendCBORHead(nil, cborArray, uint64(len(set.Eas)))
+		for _, e := range set.Eas {
+			value := appendCBORText(nil, e.Value)
+			if e.Encoding != ValueUTF8 {
+				value = appendCBORBytes(nil, e.raw)
+			}
+
+			eas = appendCBORMap(eas, map[string][]byte{
+				"name":      appendCBORText(nil, e.Name),
+				"nameBytes": appendCBORBytes(nil, e.NameBytes),
+				"flags":     appendCBORUint(nil, uint64(e.Flags)),
+				"encoding":  appendCBORText(nil, string(e.Encoding)),
+				"value":     value,
+			})
+		}
+
+		files = appendCBORMap(files, map[string][]byte{
+			"path": appendCBORText(nil, set.Path),
+			"size": appendCBORUint(nil, uint64(*set.Size)),
+			"eas":  eas,
+		})
+	}
+
+	return appendCBORMap(nil, map[string][]byte{
+		"version": appendCBORUint(nil, uint64(doc.Version)),
+		"files":   files,
+	}), nil
+}
+
+// UnmarshalEaSetsCBOR imports EA sets exported by MarshalEaSetsCBOR, every set is validated with ValidateEaSet.
+func UnmarshalEaSetsCBOR(data []byte) (map[string][]EaInfo, error) {
+	v, err := decodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEaExport, err)
+	}
+
+	doc, err := eaExportFromCBOR(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEaExport, err)
+	}
+
+	return doc.eaSets()
+}
+
+func eaExportFromCBOR(v any) (*eaExport, error) {
+	m, err := cborAs[map[string]any](v, "document")
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := cborField[uint64](m, "version", true)
+	if err != nil {
+		return nil, err
+	}
+	files, err := cborField[[]any](m, "files", true)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &eaExport{Version: int(version), Files: make([]exportedSet, len(files))}
+
+	for i, f := range files {
+		fm, err := cborAs[map[string]any](f, "file")
+		if err != nil {
+			return nil, err
+		}
+
+		set := &doc.Files[i]
+		if set.Path, err = cborField[string](fm, "path", true); err != nil {
+			return nil, err
+		}
+		if _, ok := fm["size"]; ok {
+			size, err := cborField[uint64](fm, "size", true)
+			if err != nil {
+				return nil, err
+			}
+			s := int(size)
+			set.Size = &s
+		}
+
+		eas, err := cborField[[]any](fm, "eas", true)
+		if err != nil {
+			return nil, err
+		}
+		set.Eas = make([]exportedEa, len(eas))
+
+		for j, ea := range eas {
+			if set.Eas[j], err = exportedEaFromCBOR(ea); err != nil {
+				return nil, fmt.Errorf("%s: %v", set.Path, err)
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+func exportedEaFromCBOR(v any) (exportedEa, error) {
+	var e exportedEa
+
+	m, err := cborAs[map[string]any](v, "EA")
+	if err != nil {
+		return e, err
+	}
+
+	if e.Name, err = cborField[string](m, "name", false); err != nil {
+		return e, err
+	}
+	if e.NameBytes, err = cborField[[]byte](m, "nameBytes", false); err != nil {
+		return e, err
+	}
+	flags, err := cborField[uint64](m, "flags", false)
+	if err != nil {
+		return e, err
+	}
+	if flags > 0xff {
+		return e, fmt.Errorf("flags %d of EA %s are out of range", flags, e.Name)
+	}
+	e.Flags = uint8(flags)
+
+	encoding, err := cborField[string](m, "encoding", false)
+	if err != nil {
+		return e, err
+	}
+	e.Encoding = ValueEncoding(encoding)
+
+	switch value := m["value"].(type) {
+	case []byte:
+		e.raw = value
+	case string:
+		e.Value = value
+		if e.Encoding == ValueAuto {
+			e.Encoding = ValueUTF8
+		}
+	default:
+		return e, fmt.Errorf("value of EA %s should be a byte or text string, got %T", e.Name, value)
+	}
+
+	return e, nil
+}
+
+func cborAs[T any](v any, what string) (T, error) {
+	t, ok := v.(T)
+	if !ok {
+		return t, fmt.Errorf("%s should be %T, got %T", what, t, v)
+	}
+
+	return t, nil
+}
+
+// cborField returns the value of key in m, the zero value if it is missing and not required.
+func cborField[T any](m map[string]any, key string, required bool) (T, error) {
+	v, ok := m[key]
+	if !ok {
+		var zero T
+		if required {
+			return zero, fmt.Errorf("%q is missing", key)
+		}
+		return zero, nil
+	}
+
+	return cborAs[T](v, fmt.Sprintf("%q", key))
+}
+
+// ImportEaSets writes EA sets imported from an exported document into files, paths are relative to root, or to the working directory
+// if root is empty. All sets and paths are validated before anything is written, a path which is absolute or escapes root is refused.
+// A path through a symbolic link or reparse point under root is refused when it is reached. DefaultStore() is used if store is nil.
+func ImportEaSets(sets map[string][]EaInfo, root string, followReparsePoint bool, store EaStore) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(sets))
+	for path, eas := range sets {
+		if err := validateSetPath(path); err != nil {
+			return &fs.PathError{Op: "import", Path: path, Err: err}
+		}
+		if err := ValidateEaSet(eas); err != nil {
+			return &fs.PathError{Op: "import", Path: path, Err: err}
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if len(sets[path]) == 0 {
+			continue
+		}
+
+		if err := checkSetTarget(root, path, followReparsePoint); err != nil {
+			return &fs.PathError{Op: "import", Path: path, Err: err}
+		}
+		target := filepath.Join(root, filepath.FromSlash(path))
+
+		if err := store.EaWriteFile(target, followReparsePoint, sets[path]...); err != nil {
+			return &fs.PathError{Op: "import", Path: target, Err: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var exportSets = map[string][]EaInfo{
+	"dir/a.txt": {
+		{Flags: NeedEa, EaName: "APPVERSION", EaValue: []byte("1.0")},
+		{EaName: "BINARY", EaValue: []byte{0, 1, 0xff}},
+	},
+	"b.txt": {{EaName: "Comment", EaValue: []byte("hello")}},
+}
+
+func TestEaSetsJSON(t *testing.T) {
+	for _, encoding := range []ValueEncoding{ValueAuto, ValueBase64, ValueHex} {
+		data, err := MarshalEaSetsJSON(exportSets, &ExportOptions{Encoding: encoding})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sets, err := UnmarshalEaSetsJSON(data)
+		if err != nil || !reflect.DeepEqual(sets, exportSets) {
+			t.Fatalf("Unexpected sets: %v, %v", sets, err)
+		}
+
+		again, _ := MarshalEaSetsJSON(sets, &ExportOptions{Encoding: encoding})
+		if !bytes.Equal(again, data) {
+			t.Fatalf("Export is not stable:\n%s\n%s", data, again)
+		}
+	}
+
+	data, _ := MarshalEaSetsJSON(exportSets, nil)
+	for _, want := range []string{
+		`"path": "b.txt"`,
+		`"size": 24`,
+		`"nameBytes": "QVBQVkVSU0lPTg=="`,
+		`"encoding": "utf8",`,
+		`"value": "1.0"`,
+		`"encoding": "base64",`,
+		`"value": "AAH/"`,
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Fatalf("Export does not have %s:\n%s", want, data)
+		}
+	}
+	if bytes.Index(data, []byte("b.txt")) > bytes.Index(data, []byte("dir/a.txt")) {
+		t.Fatalf("Paths are not sorted:\n%s", data)
+	}
+
+	if _, err := MarshalEaSetsJSON(exportSets, &ExportOptions{Encoding: ValueUTF8}); err == nil {
+		t.Fatal("Expected error for binary value in utf8")
+	}
+
+	// written by another tool, with name only in nameBytes and without size
+	sets, err := UnmarshalEaSetsJSON([]byte(`{"version":1,"files":[{"path":"c","eas":[{"nameBytes":"VEVTVA==","encoding":"hex","value":"7465"}]}]}`))
+	if err != nil || !reflect.DeepEqual(sets, map[string][]EaInfo{"c": {{EaName: "TEST", EaValue: []byte("te")}}}) {
+		t.Fatalf("Unexpected sets: %v, %v", sets, err)
+	}
+
+	for _, bad := range []string{
+		`{"version":2,"files":[]}`,
+		`{"version":1,"files":[{"path":"c","eas":[{"name":"A","encoding":"hex","value":"zz"}]}]}`,
+		`{"version":1,"files":[{"path":"c","eas":[{"name":"A","encoding":"rot13","value":"n"}]}]}`,
+		`{"version":1,"files":[{"path":"c","eas":[{"name":"A","encoding":"utf8","value":""}]}]}`,
+		`{"version":1,"files":[{"path":"c","eas":[{"name":"A?","encoding":"utf8","value":"a"}]}]}`,
+		`{"version":1,"files":[{"path":"c","size":20,"eas":[{"name":"A","encoding":"utf8","value":"a"}]}]}`,
+		`{"version":1,"files":[{"path":"c","eas":[{"name":"A","encoding":"utf8","value":"a"},{"name":"a","encoding":"utf8","value":"b"}]}]}`,
+		`{"version":1,"files":[{"path":"c","eas":[]},{"path":"c","eas":[]}]}`,
+		`{"version":1,"files":[{"path":"c","eas":[{"name":"A","encoding":"base64","value":"` + strings.Repeat("AAAA", 0x5800) + `"}]}]}`,
+		`{"version":`,
+	} {
+		if _, err = UnmarshalEaSetsJSON([]byte(bad)); !errors.Is(err, ErrEaExport) {
+			t.Fatalf("Expected ErrEaExport for %.80s, got %v", bad, err)
+		}
+	}
+}
+
+func TestEaSetsCBOR(t *testing.T) {
+	data, err := MarshalEaSetsCBOR(exportSets, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sets, err := UnmarshalEaSetsCBOR(data)
+	if err != nil || !reflect.DeepEqual(sets, exportSets) {
+		t.Fatalf("Unexpected sets: %v, %v", sets, err)
+	}
+	if again, _ := MarshalEaSetsCBOR(sets, nil); !bytes.Equal(again, data) {
+		t.Fatalf("Export is not stable:\n%x\n%x", data, again)
+	}
+
+	// {"files": [{"eas": [{"name": "A", "flags": 0, "value": "b", "encoding": "utf8", "nameBytes": h'41'}], "path": "p", "size": 12}], "version": 1}
+	want := "a2" + "6566696c6573" + "81" + "a3" +
+		"63656173" + "81" + "a5" +
+		"646e616d65" + "6141" +
+		"65666c616773" + "00" +
+		"6576616c7565" + "6162" +
+		"68656e636f64696e67" + "6475746638" +
+		"696e616d654279746573" + "4141" +
+		"6470617468" + "6170" +
+		"6473697a65" + "0c" +
+		"6776657273696f6e" + "01"
+	data, err = MarshalEaSetsCBOR(map[string][]EaInfo{"p": {{EaName: "A", EaValue: []byte("b")}}}, nil)
+	if err != nil || hex.EncodeToString(data) != want {
+		t.Fatalf("Unexpected CBOR: %x, %v", data, err)
+	}
+
+	for _, bad := range []string{
+		want[:len(want)-2],
+		want + "00",
+		"a1" + "6776657273696f6e" + "20",
+		"a1" + "6776657273696f6e" + "1f",
+		"a2" + "6776657273696f6e" + "01" + "6776657273696f6e" + "01",
+		"a2" + "6776657273696f6e" + "01" + "6566696c6573" + "9bffffffffffffffff",
+		strings.Replace(want, "6576616c7565"+"6162", "6576616c7565"+"01", 1),
+		strings.Replace(want, "6776657273696f6e"+"01", "6776657273696f6e"+"02", 1),
+	} {
+		b, _ := hex.DecodeString(bad)
+		if _, err = UnmarshalEaSetsCBOR(b); !errors.Is(err, ErrEaExport) {
+			t.Fatalf("Expected ErrEaExport for %.80s, got %v", bad, err)
+		}
+	}
+}
+
+func TestAppendCBORHead(t *testing.T) {
+	for n, want := range map[uint64]string{
+		0:          "00",
+		23:         "17",
+		24:         "1818",
+		500:        "1901f4",
+		0x10000:    "1a00010000",
+		1 << 32:    "1b0000000100000000",
+		0xffffffff: "1affffffff",
+	} {
+		if got := hex.EncodeToString(appendCBORUint(nil, n)); got != want {
+			t.Fatalf("Unexpected encoding of %d: %s", n, got)
+		}
+
+		v, err := decodeCBOR(appendCBORUint(nil, n))
+		if err != nil || v != n {
+			t.Fatalf("Unexpected decoding of %d: %v, %v", n, v, err)
+		}
+	}
+}
+
+func TestImportEaSets(t *testing.T) {
+	store := NewMemStore()
+	if err := ImportEaSets(exportSets, "/root", false, store); err != nil {
+		t.Fatal(err)
+	}
+
+	eas, err := store.QueryFileEa("/root/dir/a.txt", false)
+	if err != nil || !reflect.DeepEqual(eas, exportSets["dir/a.txt"]) {
+		t.Fatalf("Unexpected EAs: %v, %v", eas, err)
+	}
+
+	invalid := map[string][]EaInfo{"a": {{EaName: "A", EaValue: []byte("1")}}, "b": {{EaName: "B*", EaValue: []byte("1")}}}
+	if err = ImportEaSets(invalid, "", false, store); err == nil {
+		t.Fatal("Expected error for invalid name")
+	}
+	if eas, _ = store.QueryFileEa("a", false); len(eas) != 0 {
+		t.Fatalf("Nothing should be written for invalid sets, got %v", eas)
+	}
+}
+
+func TestImportEaSetsOutsideRoot(t *testing.T) {
+	store := NewMemStore()
+	eas := []EaInfo{{EaName: "A", EaValue: []byte("1")}}
+
+	for _, p := range []string{"../x", "a/../../x", "/etc/x", `..\x`, `C:\x`, "C:x", `\\server\share\x`, ""} {
+		if err := ImportEaSets(map[string][]EaInfo{p: eas}, "/root", false, store); err == nil {
+			t.Fatalf("Expected error for path %q", p)
+		}
+
+		data, err := json.Marshal(map[string]any{"version": 1, "files": []any{map[string]any{"path": p, "eas": []any{}}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = UnmarshalEaSetsJSON(data); !errors.Is(err, ErrEaExport) {
+			t.Fatalf("Expected ErrEaExport for path %q, got %v", p, err)
+		}
+	}
+	if len(store.eas) != 0 {
+		t.Fatalf("Nothing should be written, got %v", store.eas)
+	}
+
+	if err := ImportEaSets(map[string][]EaInfo{"a/../b": eas}, "/root", false, store); err != nil {
+		t.Fatalf("ImportEaSets failed: %v", err)
+	}
+}
+
+func TestImportEaSetsThroughSymlink(t *testing.T) {
+	root := createTestTree(t, "file.txt")
+	outside := createTestTree(t, "passwd")
+	if err := os.Symlink(outside, filepath.Join(root, "a")); err != nil {
+		t.Skipf("Can not create symbolic link: %v", err)
+	}
+
+	store := NewMemStore()
+	eas := []EaInfo{{EaName: "A", EaValue: []byte("1")}}
+
+	if err := ImportEaSets(map[string][]EaInfo{"a/passwd": eas}, root, false, store); err == nil {
+		t.Fatal("Expected error for path through a symbolic link")
+	}
+	if err := ImportEaSets(map[string][]EaInfo{"a": eas}, root, true, store); err == nil {
+		t.Fatal("Expected error for following a symbolic link")
+	}
+	if len(store.eas) != 0 {
+		t.Fatalf("Nothing should be written, got %v", store.eas)
+	}
+
+	// the link itself is written without following it
+	if err := ImportEaSets(map[string][]EaInfo{"a": eas, "file.txt": eas}, root, false, store); err != nil {
+		t.Fatalf("ImportEaSets failed: %v", err)
+	}
+}
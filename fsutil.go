@@ -0,0 +1,245 @@
+package ntfs_ea
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nyaosorg/go-windows-mbcs"
+)
+
+// fsutil file queryea output
+//
+//	Extended Attributes (EA) information for file C:\test\test.txt:
+//
+//	Total Ea Size: 0xbd
+//
+//	Ea Buffer Offset: 0
+//	Ea Name: TEST
+//	Ea Value Length: 16
+//	0000:  74 68 69 73 20 69 73 20  61 6e 20 45 41 20 63 6f  this is an EA co
+//	0010:  6e 74 65 6e 74 2e                                 ntent.
+//
+// Offsets and sizes are in hex. Total Ea Size is the size of the FILE_FULL_EA_INFORMATION buffer without padding after the last entry,
+// which depends on the length of EA names in the active code page.
+
+const (
+	fsutilHeaderPrefix = "Extended Attributes (EA) information for file "
+	fsutilTotalPrefix  = "Total Ea Size: "
+	fsutilOffsetPrefix = "Ea Buffer Offset: "
+	fsutilNamePrefix   = "Ea Name: "
+	fsutilLengthPrefix = "Ea Value Length: "
+	fsutilDumpWidth    = 16
+)
+
+// EaBufferLayout returns the offset of each EA in the buffer of chained FILE_FULL_EA_INFORMATION entries as written by EaWriteFile
+// and the size of the buffer without padding after the last entry, which NtQueryEaFile returns. Names are converted into
+// codePage, 0 for the active code page.
+func EaBufferLayout(eas []EaInfo, codePage uintptr) (offsets []int, size int, err error) {
+	offsets = make([]int, len(eas))
+
+	offset := 0
+	for i, ea := range eas {
+		name, err := mbcs.Utf8ToAnsi(ea.EaName, codePage)
+		if err != nil {
+			return nil, 0, fmt.Errorf("EA name %q can not be converted to code page %d: %w", ea.EaName, codePage, err)
+		}
+
+		offsets[i] = offset
+		size = offset + fullInfoHeaderSize + len(name) + 1 + len(ea.EaValue)
+		offset += eaEntrySize(len(name), len(ea.EaValue))
+	}
+
+	return offsets, size, nil
+}
+
+// FsutilOptions configures WriteFsutilQueryEa.
+type FsutilOptions struct {
+	CodePage uintptr // code page to compute offsets in, 0 for the active code page
+}
+
+// WriteFsutilQueryEa writes eas of the file in path in the same format as "fsutil file queryea", which starts with a blank line
+// and ends lines with CRLF.
+func WriteFsutilQueryEa(w io.Writer, path string, eas []EaInfo, opts *FsutilOptions) error {
+	if opts == nil {
+		opts = &FsutilOptions{}
+	}
+
+	offsets, size, err := EaBufferLayout(eas, opts.CodePage)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "\r\n%s%s:\r\n\r\n%s0x%x\r\n", fsutilHeaderPrefix, path, fsutilTotalPrefix, size)
+
+	for i, ea := range eas {
+		fmt.Fprintf(bw, "\r\n%s%x\r\n%s%s\r\n%s%x\r\n", fsutilOffsetPrefix, offsets[i], fsutilNamePrefix, ea.EaName, fsutilLengthPrefix, len(ea.EaValue))
+		writeFsutilDump(bw, ea.EaValue)
+	}
+
+	return bw.Flush()
+}
+
+func writeFsutilDump(w *bufio.Writer, b []byte) {
+	for line := 0; line < len(b); line += fsutilDumpWidth {
+		fmt.Fprintf(w, "%04x:  ", line)
+
+		chunk := b[line:]
+		if len(chunk) > fsutilDumpWidth {
+			chunk = chunk[:fsutilDumpWidth]
+		}
+
+		for i := 0; i < fsutilDumpWidth; i++ {
+			if i < len(chunk) {
+				fmt.Fprintf(w, "%02x", chunk[i])
+			} else {
+				w.WriteString("  ")
+			}
+
+			if i == fsutilDumpWidth/2-1 {
+				w.WriteString("  ")
+			} else if i < fsutilDumpWidth-1 {
+				w.WriteByte(' ')
+			}
+		}
+
+		w.WriteString("  ")
+		for _, c := range chunk {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			w.WriteByte(c)
+		}
+		w.WriteString("\r\n")
+	}
+}
+
+// FsutilQueryEa is EAs of a file read from the output of "fsutil file queryea".
+type FsutilQueryEa struct {
+	Path string
+	Eas  []EaInfo
+}
+
+// ParseFsutilQueryEaLog reads the output of "fsutil file queryea" for any number of files, such as a log of a console.
+// Lines which are not a part of the output, e.g. prompts and commands, are ignored. Flags are not in the output and read as 0.
+func ParseFsutilQueryEaLog(r io.Reader) ([]FsutilQueryEa, error) {
+	var (
+		results []FsutilQueryEa
+		cur     *FsutilQueryEa
+		ea      *EaInfo
+		valLen  int
+	)
+
+	finishEa := func(lineNo int) error {
+		if ea == nil {
+			return nil
+		}
+		if len(ea.EaValue) != valLen {
+			return fmt.Errorf("line %d: EA %s should have %d bytes of value, got %d", lineNo, ea.EaName, valLen, len(ea.EaValue))
+		}
+
+		cur.Eas = append(cur.Eas, *ea)
+		ea = nil
+
+		return nil
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimRight(sc.Text(), "\r")
+
+		switch {
+		case strings.HasPrefix(line, fsutilHeaderPrefix) && strings.HasSuffix(line, ":"):
+			if err := finishEa(lineNo); err != nil {
+				return nil, err
+			}
+			results = append(results, FsutilQueryEa{Path: strings.TrimSuffix(line[len(fsutilHeaderPrefix):], ":")})
+			cur = &results[len(results)-1]
+		case cur == nil:
+			// before the output
+		case strings.HasPrefix(line, fsutilOffsetPrefix):
+			if err := finishEa(lineNo); err != nil {
+				return nil, err
+			}
+			ea, valLen = &EaInfo{}, -1
+		case ea != nil && strings.HasPrefix(line, fsutilNamePrefix):
+			ea.EaName = line[len(fsutilNamePrefix):]
+		case ea != nil && strings.HasPrefix(line, fsutilLengthPrefix):
+			l, err := strconv.ParseUint(line[len(fsutilLengthPrefix):], 16, 16)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid value length: %w", lineNo, err)
+			}
+			valLen, ea.EaValue = int(l), make([]byte, 0, l)
+		case ea != nil && valLen >= 0 && isFsutilDumpLine(line):
+			b, err := parseFsutilDumpLine(line, len(ea.EaValue))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			ea.EaValue = append(ea.EaValue, b...)
+		default:
+			// blank lines, total size and anything after the output
+			if err := finishEa(lineNo); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := finishEa(lineNo); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// ParseFsutilQueryEa reads the output of "fsutil file queryea" for a single file, see ParseFsutilQueryEaLog.
+func ParseFsutilQueryEa(r io.Reader) ([]EaInfo, error) {
+	results, err := ParseFsutilQueryEaLog(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != 1 {
+		return nil, fmt.Errorf("expected output of fsutil file queryea for a file, got %d", len(results))
+	}
+
+	return results[0].Eas, nil
+}
+
+func isFsutilDumpLine(line string) bool {
+	if len(line) < 7 || line[4] != ':' {
+		return false
+	}
+	_, err := hex.DecodeString(line[:4])
+
+	return err == nil
+}
+
+// parseFsutilDumpLine returns bytes in a line of hex dump whose offset should be offset.
+func parseFsutilDumpLine(line string, offset int) ([]byte, error) {
+	if lineOffset, _ := strconv.ParseUint(line[:4], 16, 16); int(lineOffset) != offset {
+		return nil, fmt.Errorf("hex dump at offset %s, expected %04x", line[:4], offset)
+	}
+
+	// hex digits are in columns 7 to 54, followed by 2 spaces and the characters
+	hexPart := line[7:]
+	if len(hexPart) > 3*fsutilDumpWidth {
+		hexPart = hexPart[:3*fsutilDumpWidth]
+	}
+
+	b, err := hex.DecodeString(strings.Join(strings.Fields(hexPart), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex dump: %w", err)
+	}
+
+	return b, nil
+}
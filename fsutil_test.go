@@ -0,0 +1,111 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// output of fsutil in README.md
+const fsutilSample = `Extended Attributes (EA) information for file C:\test\test.txt:
+
+Total Ea Size: 0xbd
+
+Ea Buffer Offset: 0
+Ea Name: TEST
+Ea Value Length: 16
+0000:  74 68 69 73 20 69 73 20  61 6e 20 45 41 20 63 6f  this is an EA co
+0010:  6e 74 65 6e 74 2e                                 ntent.
+
+Ea Buffer Offset: 24
+Ea Name: テスト
+Ea Value Length: 21
+0000:  45 41 20 77 72 69 74 65  20 74 65 73 74 2e 20 e3  EA write test. .
+0010:  83 86 e3 82 b9 e3 83 88  20 6a 61 70 61 6e 65 73  ........ japanes
+0020:  65                                                e
+
+Ea Buffer Offset: 54
+Ea Name: 테스트
+Ea Value Length: 1f
+0000:  45 41 20 77 72 69 74 65  20 74 65 73 74 2e 20 ed  EA write test. .
+0010:  85 8c ec 8a a4 ed 8a b8  20 6b 6f 72 65 61 6e     ........ korean
+
+Ea Buffer Offset: 84
+Ea Name: 試驗
+Ea Value Length: 2c
+0000:  45 41 20 77 72 69 74 65  20 74 65 73 74 2e 20 e8  EA write test. .
+0010:  a9 a6 e9 a9 97 20 43 4a  4b 20 55 6e 69 66 69 65  ..... CJK Unifie
+0020:  64 20 49 64 65 6f 67 72  61 70 68 73              d Ideographs
+`
+
+var fsutilSampleEas = []EaInfo{
+	{EaName: "TEST", EaValue: []byte("this is an EA content.")},
+	{EaName: "テスト", EaValue: []byte("EA write test. テスト japanese")},
+	{EaName: "테스트", EaValue: []byte("EA write test. 테스트 korean")},
+	{EaName: "試驗", EaValue: []byte("EA write test. 試驗 CJK Unified Ideographs")},
+}
+
+func TestWriteFsutilQueryEa(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFsutilQueryEa(&buf, `C:\test\test.txt`, fsutilSampleEas, &FsutilOptions{CodePage: 949}); err != nil {
+		t.Fatal(err)
+	}
+
+	// fsutil starts with a blank line and ends lines with CRLF
+	if got, want := buf.String(), "\r\n"+strings.ReplaceAll(fsutilSample, "\n", "\r\n"); got != want {
+		t.Fatalf("Unexpected output:\n%s\nexpected:\n%s", got, want)
+	}
+
+	offsets, size, err := EaBufferLayout(fsutilSampleEas, 949)
+	if err != nil || !reflect.DeepEqual(offsets, []int{0, 0x24, 0x54, 0x84}) || size != 0xbd {
+		t.Fatalf("Unexpected layout: %v, %#x, %v", offsets, size, err)
+	}
+}
+
+func TestParseFsutilQueryEa(t *testing.T) {
+	sample := fsutilSample
+
+	eas, err := ParseFsutilQueryEa(strings.NewReader(sample))
+	if err != nil || !reflect.DeepEqual(eas, fsutilSampleEas) {
+		t.Fatalf("Unexpected EAs: %v, %v", eas, err)
+	}
+
+	// output of WriteFsutilQueryEa is read back
+	var buf bytes.Buffer
+	if err = WriteFsutilQueryEa(&buf, `C:\test\test.txt`, fsutilSampleEas, &FsutilOptions{CodePage: 949}); err != nil {
+		t.Fatal(err)
+	}
+	if eas, err = ParseFsutilQueryEa(&buf); err != nil || !reflect.DeepEqual(eas, fsutilSampleEas) {
+		t.Fatalf("Unexpected EAs read back: %v, %v", eas, err)
+	}
+
+	// console log of two commands with CRLF
+	log := "C:\\test>fsutil file queryea test.txt\n\n" + sample + "\nC:\\test>fsutil file queryea empty.txt\n\n" +
+		"Extended Attributes (EA) information for file C:\\test\\empty.txt:\n\nTotal Ea Size: 0x0\n\nC:\\test>"
+	results, err := ParseFsutilQueryEaLog(strings.NewReader(strings.ReplaceAll(log, "\n", "\r\n")))
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Unexpected results: %v, %v", results, err)
+	}
+	if results[0].Path != `C:\test\test.txt` || !reflect.DeepEqual(results[0].Eas, fsutilSampleEas) {
+		t.Fatalf("Unexpected result: %v", results[0])
+	}
+	if results[1].Path != `C:\test\empty.txt` || len(results[1].Eas) != 0 {
+		t.Fatalf("Unexpected result: %v", results[1])
+	}
+
+	if _, err = ParseFsutilQueryEa(strings.NewReader(log)); err == nil {
+		t.Fatal("Expected error for output of two files")
+	}
+
+	for _, bad := range []string{
+		strings.Replace(sample, "Ea Value Length: 16", "Ea Value Length: 17", 1),
+		strings.Replace(sample, "0010:  6e 74", "0020:  6e 74", 1),
+		strings.Replace(sample, "6e 74 65 6e 74 2e", "6e 74 65 6e 74 2x", 1),
+		strings.Replace(sample, "Ea Value Length: 16", "Ea Value Length: xx", 1),
+	} {
+		if _, err = ParseFsutilQueryEa(strings.NewReader(bad)); err == nil {
+			t.Fatalf("Expected error for:\n%s", bad)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package ntfs_ea
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// getfattr --dump output
+//
+//	# file: mnt/test.txt
+//	system.ntfs_ea=0x00000000000004005445535400...
+//	user.APPVERSION="1.0"
+//
+// Each file starts with a "# file:" line and ends with a blank line, and setfattr --restore reads the same format.
+// Values are in hex with "0x", in base64 with "0s" or in double quotes as text, where every byte other than printable ASCII,
+// '\\' and '"' is escaped in octal as "\ooo", so the output does not depend on the locale.
+// Names and paths escape whitespace, control characters, '\\' and '=' in the same way.
+//
+// ntfs-3g exposes the whole EA set of a file as the system.ntfs_ea extended attribute, while Cygwin and Samba store each EA
+// as an extended attribute in the "user." namespace.
+
+const getfattrFilePrefix = "# file: "
+
+// ErrGetfattrDump is returned when the output of getfattr --dump is malformed.
+var ErrGetfattrDump = errors.New("invalid getfattr dump")
+
+// GetfattrEncoding is the encoding of values in the output of getfattr, the same as the argument of its -e option.
+type GetfattrEncoding string
+
+const (
+	GetfattrAuto   GetfattrEncoding = ""       // text if the value is printable, base64 otherwise, as getfattr does without -e
+	GetfattrText   GetfattrEncoding = "text"   // in double quotes with escapes
+	GetfattrHex    GetfattrEncoding = "hex"    // with "0x"
+	GetfattrBase64 GetfattrEncoding = "base64" // with "0s"
+)
+
+// GetfattrEaForm is how EAs are mapped into extended attributes.
+type GetfattrEaForm int
+
+const (
+	GetfattrNtfsEaForm GetfattrEaForm = iota // the whole EA set in system.ntfs_ea as ntfs-3g exposes it
+	GetfattrUserForm                         // each EA in "user.<EA name>" as Cygwin and Samba store it
+)
+
+// GetfattrOptions configures WriteGetfattrDump.
+type GetfattrOptions struct {
+	Encoding GetfattrEncoding
+	Form     GetfattrEaForm
+}
+
+// GetfattrFile is extended attributes of a file in the output of getfattr --dump.
+type GetfattrFile struct {
+	Path   string
+	Xattrs map[string][]byte
+}
+
+// EasToGetfattrXattrs returns eas as extended attributes in form, EAs with empty value are skipped.
+func EasToGetfattrXattrs(eas []EaInfo, form GetfattrEaForm) (map[string][]byte, error) {
+	var set []EaInfo
+	for _, ea := range eas {
+		if len(ea.EaValue) == 0 {
+			continue
+		}
+		if err := ValidateEaName(ea.EaName); err != nil {
+			return nil, err
+		}
+		set = append(set, ea)
+	}
+
+	xattrs := make(map[string][]byte)
+
+	switch form {
+	case GetfattrNtfsEaForm:
+		if len(set) == 0 {
+			break
+		}
+		buf, err := convertToFullInfoBuf(set)
+		if err != nil {
+			return nil, err
+		}
+		xattrs[ntfs3gEaXattr] = buf
+	case GetfattrUserForm:
+		for _, ea := range set {
+			xattrs[SambaXattrPrefix+ea.EaName] = ea.EaValue
+		}
+	default:
+		return nil, fmt.Errorf("unknown EA form %d", form)
+	}
+
+	return xattrs, nil
+}
+
+// GetfattrXattrsToEas returns EAs in system.ntfs_ea and the "user." namespace of xattrs sorted by name.
+// Other namespaces and private attributes of Samba are ignored, EAs appearing more than once are refused.
+func GetfattrXattrsToEas(xattrs map[string][]byte) ([]EaInfo, error) {
+	var eas []EaInfo
+
+	if buf, ok := xattrs[ntfs3gEaXattr]; ok {
+		set, err := parseFullInfoBuf(buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ntfs3gEaXattr, err)
+		}
+		eas = append(eas, set...)
+	}
+
+	for xattr, value := range xattrs {
+		if !strings.HasPrefix(xattr, SambaXattrPrefix) || IsSambaPrivateXattr(xattr) || len(value) == 0 {
+			continue
+		}
+
+		name := xattr[len(SambaXattrPrefix):]
+		if err := ValidateEaName(name); err != nil {
+			return nil, fmt.Errorf("%s: %w", xattr, err)
+		}
+		eas = append(eas, EaInfo{EaName: name, EaValue: value})
+	}
+
+	sort.Slice(eas, func(i, j int) bool {
+		return eaNameKey(eas[i].EaName) < eaNameKey(eas[j].EaName)
+	})
+	for i := 1; i < len(eas); i++ {
+		if eaNameKey(eas[i-1].EaName) == eaNameKey(eas[i].EaName) {
+			return nil, fmt.Errorf("EA %s appears more than once", eaNameKey(eas[i].EaName))
+		}
+	}
+
+	return eas, nil
+}
+
+// Eas returns EAs in the extended attributes of f, see GetfattrXattrsToEas.
+func (f *GetfattrFile) Eas() ([]EaInfo, error) {
+	eas, err := GetfattrXattrsToEas(f.Xattrs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+
+	return eas, nil
+}
+
+// WriteGetfattrXattrs writes xattrs of the file in path as getfattr --dump does, sorted by name.
+func WriteGetfattrXattrs(w io.Writer, path string, xattrs map[string][]byte, encoding GetfattrEncoding) error {
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s%s\n", getfattrFilePrefix, getfattrQuote(path, false))
+
+	for _, name := range names {
+		value, err := encodeGetfattrValue(xattrs[name], encoding)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "%s=%s\n", getfattrQuote(name, true), value)
+	}
+	bw.WriteByte('\n')
+
+	return bw.Flush()
+}
+
+// WriteGetfattrDump writes eas of the file in path as getfattr --dump does, with the encoding and EA form in opts.
+func WriteGetfattrDump(w io.Writer, path string, eas []EaInfo, opts *GetfattrOptions) error {
+	if opts == nil {
+		opts = &GetfattrOptions{}
+	}
+
+	xattrs, err := EasToGetfattrXattrs(eas, opts.Form)
+	if err != nil {
+		return err
+	}
+
+	return WriteGetfattrXattrs(w, path, xattrs, opts.Encoding)
+}
+
+// WriteGetfattrFileEas queries EAs of the file in path and writes them with WriteGetfattrDump.
+// DefaultStore() is used if store is nil.
+func WriteGetfattrFileEas(w io.Writer, path string, followReparsePoint bool, store EaStore, opts *GetfattrOptions) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	eas, err := store.QueryFileEa(path, followReparsePoint)
+	if err != nil {
+		return err
+	}
+
+	return WriteGetfattrDump(w, path, eas, opts)
+}
+
+// ParseGetfattrDump reads the output of getfattr --dump for any number of files. Comments other than "# file:" are ignored.
+func ParseGetfattrDump(r io.Reader) ([]GetfattrFile, error) {
+	var (
+		files []GetfattrFile
+		cur   *GetfattrFile
+	)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimRight(sc.Text(), "\r")
+
+		switch {
+		case strings.HasPrefix(line, getfattrFilePrefix):
+			path, err := getfattrUnquote(line[len(getfattrFilePrefix):])
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrGetfattrDump, lineNo, err)
+			}
+			files = append(files, GetfattrFile{Path: path, Xattrs: make(map[string][]byte)})
+			cur = &files[len(files)-1]
+		case strings.TrimSpace(line) == "":
+			cur = nil
+		case strings.HasPrefix(line, "#"):
+			// comment
+		case cur == nil:
+			return nil, fmt.Errorf("%w: line %d: extended attribute without \"# file:\"", ErrGetfattrDump, lineNo)
+		default:
+			name, value, err := parseGetfattrLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrGetfattrDump, lineNo, err)
+			}
+			cur.Xattrs[name] = value
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// RestoreGetfattrDump writes EAs of each file in the output of getfattr --dump into the file in its path,
+// as setfattr --restore does. Existing EAs which are not in the dump are kept. DefaultStore() is used if store is nil.
+func RestoreGetfattrDump(r io.Reader, followReparsePoint bool, store EaStore) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	files, err := ParseGetfattrDump(r)
+	if err != nil {
+		return err
+	}
+
+	for i := range files {
+		eas, err := files[i].Eas()
+		if err != nil {
+			return err
+		}
+		if len(eas) == 0 {
+			continue
+		}
+
+		if err = store.EaWriteFile(files[i].Path, followReparsePoint, eas...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseGetfattrLine parses "name=value", a name without value has empty value.
+func parseGetfattrLine(line string) (string, []byte, error) {
+	rawName, rawValue, _ := strings.Cut(line, "=")
+
+	name, err := getfattrUnquote(rawName)
+	if err != nil {
+		return "", nil, err
+	}
+	if name == "" {
+		return "", nil, errors.New("empty extended attribute name")
+	}
+
+	value, err := decodeGetfattrValue(rawValue)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return name, value, nil
+}
+
+func encodeGetfattrValue(value []byte, encoding GetfattrEncoding) (string, error) {
+	if encoding == GetfattrAuto {
+		encoding = GetfattrBase64
+		if isGetfattrText(value) {
+			encoding = GetfattrText
+		}
+	}
+
+	switch encoding {
+	case GetfattrText:
+		var sb strings.Builder
+		sb.WriteByte('"')
+		for _, c := range value {
+			if c < 0x20 || c > 0x7e || c == '\\' || c == '"' {
+				fmt.Fprintf(&sb, "\\%03o", c)
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+		sb.WriteByte('"')
+
+		return sb.String(), nil
+	case GetfattrHex:
+		return "0x" + hex.EncodeToString(value), nil
+	case GetfattrBase64:
+		return "0s" + base64.StdEncoding.EncodeToString(value), nil
+	}
+
+	return "", fmt.Errorf("unknown getfattr encoding %q", string(encoding))
+}
+
+func isGetfattrText(value []byte) bool {
+	for _, c := range value {
+		if c < 0x20 || c == 0x7f {
+			return false
+		}
+	}
+
+	return utf8.Valid(value)
+}
+
+// decodeGetfattrValue decodes a value as setfattr does, text is taken as it is unless it is in double quotes.
+func decodeGetfattrValue(s string) ([]byte, error) {
+	if len(s) >= 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			b, err := hex.DecodeString(s[2:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex value: %w", err)
+			}
+			return b, nil
+		case 's', 'S':
+			b, err := base64.StdEncoding.DecodeString(s[2:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value: %w", err)
+			}
+			return b, nil
+		}
+	}
+
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return unescapeGetfattr(s[1 : len(s)-1])
+	}
+
+	return []byte(s), nil
+}
+
+// getfattrQuote escapes characters in a name or path as getfattr does, '=' is escaped only in names.
+func getfattrQuote(s string, isName bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c == 0x7f || c == '\\' || (isName && c == '=') {
+			fmt.Fprintf(&sb, "\\%03o", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
+
+func getfattrUnquote(s string) (string, error) {
+	b, err := unescapeGetfattr(s)
+
+	return string(b), err
+}
+
+// unescapeGetfattr replaces "\ooo" with the byte of the octal value and "\c" with c.
+func unescapeGetfattr(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return nil, fmt.Errorf("trailing backslash in %q", s)
+		}
+
+		if s[i] < '0' || s[i] > '7' {
+			b = append(b, s[i])
+			continue
+		}
+
+		var c uint
+		for n := 0; n < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; n++ {
+			c = c*8 + uint(s[i]-'0')
+			i++
+		}
+		i--
+		if c > 0xff {
+			return nil, fmt.Errorf("invalid octal escape in %q", s)
+		}
+		b = append(b, byte(c))
+	}
+
+	return b, nil
+}
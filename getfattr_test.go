@@ -0,0 +1,133 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetfattrDump(t *testing.T) {
+	eas := []EaInfo{
+		{EaName: "APPVERSION", EaValue: []byte("1.0")},
+		{EaName: "BINARY", EaValue: []byte{0, 1, 0xff}},
+		{EaName: "QUOTED", EaValue: []byte("a \"b\" \\c\n")},
+	}
+
+	for _, tc := range []struct {
+		opts *GetfattrOptions
+		want string
+	}{
+		{&GetfattrOptions{Form: GetfattrUserForm}, "# file: dir/with\\040space\n" +
+			"user.APPVERSION=\"1.0\"\nuser.BINARY=0sAAH/\nuser.QUOTED=0sYSAiYiIgXGMK\n\n"},
+		{&GetfattrOptions{Form: GetfattrUserForm, Encoding: GetfattrHex}, "# file: dir/with\\040space\n" +
+			"user.APPVERSION=0x312e30\nuser.BINARY=0x0001ff\nuser.QUOTED=0x6120226222205c630a\n\n"},
+		{&GetfattrOptions{Form: GetfattrUserForm, Encoding: GetfattrText}, "# file: dir/with\\040space\n" +
+			"user.APPVERSION=\"1.0\"\nuser.BINARY=\"\\000\\001\\377\"\nuser.QUOTED=\"a \\042b\\042 \\134c\\012\"\n\n"},
+		{&GetfattrOptions{Encoding: GetfattrHex}, ""},
+	} {
+		var buf bytes.Buffer
+		if err := WriteGetfattrDump(&buf, "dir/with space", eas, tc.opts); err != nil {
+			t.Fatal(err)
+		}
+		if tc.want != "" && buf.String() != tc.want {
+			t.Fatalf("Unexpected output:\n%s\nexpected:\n%s", buf.String(), tc.want)
+		}
+
+		files, err := ParseGetfattrDump(&buf)
+		if err != nil || len(files) != 1 || files[0].Path != "dir/with space" {
+			t.Fatalf("Unexpected files: %v, %v", files, err)
+		}
+		if parsed, err := files[0].Eas(); err != nil || !reflect.DeepEqual(parsed, eas) {
+			t.Fatalf("Unexpected EAs: %v, %v", parsed, err)
+		}
+	}
+}
+
+func TestParseGetfattrDump(t *testing.T) {
+	buf, _ := convertToFullInfoBuf([]EaInfo{{Flags: NeedEa, EaName: "TEST", EaValue: []byte("ntfs-3g")}})
+
+	var ntfs3g bytes.Buffer
+	WriteGetfattrXattrs(&ntfs3g, "mnt/a.txt", map[string][]byte{ntfs3gEaXattr: buf}, GetfattrHex)
+
+	dump := "getfattr: Removing leading '/' from absolute path names\n" + ntfs3g.String() +
+		"# file: srv/share/b.txt\r\n" +
+		"security.selinux=\"unconfined_u:object_r:samba_share_t:s0\"\r\n" +
+		"user.DOSATTRIB=0sAAAEAAQAAAAR\r\n" +
+		"user.Comment=plain text\r\n" +
+		"user.Empty\r\n" +
+		"\r\n"
+
+	files, err := ParseGetfattrDump(strings.NewReader(strings.Replace(dump, "getfattr:", "# getfattr:", 1)))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Unexpected files: %v, %v", files, err)
+	}
+
+	eas, err := files[0].Eas()
+	if err != nil || !reflect.DeepEqual(eas, []EaInfo{{Flags: NeedEa, EaName: "TEST", EaValue: []byte("ntfs-3g")}}) {
+		t.Fatalf("Unexpected EAs: %v, %v", eas, err)
+	}
+	if eas, err = files[1].Eas(); err != nil || !reflect.DeepEqual(eas, []EaInfo{{EaName: "Comment", EaValue: []byte("plain text")}}) {
+		t.Fatalf("Unexpected EAs: %v, %v", eas, err)
+	}
+
+	for _, bad := range []string{
+		dump,
+		"# file: a\nuser.A=0xzz\n",
+		"# file: a\nuser.A=0s!!\n",
+		"# file: a\n=\"a\"\n",
+		"# file: a\nuser.A=\"a\\\"\n",
+	} {
+		if _, err = ParseGetfattrDump(strings.NewReader(bad)); !errors.Is(err, ErrGetfattrDump) {
+			t.Fatalf("Expected ErrGetfattrDump for %q, got %v", bad, err)
+		}
+	}
+
+	dup := GetfattrFile{Path: "a", Xattrs: map[string][]byte{ntfs3gEaXattr: buf, "user.test": []byte("1")}}
+	if _, err = dup.Eas(); err == nil {
+		t.Fatal("Expected error for duplicated EA")
+	}
+}
+
+func TestRestoreGetfattrDump(t *testing.T) {
+	src, dst := NewMemStore(), NewMemStore()
+	eas := []EaInfo{{Flags: NeedEa, EaName: "APPVERSION", EaValue: []byte("1.0")}}
+	if err := src.EaWriteFile("/src/file", false, eas...); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteGetfattrFileEas(&buf, "/src/file", false, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreGetfattrDump(&buf, false, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := dst.QueryFileEa("/src/file", false)
+	if err != nil || !reflect.DeepEqual(restored, eas) {
+		t.Fatalf("Unexpected EAs: %v, %v", restored, err)
+	}
+}
+
+func TestGetfattrTextNonASCII(t *testing.T) {
+	eas := []EaInfo{{EaName: "COMMENT", EaValue: []byte("テスト")}}
+
+	var buf bytes.Buffer
+	if err := WriteGetfattrDump(&buf, "a.txt", eas, &GetfattrOptions{Form: GetfattrUserForm}); err != nil {
+		t.Fatal(err)
+	}
+	want := "# file: a.txt\nuser.COMMENT=\"\\343\\203\\206\\343\\202\\271\\343\\203\\210\"\n\n"
+	if buf.String() != want {
+		t.Fatalf("Unexpected output:\n%s\nexpected:\n%s", buf.String(), want)
+	}
+
+	files, err := ParseGetfattrDump(&buf)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("ParseGetfattrDump failed: %v, %v", files, err)
+	}
+	if got, err := files[0].Eas(); err != nil || !reflect.DeepEqual(got, eas) {
+		t.Fatalf("Unexpected EAs: %v, %v", got, err)
+	}
+}
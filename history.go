@@ -0,0 +1,407 @@
+package ntfs_ea
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EA history
+//
+// EaHistory keeps EA sets in a directory like git keeps file contents:
+//
+//	objects/ab/cdef...   canonical FILE_FULL_EA_INFORMATION buffer of an EA set, named by its SHA-256
+//	paths/0123....jsonl  history of a path, named by SHA-256 of the path, a JSON line for each recorded EA set
+//
+// The same EA set is stored once however many times and paths it is recorded for. Objects depend on the active code page
+// which names are converted into, so a history should be used on the machine it was created.
+
+const (
+	historyObjectsDir = "objects"
+	historyPathsDir   = "paths"
+	minRevisionLen    = 4
+)
+
+var (
+	// ErrHistory is returned when an object or a history in EaHistory is corrupted.
+	ErrHistory = errors.New("invalid EA history")
+	// ErrRevisionNotFound is returned when a revision does not match any EA set in EaHistory.
+	ErrRevisionNotFound = errors.New("EA revision not found")
+)
+
+// HistoryEntry is a record of the EA set of a path in EaHistory.
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+	Path string    `json:"path"`
+	Hash string    `json:"hash"`          // SHA-256 of the canonical buffer of the EA set
+	Tag  string    `json:"tag,omitempty"` // author or tool which observed or wrote the EA set
+}
+
+// EaHistory is a content-addressed store of EA sets with history per path, see OpenEaHistory.
+type EaHistory struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// CanonicalEaBuffer returns the canonical form of eas as chained FILE_FULL_EA_INFORMATION entries, with upper case names
+// sorted as NTFS keeps them. EAs with empty value are left out, so an empty set has an empty buffer.
+func CanonicalEaBuffer(eas []EaInfo) ([]byte, error) {
+	var sorted []EaInfo
+	for _, ea := range eas {
+		if len(ea.EaValue) != 0 {
+			sorted = append(sorted, EaInfo{Flags: ea.Flags, EaName: eaNameKey(ea.EaName), EaValue: ea.EaValue})
+		}
+	}
+	if err := ValidateEaSet(sorted); err != nil {
+		return nil, err
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].EaName < sorted[j].EaName
+	})
+
+	return convertToFullInfoBuf(sorted)
+}
+
+// OpenEaHistory opens the history in dir, which is created if it does not exist.
+func OpenEaHistory(dir string) (*EaHistory, error) {
+	for _, sub := range []string{historyObjectsDir, historyPathsDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &EaHistory{dir: dir}, nil
+}
+
+func (h *EaHistory) objectPath(hash string) string {
+	return filepath.Join(h.dir, historyObjectsDir, hash[:2], hash[2:])
+}
+
+func (h *EaHistory) logPath(path string) string {
+	return filepath.Join(h.dir, historyPathsDir, sha256Hex([]byte(path))+".jsonl")
+}
+
+// historyKey returns the absolute path, so the same file has the same history from any working directory.
+func historyKey(path string) (string, error) {
+	return filepath.Abs(path)
+}
+
+// Put stores eas and returns the hash to get them with.
+func (h *EaHistory) Put(eas []EaInfo) (string, error) {
+	buf, err := CanonicalEaBuffer(eas)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256Hex(buf)
+
+	p := h.objectPath(hash)
+	if _, err = os.Stat(p); err == nil {
+		return hash, nil
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+
+	tmp := p + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0o444); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// Get returns the EA set stored with hash, which can be a unique prefix of the hash.
+func (h *EaHistory) Get(hash string) ([]EaInfo, error) {
+	full, err := h.resolveHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := os.ReadFile(h.objectPath(full))
+	if err != nil {
+		return nil, err
+	}
+	if sha256Hex(buf) != full {
+		return nil, fmt.Errorf("%w: object %s is corrupted", ErrHistory, full)
+	}
+
+	return parseFullInfoBuf(buf)
+}
+
+// resolveHash returns the full hash of an object from a unique prefix of it.
+func (h *EaHistory) resolveHash(prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < minRevisionLen {
+		return "", fmt.Errorf("%w: %q is shorter than %d characters", ErrRevisionNotFound, prefix, minRevisionLen)
+	}
+	if _, err := hex.DecodeString(prefix[:len(prefix)&^1]); err != nil {
+		return "", fmt.Errorf("%w: %q is not hex", ErrRevisionNotFound, prefix)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(h.dir, historyObjectsDir, prefix[:2]))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrRevisionNotFound, prefix)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var found []string
+	for _, e := range entries {
+		if hash := prefix[:2] + e.Name(); strings.HasPrefix(hash, prefix) && len(hash) == 2*sha256.Size {
+			found = append(found, hash)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrRevisionNotFound, prefix)
+	case 1:
+		return found[0], nil
+	}
+
+	return "", fmt.Errorf("%w: %s is ambiguous", ErrRevisionNotFound, prefix)
+}
+
+// Record stores eas as the EA set of path with tag, nothing is added if it is the same as the last record of path.
+func (h *EaHistory) Record(path string, eas []EaInfo, tag string) (*HistoryEntry, error) {
+	key, err := historyKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := h.Put(eas)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries, err := h.log(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 0 && entries[len(entries)-1].Hash == hash {
+		return &entries[len(entries)-1], nil
+	}
+
+	entry := &HistoryEntry{Time: time.Now().UTC(), Path: key, Hash: hash, Tag: tag}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(h.logPath(key), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return entry, f.Close()
+}
+
+// Observe queries EAs of the file in path and records them with tag. DefaultStore() is used if store is nil.
+func (h *EaHistory) Observe(path string, followReparsePoint bool, store EaStore, tag string) (*HistoryEntry, error) {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return nil, err
+	}
+
+	eas, err := store.QueryFileEa(path, followReparsePoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Record(path, eas, tag)
+}
+
+// EaWriteFile records the current EA set of the file in path, writes eas into it with EaWriteFile and records the result,
+// so the write can be rolled back. DefaultStore() is used if store is nil.
+func (h *EaHistory) EaWriteFile(path string, followReparsePoint bool, store EaStore, tag string, eas ...EaInfo) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	if _, err = h.Observe(path, followReparsePoint, store, tag); err != nil {
+		return err
+	}
+	if err = store.EaWriteFile(path, followReparsePoint, eas...); err != nil {
+		return err
+	}
+
+	_, err = h.Observe(path, followReparsePoint, store, tag)
+
+	return err
+}
+
+// Log returns the history of path, oldest first.
+func (h *EaHistory) Log(path string) ([]HistoryEntry, error) {
+	key, err := historyKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.log(key)
+}
+
+func (h *EaHistory) log(key string) ([]HistoryEntry, error) {
+	f, err := os.Open(h.logPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		var e HistoryEntry
+		if err = json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%w: history of %s, line %d: %v", ErrHistory, key, lineNo, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, sc.Err()
+}
+
+// Paths returns paths which have history, sorted.
+func (h *EaHistory) Paths() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(h.dir, historyPathsDir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var paths []string
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var e HistoryEntry
+		err = json.NewDecoder(f).Decode(&e)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrHistory, filepath.Base(file), err)
+		}
+		paths = append(paths, e.Path)
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// ResolveRevision returns the hash of a revision of path, which is "@N" for the Nth record in the log of path with negative N
+// counted from the last one, e.g. "@-2" for the one before the last, or a unique prefix of a hash.
+func (h *EaHistory) ResolveRevision(path, rev string) (string, error) {
+	if !strings.HasPrefix(rev, "@") {
+		return h.resolveHash(rev)
+	}
+
+	n, err := strconv.Atoi(rev[1:])
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid revision %q", ErrRevisionNotFound, rev)
+	}
+
+	entries, err := h.Log(path)
+	if err != nil {
+		return "", err
+	}
+	if n < 0 {
+		n += len(entries)
+	}
+	if n < 0 || n >= len(entries) {
+		return "", fmt.Errorf("%w: %s has %d records, no %s", ErrRevisionNotFound, path, len(entries), rev)
+	}
+
+	return entries[n].Hash, nil
+}
+
+// Diff compares the EA sets of two revisions of path, see ResolveRevision.
+func (h *EaHistory) Diff(path, oldRev, newRev string) (*EaDiff, error) {
+	var sets [2][]EaInfo
+	for i, rev := range []string{oldRev, newRev} {
+		hash, err := h.ResolveRevision(path, rev)
+		if err != nil {
+			return nil, err
+		}
+		if sets[i], err = h.Get(hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return DiffEas(sets[0], sets[1]), nil
+}
+
+// Rollback makes the EA set of the file in path the same as the revision with EaWriteFile, removing EAs which are not in it.
+// The EA sets before and after the rollback are recorded with tag, so a rollback can be rolled back too.
+// DefaultStore() is used if store is nil.
+func (h *EaHistory) Rollback(path, rev string, followReparsePoint bool, store EaStore, tag string) (*EaDiff, error) {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := h.ResolveRevision(path, rev)
+	if err != nil {
+		return nil, err
+	}
+	target, err := h.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := store.QueryFileEa(path, followReparsePoint)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = h.Record(path, current, tag); err != nil {
+		return nil, err
+	}
+
+	d := DiffEas(current, target)
+	toWrite := append([]EaInfo{}, target...)
+	for _, c := range d.Removed {
+		toWrite = append(toWrite, EaInfo{EaName: c.Name})
+	}
+	if len(toWrite) != 0 {
+		if err = store.EaWriteFile(path, followReparsePoint, toWrite...); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err = h.Observe(path, followReparsePoint, store, tag); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
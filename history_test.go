@@ -0,0 +1,128 @@
+package ntfs_ea
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEaHistory(t *testing.T) {
+	root := createTestTree(t, "a.txt", "b.txt")
+	a, b := filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")
+	store := NewMemStore()
+
+	h, err := OpenEaHistory(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenEaHistory failed: %v", err)
+	}
+
+	v1 := []EaInfo{{EaName: "A", EaValue: []byte("1")}, {Flags: NeedEa, EaName: "B", EaValue: []byte("1")}}
+	if err = h.EaWriteFile(a, false, store, "tool", v1...); err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+	// an accidental overwrite
+	if err = store.EaWriteFile(a, false, EaInfo{EaName: "A", EaValue: []byte("oops")}, EaInfo{EaName: "C", EaValue: []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = h.Observe(a, false, store, "scan"); err != nil {
+		t.Fatalf("Observe failed: %v", err)
+	}
+	// the same EA set is not recorded twice
+	if _, err = h.Observe(a, false, store, "scan"); err != nil {
+		t.Fatalf("Observe failed: %v", err)
+	}
+
+	log, err := h.Log(a)
+	if err != nil || len(log) != 3 || log[0].Tag != "tool" || log[2].Tag != "scan" || log[0].Path != a {
+		t.Fatalf("Unexpected log: %+v, %v", log, err)
+	}
+	if empty, _ := h.Get(log[0].Hash); len(empty) != 0 {
+		t.Fatalf("Expected empty EA set before the first write, got %v", empty)
+	}
+
+	// b.txt has the same EA set as a.txt had, which is stored once
+	if _, err = h.Record(b, v1, "tool"); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if logB, _ := h.Log(b); len(logB) != 1 || logB[0].Hash != log[1].Hash {
+		t.Fatalf("Unexpected log: %+v", logB)
+	}
+	if paths, err := h.Paths(); err != nil || !reflect.DeepEqual(paths, []string{a, b}) {
+		t.Fatalf("Unexpected paths: %v, %v", paths, err)
+	}
+
+	d, err := h.Diff(a, "@1", "@-1")
+	if err != nil || len(d.Added) != 1 || len(d.Removed) != 0 || len(d.Changed) != 1 {
+		t.Fatalf("Unexpected diff: %+v, %v", d, err)
+	}
+
+	d, err = h.Rollback(a, log[1].Hash[:8], false, store, "rollback")
+	if err != nil || len(d.Removed) != 1 {
+		t.Fatalf("Rollback failed: %+v, %v", d, err)
+	}
+	if eas, _ := store.QueryFileEa(a, false); !reflect.DeepEqual(eas, v1) {
+		t.Fatalf("Unexpected EAs after rollback: %v", eas)
+	}
+	if log, _ = h.Log(a); len(log) != 4 || log[3].Tag != "rollback" || log[3].Hash != log[1].Hash {
+		t.Fatalf("Unexpected log after rollback: %+v", log)
+	}
+
+	// the rollback can be rolled back
+	if _, err = h.Rollback(a, "@2", false, store, "rollback"); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if eas, _ := store.QueryFileEa(a, false); len(eas) != 3 || string(eas[0].EaValue) != "oops" {
+		t.Fatalf("Unexpected EAs after rollback: %v", eas)
+	}
+
+	for _, rev := range []string{"@9", "@x", "abc", "zzzz", "0000"} {
+		if _, err = h.ResolveRevision(a, rev); !errors.Is(err, ErrRevisionNotFound) {
+			t.Fatalf("Expected ErrRevisionNotFound for %q, got %v", rev, err)
+		}
+	}
+}
+
+func TestEaHistoryCorrupted(t *testing.T) {
+	h, err := OpenEaHistory(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := h.Put([]EaInfo{{EaName: "A", EaValue: []byte("1")}})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	p := h.objectPath(hash)
+	os.Chmod(p, 0o644)
+	if err = os.WriteFile(p, []byte("corrupted"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = h.Get(hash); !errors.Is(err, ErrHistory) {
+		t.Fatalf("Expected ErrHistory, got %v", err)
+	}
+}
+
+func TestCanonicalEaBuffer(t *testing.T) {
+	a, err := CanonicalEaBuffer([]EaInfo{{EaName: "b", EaValue: []byte("2")}, {EaName: "A", EaValue: []byte("1")}, {EaName: "EMPTY"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := CanonicalEaBuffer([]EaInfo{{EaName: "a", EaValue: []byte("1")}, {EaName: "B", EaValue: []byte("2")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("Canonical buffer should not depend on order, case and empty EAs")
+	}
+
+	eas, err := parseFullInfoBuf(a)
+	if err != nil || len(eas) != 2 || eas[0].EaName != "A" || eas[1].EaName != "B" {
+		t.Fatalf("Unexpected EAs: %v, %v", eas, err)
+	}
+
+	if _, err = CanonicalEaBuffer([]EaInfo{{EaName: "A", EaValue: []byte("1")}, {EaName: "a", EaValue: []byte("2")}}); err == nil {
+		t.Fatal("Expected error for duplicated names")
+	}
+}
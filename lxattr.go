@@ -0,0 +1,239 @@
+package ntfs_ea
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// Names of EAs which WSL1 uses to store Linux metadata of files in the root file system of a distribution(lxfs).
+const (
+	LxAttrbEaName = "LXATTRB" // stat data, see LxAttrb
+	LxXattrEaName = "LXXATTR" // Linux extended attributes, see DecodeLxXattr
+)
+
+const (
+	lxAttrbSize         = 56
+	lxAttrbVersion      = 1
+	lxXattrHeaderSize   = 4 // uint16 flags, uint16 version
+	lxXattrEntrySize    = 7 // uint32 offset to next entry, uint16 value length, uint8 name length
+	lxXattrVersion      = 1
+	maxLxXattrNameLen   = 0xff
+	maxLxXattrValueSize = 0xffff
+)
+
+// LxAttrb is the stat data of a file stored in LXATTRB EA, which is laid out in little endian as
+//
+//	uint16 Flags, uint16 Version, uint32 Mode, uint32 UID, uint32 GID, uint32 Rdev,
+//	uint32 atime nsec, uint32 mtime nsec, uint32 ctime nsec, uint64 atime sec, uint64 mtime sec, uint64 ctime sec
+type LxAttrb struct {
+	Flags   uint16
+	Version uint16 // 1
+	Mode    uint32 // Unix st_mode
+	UID     uint32
+	GID     uint32
+	Rdev    uint32
+	Atime   time.Time
+	Mtime   time.Time
+	Ctime   time.Time
+}
+
+// FileMode converts Mode into fs.FileMode.
+func (a LxAttrb) FileMode() fs.FileMode {
+	return UnixModeToFileMode(a.Mode)
+}
+
+// DecodeLxAttrb decodes the value of LXATTRB EA.
+func DecodeLxAttrb(b []byte) (LxAttrb, error) {
+	if len(b) != lxAttrbSize {
+		return LxAttrb{}, fmt.Errorf("%s should be %d bytes, got %d", LxAttrbEaName, lxAttrbSize, len(b))
+	}
+
+	le := binary.LittleEndian
+	a := LxAttrb{
+		Flags:   le.Uint16(b[0:]),
+		Version: le.Uint16(b[2:]),
+		Mode:    le.Uint32(b[4:]),
+		UID:     le.Uint32(b[8:]),
+		GID:     le.Uint32(b[12:]),
+		Rdev:    le.Uint32(b[16:]),
+		Atime:   time.Unix(int64(le.Uint64(b[32:])), int64(le.Uint32(b[20:]))),
+		Mtime:   time.Unix(int64(le.Uint64(b[40:])), int64(le.Uint32(b[24:]))),
+		Ctime:   time.Unix(int64(le.Uint64(b[48:])), int64(le.Uint32(b[28:]))),
+	}
+	if a.Version != lxAttrbVersion {
+		return LxAttrb{}, fmt.Errorf("unsupported %s version %d", LxAttrbEaName, a.Version)
+	}
+
+	return a, nil
+}
+
+func lxTime(t time.Time) (uint64, uint32) {
+	if t.IsZero() {
+		return 0, 0
+	}
+
+	return uint64(t.Unix()), uint32(t.Nanosecond())
+}
+
+// Encode returns the value of LXATTRB EA, Version 0 is written as 1.
+func (a LxAttrb) Encode() []byte {
+	if a.Version == 0 {
+		a.Version = lxAttrbVersion
+	}
+
+	le := binary.LittleEndian
+	b := make([]byte, lxAttrbSize)
+
+	le.PutUint16(b[0:], a.Flags)
+	le.PutUint16(b[2:], a.Version)
+	le.PutUint32(b[4:], a.Mode)
+	le.PutUint32(b[8:], a.UID)
+	le.PutUint32(b[12:], a.GID)
+	le.PutUint32(b[16:], a.Rdev)
+
+	for i, t := range []time.Time{a.Atime, a.Mtime, a.Ctime} {
+		sec, nsec := lxTime(t)
+		le.PutUint32(b[20+4*i:], nsec)
+		le.PutUint64(b[32+8*i:], sec)
+	}
+
+	return b
+}
+
+// DecodeLxXattr decodes the value of LXXATTR EA into Linux extended attributes keyed by their full name, e.g. "user.comment".
+//
+// The value is a header of uint16 flags and uint16 version(1) followed by entries of uint32 offset to the next entry(0 for the last one),
+// uint16 value length, uint8 name length, the name and the value, all packed without padding in little endian.
+func DecodeLxXattr(b []byte) (map[string][]byte, error) {
+	if len(b) < lxXattrHeaderSize {
+		return nil, fmt.Errorf("%s is too short", LxXattrEaName)
+	}
+	if ver := binary.LittleEndian.Uint16(b[2:]); ver != lxXattrVersion {
+		return nil, fmt.Errorf("unsupported %s version %d", LxXattrEaName, ver)
+	}
+
+	xattrs := make(map[string][]byte)
+
+	for offset := lxXattrHeaderSize; offset < len(b); {
+		if len(b)-offset < lxXattrEntrySize {
+			return nil, fmt.Errorf("%s entry at offset %d is truncated", LxXattrEaName, offset)
+		}
+
+		next := int(binary.LittleEndian.Uint32(b[offset:]))
+		valueLen := int(binary.LittleEndian.Uint16(b[offset+4:]))
+		nameLen := int(b[offset+6])
+
+		nameStart := offset + lxXattrEntrySize
+		valueStart := nameStart + nameLen
+		if valueStart+valueLen > len(b) {
+			return nil, fmt.Errorf("%s entry at offset %d exceeds the value", LxXattrEaName, offset)
+		}
+
+		xattrs[string(b[nameStart:valueStart])] = append([]byte{}, b[valueStart:valueStart+valueLen]...)
+
+		if next == 0 {
+			break
+		}
+		if next < lxXattrEntrySize {
+			return nil, fmt.Errorf("%s entry at offset %d has invalid offset %d", LxXattrEaName, offset, next)
+		}
+		offset += next
+	}
+
+	return xattrs, nil
+}
+
+// EncodeLxXattr returns the value of LXXATTR EA with xattrs sorted by name.
+func EncodeLxXattr(xattrs map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := binary.LittleEndian.AppendUint16(nil, 0)
+	b = binary.LittleEndian.AppendUint16(b, lxXattrVersion)
+
+	for i, name := range names {
+		value := xattrs[name]
+		if len(name) == 0 || len(name) > maxLxXattrNameLen {
+			return nil, fmt.Errorf("invalid length of Linux extended attribute name %q", name)
+		}
+		if len(value) > maxLxXattrValueSize {
+			return nil, fmt.Errorf("value of Linux extended attribute %s is too large", name)
+		}
+
+		var next uint32
+		if i < len(names)-1 {
+			next = uint32(lxXattrEntrySize + len(name) + len(value))
+		}
+
+		b = binary.LittleEndian.AppendUint32(b, next)
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+		b = append(b, uint8(len(name)))
+		b = append(b, name...)
+		b = append(b, value...)
+	}
+
+	return b, nil
+}
+
+// GetLxAttrb queries LXATTRB of the file in path, DefaultStore() is used if store is nil.
+func GetLxAttrb(path string, followReparsePoint bool, store EaStore) (LxAttrb, error) {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return LxAttrb{}, err
+	}
+
+	ea, err := queryEa(store, path, followReparsePoint, LxAttrbEaName)
+	if err != nil {
+		return LxAttrb{}, err
+	}
+
+	return DecodeLxAttrb(ea.EaValue)
+}
+
+// SetLxAttrb writes a as LXATTRB into the file in path, DefaultStore() is used if store is nil.
+func SetLxAttrb(path string, followReparsePoint bool, store EaStore, a LxAttrb) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	return store.EaWriteFile(path, followReparsePoint, EaInfo{EaName: LxAttrbEaName, EaValue: a.Encode()})
+}
+
+// GetLxXattr queries Linux extended attributes in LXXATTR of the file in path, DefaultStore() is used if store is nil.
+func GetLxXattr(path string, followReparsePoint bool, store EaStore) (map[string][]byte, error) {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return nil, err
+	}
+
+	ea, err := queryEa(store, path, followReparsePoint, LxXattrEaName)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeLxXattr(ea.EaValue)
+}
+
+// SetLxXattr writes xattrs as LXXATTR into the file in path, LXXATTR is removed if xattrs is empty. DefaultStore() is used if store is nil.
+func SetLxXattr(path string, followReparsePoint bool, store EaStore, xattrs map[string][]byte) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	ea := EaInfo{EaName: LxXattrEaName}
+	if len(xattrs) != 0 {
+		if ea.EaValue, err = EncodeLxXattr(xattrs); err != nil {
+			return err
+		}
+	}
+
+	return store.EaWriteFile(path, followReparsePoint, ea)
+}
@@ -0,0 +1,88 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLxAttrb(t *testing.T) {
+	root := createTestTree(t, "rootfs/etc/passwd")
+	target := filepath.Join(root, "rootfs", "etc", "passwd")
+	store := NewMemStore()
+
+	a := LxAttrb{
+		Mode:  unixModeRegular | 0o644,
+		UID:   0,
+		GID:   0,
+		Atime: time.Unix(1700000000, 123456789),
+		Mtime: time.Unix(1600000000, 5),
+		Ctime: time.Unix(1600000001, 0),
+	}
+
+	if err := SetLxAttrb(target, false, store, a); err != nil {
+		t.Fatalf("SetLxAttrb failed: %v", err)
+	}
+
+	raw, _ := store.QueryFileEa(target, false, LxAttrbEaName)
+	if len(raw[0].EaValue) != 56 || !bytes.Equal(raw[0].EaValue[:8], []byte{0, 0, 1, 0, 0xa4, 0x81, 0, 0}) {
+		t.Fatalf("Unexpected LXATTRB value: % x", raw[0].EaValue)
+	}
+
+	got, err := GetLxAttrb(target, false, store)
+	if err != nil {
+		t.Fatalf("GetLxAttrb failed: %v", err)
+	}
+
+	a.Version = 1
+	if got.Mode != a.Mode || got.Version != 1 || !got.Atime.Equal(a.Atime) || !got.Mtime.Equal(a.Mtime) || !got.Ctime.Equal(a.Ctime) {
+		t.Fatalf("LXATTRB mismatch: got %+v, expected %+v", got, a)
+	}
+	if got.FileMode() != 0o644 {
+		t.Fatalf("Unexpected file mode: %v", got.FileMode())
+	}
+
+	if _, err = DecodeLxAttrb(raw[0].EaValue[:40]); err == nil {
+		t.Fatalf("Expected error for short LXATTRB")
+	}
+}
+
+func TestLxXattr(t *testing.T) {
+	// entries of "user.a"="1" and "security.capability"=01 02
+	value := []byte{
+		0x00, 0x00, 0x01, 0x00,
+		0x0e, 0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 'u', 's', 'e', 'r', '.', 'a', '1',
+		0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x13,
+	}
+	value = append(value, "security.capability"...)
+	value = append(value, 0x01, 0x02)
+
+	xattrs, err := DecodeLxXattr(value)
+	if err != nil {
+		t.Fatalf("DecodeLxXattr failed: %v", err)
+	}
+
+	expected := map[string][]byte{"user.a": []byte("1"), "security.capability": {0x01, 0x02}}
+	if !reflect.DeepEqual(xattrs, expected) {
+		t.Fatalf("LXXATTR mismatch: got %q", xattrs)
+	}
+
+	root := createTestTree(t, "file")
+	target := filepath.Join(root, "file")
+	store := NewMemStore()
+
+	if err = SetLxXattr(target, false, store, expected); err != nil {
+		t.Fatalf("SetLxXattr failed: %v", err)
+	}
+
+	got, err := GetLxXattr(target, false, store)
+	if err != nil || !reflect.DeepEqual(got, expected) {
+		t.Fatalf("LXXATTR mismatch after round trip: got %q, %v", got, err)
+	}
+
+	if _, err = DecodeLxXattr(value[:20]); err == nil {
+		t.Fatalf("Expected error for truncated LXXATTR")
+	}
+}
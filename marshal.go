@@ -0,0 +1,335 @@
+package ntfs_ea
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrMarshalEa is returned when a Go value can not be converted into or from EAs.
+var ErrMarshalEa = errors.New("can not marshal EA")
+
+// filetimeEpochDiff is the number of 100 nanoseconds between 1601-01-01 and 1970-01-01.
+const filetimeEpochDiff = 116444736000000000
+
+// maxFiletimeUnix is the largest FILETIME, which is a signed 64 bit value in Windows, in 100 nanoseconds since 1970-01-01.
+const maxFiletimeUnix int64 = math.MaxInt64 - filetimeEpochDiff
+
+// minFiletime and maxFiletime are the range of time FILETIME can hold.
+var (
+	minFiletime = time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxFiletime = time.Unix(maxFiletimeUnix/1e7, maxFiletimeUnix%1e7*100).UTC()
+)
+
+// timeToFiletime converts t into Windows FILETIME, 100 nanoseconds since 1601-01-01 UTC. The zero time is converted into 0,
+// an error is returned for other times out of the range of FILETIME and for 1601-01-01 itself, which would be read back as the zero time.
+func timeToFiletime(t time.Time) (uint64, error) {
+	if t.IsZero() {
+		return 0, nil
+	}
+	if !t.After(minFiletime) || t.After(maxFiletime) {
+		return 0, fmt.Errorf("time %s is out of the range of FILETIME", t.UTC().Format(time.RFC3339Nano))
+	}
+
+	return uint64(t.Unix()*1e7+int64(t.Nanosecond()/100)) + filetimeEpochDiff, nil
+}
+
+// filetimeToTime converts Windows FILETIME into time.Time in UTC, 0 is converted into the zero time.
+// An error is returned for values with the sign bit set, which Windows does not accept as FILETIME.
+func filetimeToTime(ft uint64) (time.Time, error) {
+	if ft == 0 {
+		return time.Time{}, nil
+	}
+	if ft > math.MaxInt64 {
+		return time.Time{}, fmt.Errorf("FILETIME 0x%x is out of range", ft)
+	}
+
+	// values before 1970-01-01 are negative, the division rounds toward 0 and time.Unix normalizes a negative remainder
+	t := int64(ft) - filetimeEpochDiff
+
+	return time.Unix(t/1e7, t%1e7*100).UTC(), nil
+}
+
+var (
+	timeType              = reflect.TypeOf(time.Time{})
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// eaField is a struct field mapped to an EA.
+type eaField struct {
+	index     int
+	name      string
+	flags     uint8
+	omitEmpty bool
+}
+
+// eaFields returns the fields of struct type t which have an ea tag. Each tag is "NAME" followed by the options
+// "needea" and "omitempty" separated by commas, "-" skips the field.
+func eaFields(t reflect.Type) ([]eaField, error) {
+	var fields []eaField
+	seen := make(map[string]string)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag, ok := sf.Tag.Lookup("ea")
+		if !ok || tag == "-" {
+			continue
+		}
+		if !sf.IsExported() {
+			return nil, fmt.Errorf("%w: field %s with ea tag is not exported", ErrMarshalEa, sf.Name)
+		}
+
+		opts := strings.Split(tag, ",")
+		f := eaField{index: i, name: opts[0]}
+
+		if err := ValidateEaName(f.name); err != nil {
+			return nil, fmt.Errorf("%w: field %s: %v", ErrMarshalEa, sf.Name, err)
+		}
+		if other, ok := seen[eaNameKey(f.name)]; ok {
+			return nil, fmt.Errorf("%w: fields %s and %s have the same EA name %s", ErrMarshalEa, other, sf.Name, f.name)
+		}
+		seen[eaNameKey(f.name)] = sf.Name
+
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "needea":
+				f.flags |= NeedEa
+			case "omitempty":
+				f.omitEmpty = true
+			default:
+				return nil, fmt.Errorf("%w: field %s has unknown ea tag option %q", ErrMarshalEa, sf.Name, opt)
+			}
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// MarshalEas converts the fields of struct v, or a pointer to it, which have an ea tag into EAs in the order of the fields.
+//
+// Strings and []byte are stored as they are, integers as little endian of their size(8 bytes for int, uint and uintptr in every platform),
+// bools as a byte of 0 or 1 and time.Time as 8 bytes of FILETIME, where 0 is the zero time so 1601-01-01 00:00:00 UTC can not be stored.
+// Types implementing encoding.BinaryMarshaler are stored with MarshalBinary. Nil pointers are skipped and fields with omitempty are skipped if they are zero.
+// An empty value removes the EA when written with EaWriteFile.
+func MarshalEas(v any) ([]EaInfo, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %T is not a struct", ErrMarshalEa, v)
+	}
+
+	fields, err := eaFields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	eas := make([]EaInfo, 0, len(fields))
+	for _, f := range fields {
+		fv := rv.Field(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		value, err := marshalEaValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %s: %v", ErrMarshalEa, rv.Type().Field(f.index).Name, err)
+		}
+
+		eas = append(eas, EaInfo{Flags: f.flags, EaName: f.name, EaValue: value})
+	}
+
+	return eas, nil
+}
+
+func marshalEaValue(v reflect.Value) ([]byte, error) {
+	// time.Time implements encoding.BinaryMarshaler with its own format, FILETIME is used instead
+	if v.Type() == timeType {
+		ft, err := timeToFiletime(v.Interface().(time.Time))
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(nil, ft), nil
+	}
+	if v.Type().Implements(binaryMarshalerType) {
+		return v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(binaryMarshalerType) {
+		return v.Addr().Interface().(encoding.BinaryMarshaler).MarshalBinary()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return []byte(v.String()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendUintLE(nil, uint64(v.Int()), intSize(v.Type())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendUintLE(nil, v.Uint(), intSize(v.Type())), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte{}, v.Bytes()...), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// intSize returns the size of integers of type t in EAs, int, uint and uintptr are 8 bytes so 32 bit and 64 bit builds agree.
+func intSize(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		return 8
+	}
+
+	return int(t.Size())
+}
+
+func appendUintLE(b []byte, v uint64, size int) []byte {
+	for i := 0; i < size; i++ {
+		b = append(b, byte(v>>(8*i)))
+	}
+
+	return b
+}
+
+func uintLE(b []byte) uint64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+
+	return v
+}
+
+// UnmarshalEas stores eas into the fields of the struct v points to, see MarshalEas for the formats.
+// EAs with empty value are treated as missing and leave the field untouched. An error is returned for an EA
+// with a value which does not fit into the field or a name which no field has.
+func UnmarshalEas(eas []EaInfo, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T is not a pointer to a struct", ErrMarshalEa, v)
+	}
+	rv = rv.Elem()
+
+	fields, err := eaFields(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]eaField, len(fields))
+	for _, f := range fields {
+		byName[eaNameKey(f.name)] = f
+	}
+
+	var unknown []string
+	for _, ea := range eas {
+		if len(ea.EaValue) == 0 {
+			continue
+		}
+
+		f, ok := byName[eaNameKey(ea.EaName)]
+		if !ok {
+			unknown = append(unknown, ea.EaName)
+			continue
+		}
+
+		fv := rv.Field(f.index)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+
+		if err = unmarshalEaValue(ea.EaValue, fv); err != nil {
+			return fmt.Errorf("%w: EA %s into field %s: %v", ErrMarshalEa, ea.EaName, rv.Type().Field(f.index).Name, err)
+		}
+	}
+
+	if len(unknown) != 0 {
+		return fmt.Errorf("%w: no field for EA %s", ErrMarshalEa, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+func unmarshalEaValue(b []byte, v reflect.Value) error {
+	if v.Type() == timeType {
+		if len(b) != 8 {
+			return fmt.Errorf("FILETIME should be 8 bytes, got %d", len(b))
+		}
+		t, err := filetimeToTime(binary.LittleEndian.Uint64(b))
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(binaryUnmarshalerType) {
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(b))
+		return nil
+	case reflect.Bool:
+		if len(b) != 1 || b[0] > 1 {
+			return fmt.Errorf("bool should be a byte of 0 or 1, got %x", b)
+		}
+		v.SetBool(b[0] == 1)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size := intSize(v.Type())
+		if len(b) != size {
+			return fmt.Errorf("%s should be %d bytes, got %d", v.Type(), size, len(b))
+		}
+		// sign extend from the size of the field
+		shift := 64 - 8*size
+		n := int64(uintLE(b)<<shift) >> shift
+		if v.OverflowInt(n) {
+			return fmt.Errorf("%d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		size := intSize(v.Type())
+		if len(b) != size {
+			return fmt.Errorf("%s should be %d bytes, got %d", v.Type(), size, len(b))
+		}
+		n := uintLE(b)
+		if v.OverflowUint(n) {
+			return fmt.Errorf("%d overflows %s", n, v.Type())
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(append([]byte{}, b...))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported type %s", v.Type())
+}
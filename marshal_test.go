@@ -0,0 +1,185 @@
+package ntfs_ea
+
+import (
+	"errors"
+	"math"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type marshalTestConfig struct {
+	AppVersion string     `ea:"APPVERSION,needea"`
+	Build      uint32     `ea:"BUILD"`
+	Offset     int16      `ea:"OFFSET"`
+	Enabled    bool       `ea:"ENABLED,omitempty"`
+	Updated    time.Time  `ea:"UPDATED"`
+	Blob       []byte     `ea:"BLOB,omitempty"`
+	Addr       netip.Addr `ea:"ADDR"`
+	Optional   *uint64    `ea:"OPTIONAL"`
+	Ignored    string     `ea:"-"`
+	Untagged   string
+}
+
+func TestMarshalEas(t *testing.T) {
+	updated := time.Date(2024, 5, 6, 7, 8, 9, 100, time.UTC)
+	cfg := marshalTestConfig{
+		AppVersion: "1.2.3",
+		Build:      0x01020304,
+		Offset:     -2,
+		Updated:    updated,
+		Addr:       netip.MustParseAddr("192.0.2.1"),
+		Ignored:    "ignored",
+		Untagged:   "untagged",
+	}
+
+	eas, err := MarshalEas(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []EaInfo{
+		{Flags: NeedEa, EaName: "APPVERSION", EaValue: []byte("1.2.3")},
+		{EaName: "BUILD", EaValue: []byte{4, 3, 2, 1}},
+		{EaName: "OFFSET", EaValue: []byte{0xfe, 0xff}},
+		{EaName: "UPDATED", EaValue: []byte{0x81, 0x92, 0x6c, 0x26, 0x84, 0x9f, 0xda, 0x01}},
+		{EaName: "ADDR", EaValue: []byte{192, 0, 2, 1}},
+	}
+	if !reflect.DeepEqual(eas, expected) {
+		t.Fatalf("Unexpected EAs:\n%v\nexpected:\n%v", eas, expected)
+	}
+
+	opt := uint64(7)
+	cfg.Enabled, cfg.Blob, cfg.Optional = true, []byte{0}, &opt
+	if eas, err = MarshalEas(cfg); err != nil {
+		t.Fatal(err)
+	}
+	eas = append(eas, EaInfo{EaName: "UNTAGGED"})
+
+	var decoded marshalTestConfig
+	if err = UnmarshalEas(eas, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Ignored, cfg.Untagged = "", ""
+	cfg.Updated = updated.Truncate(100 * time.Nanosecond)
+	if !reflect.DeepEqual(decoded, cfg) {
+		t.Fatalf("Unexpected value: %+v, expected %+v", decoded, cfg)
+	}
+}
+
+func TestFiletime(t *testing.T) {
+	ts := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	if ft, err := timeToFiletime(ts); err != nil || ft != filetimeEpochDiff {
+		t.Fatalf("Unexpected FILETIME %d, %v", ft, err)
+	}
+	if tm, err := filetimeToTime(filetimeEpochDiff); err != nil || !tm.Equal(ts) {
+		t.Fatalf("Unexpected time %s, %v", tm, err)
+	}
+	if ft, err := timeToFiletime(time.Time{}); err != nil || ft != 0 {
+		t.Fatal("Zero time should be 0")
+	}
+	if tm, err := filetimeToTime(0); err != nil || !tm.IsZero() {
+		t.Fatal("0 should be the zero time")
+	}
+
+	// before 1970-01-01
+	ts = time.Date(1601, 1, 1, 0, 0, 0, 100, time.UTC)
+	if ft, err := timeToFiletime(ts); err != nil || ft != 1 {
+		t.Fatalf("Unexpected FILETIME %d, %v", ft, err)
+	}
+	if tm, err := filetimeToTime(1); err != nil || !tm.Equal(ts) {
+		t.Fatalf("Unexpected time %s, %v", tm, err)
+	}
+
+	if ft, err := timeToFiletime(maxFiletime); err != nil || ft != math.MaxInt64 {
+		t.Fatalf("Unexpected FILETIME 0x%x, %v", ft, err)
+	}
+	for _, ts := range []time.Time{time.Date(1600, 12, 31, 23, 59, 59, 0, time.UTC), maxFiletime.Add(time.Microsecond)} {
+		if _, err := timeToFiletime(ts); err == nil {
+			t.Fatalf("Expected error for %s", ts)
+		}
+	}
+	if _, err := filetimeToTime(math.MaxInt64 + 1); err == nil {
+		t.Fatal("Expected error for FILETIME with the sign bit")
+	}
+}
+
+func TestMarshalEasErrors(t *testing.T) {
+	for _, v := range []any{
+		1,
+		struct {
+			Bad string `ea:"A*B"`
+		}{},
+		struct {
+			A string `ea:"NAME"`
+			B string `ea:"name"`
+		}{},
+		struct {
+			A string `ea:"NAME,unknown"`
+		}{},
+		struct {
+			A float64 `ea:"FLOAT"`
+		}{},
+		struct {
+			T time.Time `ea:"TIME"`
+		}{time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		if _, err := MarshalEas(v); !errors.Is(err, ErrMarshalEa) {
+			t.Fatalf("Expected ErrMarshalEa for %#v, got %v", v, err)
+		}
+	}
+
+	var cfg marshalTestConfig
+	for _, eas := range [][]EaInfo{
+		{{EaName: "BUILD", EaValue: []byte{1}}},
+		{{EaName: "ENABLED", EaValue: []byte{2}}},
+		{{EaName: "UPDATED", EaValue: []byte{1, 2, 3}}},
+		{{EaName: "UNKNOWN", EaValue: []byte{1}}},
+	} {
+		if err := UnmarshalEas(eas, &cfg); !errors.Is(err, ErrMarshalEa) {
+			t.Fatalf("Expected ErrMarshalEa for %v, got %v", eas, err)
+		}
+	}
+
+	if err := UnmarshalEas(nil, cfg); !errors.Is(err, ErrMarshalEa) {
+		t.Fatalf("Expected ErrMarshalEa for non-pointer, got %v", err)
+	}
+
+	// missing EAs leave fields untouched
+	cfg.AppVersion = "keep"
+	if err := UnmarshalEas([]EaInfo{{EaName: "APPVERSION"}}, &cfg); err != nil || cfg.AppVersion != "keep" {
+		t.Fatalf("Unexpected result: %q, %v", cfg.AppVersion, err)
+	}
+}
+
+func TestMarshalEasNativeInt(t *testing.T) {
+	type native struct {
+		Int  int     `ea:"INT"`
+		Uint uint    `ea:"UINT"`
+		Ptr  uintptr `ea:"PTR"`
+	}
+
+	eas, err := MarshalEas(native{Int: -1, Uint: 1, Ptr: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ea := range eas {
+		if len(ea.EaValue) != 8 {
+			t.Fatalf("%s should be 8 bytes in every platform, got %x", ea.EaName, ea.EaValue)
+		}
+	}
+
+	var v native
+	if err = UnmarshalEas(eas, &v); err != nil || v.Int != -1 || v.Uint != 1 || v.Ptr != 2 {
+		t.Fatalf("Unexpected result: %+v, %v", v, err)
+	}
+
+	// a value out of the native width is an error in 32 bit builds
+	big := []EaInfo{{EaName: "INT", EaValue: []byte{0, 0, 0, 0, 1, 0, 0, 0}}}
+	if err = UnmarshalEas(big, &v); (strconv.IntSize == 32) != (err != nil) {
+		t.Fatalf("Unexpected result for %d bit int: %+v, %v", strconv.IntSize, v, err)
+	}
+}
@@ -14,87 +14,8 @@ import (
 	"golang.org/x/sys/windows"
 
 	"github.com/Snshadow/ntfs-ea/internal/w32api"
-	"github.com/nyaosorg/go-windows-mbcs"
 )
 
-const (
-	NeedEa = w32api.FILE_NEED_EA
-
-	fullInfoHeaderSize = 8 // 4 + 1 + 1 + 2
-	getInfoHeaderSize  = 5 // 4 + 1
-)
-
-// EaInfo is a simplified struct of FILE_FULL_EA_INFORMATION, see https://learn.microsoft.com/en-us/windows-hardware/drivers/ddi/wdm/ns-wdm-_file_full_ea_information
-type EaInfo struct {
-	Flags   uint8
-	EaName  string
-	EaValue []byte
-}
-
-func strToEaNameBuffer(s string) ([]int8, error) {
-	buf, err := mbcs.Utf8ToAnsi(s, 0)
-	if err != nil {
-		return nil, err
-	}
-
-	eaName := unsafe.Slice((*int8)(unsafe.Pointer(&buf[0])), len(buf))
-
-	return eaName, nil
-}
-
-func convertToFullInfoBuf(arr []EaInfo) ([]byte, error) {
-	var wholeInfoLen uint32
-	var wholeBuf bytes.Buffer
-
-	for i := range arr {
-		eaEnt := arr[i]
-		eaName, err := strToEaNameBuffer(eaEnt.EaName)
-		if err != nil {
-			return nil, err
-		}
-
-		if len(eaName) > 0xff {
-			return nil, fmt.Errorf("EA name is too long")
-		}
-
-		fullInfoLen := fullInfoHeaderSize + uint32(len(eaName)) + 1 + uint32(len(eaEnt.EaValue)) // add 1 for null terminator
-		padSize := fullInfoLen & 3 // for adding zeros to end to entry
-		if padSize != 0 {
-			fullInfoLen += 4 - padSize // align by 4 bytes, in case of entries are buffered
-		}
-		wholeInfoLen += fullInfoLen
-
-		if wholeInfoLen > 0xffff {
-			// if the total size of EA info is larger than 64KB bytes, this EaSetEaFile fails with STATUS_EA_TOO_LARGE,
-			// if it goes a lot larger(potential bug(?)), it will write the data up to the limit without erroring, 
-			// causing inconsistent data
-			return nil, fmt.Errorf("EA info data is larger than 64KB")
-		}
-
-		buf := make([]byte, fullInfoLen)
-		fullEa := (*w32api.FILE_FULL_EA_INFORMATION)(unsafe.Pointer(&buf[0]))
-
-		fullEa.Flags = eaEnt.Flags
-		fullEa.EaNameLength = uint8(len(eaName))
-		fullEa.EaValueLength = uint16(len(eaEnt.EaValue))
-
-		if i < len(arr) - 1 {
-			fullEa.NextEntryOffset = fullInfoLen
-		}
-
-		wholeBuf.Write(buf[:fullInfoHeaderSize])
-		wholeBuf.Write(unsafe.Slice((*byte)(unsafe.Pointer(&eaName[0])), len(eaName)))
-		wholeBuf.WriteByte(0) // null terminator
-		wholeBuf.Write(eaEnt.EaValue)
-
-		if padSize > 0 {
-			wholeBuf.Write(make([]byte, 4-padSize))
-		}
-	}
-
-	return wholeBuf.Bytes(), nil
-}
-
 // EaWriteFile writes EA info into the given path by converting the given eaInfo into buffer that can be used by NtSetEaFile.
 // Writing EA with no content will remove the EA with the according EaName if exists, do nothing if the file do not have EA with EaName.
 func EaWriteFile(dstPath string, followReparsePoint bool, eaInfo ...EaInfo) error {
@@ -179,6 +100,7 @@ EXIT:
 }
 
 // WriteEaWithFile writes EA into file in dst using the content of the given file in src with the given name and flags.
+// For the content larger than a single EA can hold, use WriteChunkedEaWithFile.
 func WriteEaWithFile(dst string, followReparsePoint bool, src string, name string, flags uint8) error {
 	buf, err := os.ReadFile(src)
 	if err != nil {
@@ -206,6 +128,11 @@ func WriteEaWithFile(dst string, followReparsePoint bool, src string, name strin
 // QueryFileEa queries all EAs in the file in given path and return EaInfo slice which has flag, name, and value of EA.
 // If queryName is specified, will only query for EAs that have EaName included in queryName.
 func QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]EaInfo, error) {
+	return queryFileEa(path, followReparsePoint, false, queryName...)
+}
+
+// queryFileEa is QueryFileEa which does not print a message for a file without EA if quiet is set.
+func queryFileEa(path string, followReparsePoint bool, quiet bool, queryName ...string) ([]EaInfo, error) {
 	var err error
 
 	var isb windows.IO_STATUS_BLOCK
@@ -262,7 +189,6 @@ func QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]E
 
 	var eaSize uint32
 	var eaInfoArr []EaInfo
-	var eaInfoPtr *w32api.FILE_FULL_EA_INFORMATION
 	buf, eaIndex := []byte(nil), uint32(0)
 	var eaIndexPtr *uint32
 
@@ -275,7 +201,9 @@ func QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]E
 	if err != nil {
 		eaSize = 0xffff // just set it to maximum value
 	} else if sz.EaSize == 0 {
-		fmt.Fprintf(os.Stderr, "%s does not have any EA\n", path)
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "%s does not have any EA\n", path)
+		}
 		goto EXIT
 	} else {
 		eaSize = sz.EaSize
@@ -331,29 +259,10 @@ func QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]E
 		return nil, err
 	}
 
-	eaInfoPtr = (*w32api.FILE_FULL_EA_INFORMATION)(unsafe.Pointer(&buf[0]))
-	for {
-		eaInfo := EaInfo{
-			Flags: eaInfoPtr.Flags,
-		}
-
-		nameBuf := unsafe.Slice((*byte)(unsafe.Pointer(&eaInfoPtr.EaName[0])), eaInfoPtr.EaNameLength)
-		name, err := mbcs.AnsiToUtf8(nameBuf, 0)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "failed to get name of EA:", err)
-		} else {
-			eaInfo.EaName = name
-		}
-
-		eaInfo.EaValue = make([]byte, eaInfoPtr.EaValueLength)
-		copy(eaInfo.EaValue, unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(&eaInfoPtr.EaName[0]), eaInfoPtr.EaNameLength+1)), eaInfoPtr.EaValueLength))
-
-		eaInfoArr = append(eaInfoArr, eaInfo)
-		if eaInfoPtr.NextEntryOffset == 0 {
-			break
-		}
-
-		eaInfoPtr = (*w32api.FILE_FULL_EA_INFORMATION)(unsafe.Add(unsafe.Pointer(eaInfoPtr), eaInfoPtr.NextEntryOffset))
+	eaInfoArr, err = parseFullInfoBuf(buf)
+	if err != nil {
+		w32api.NtClose(fHnd)
+		return nil, fmt.Errorf("failed to parse EA buffer: %w", err)
 	}
 
 EXIT:
@@ -0,0 +1,202 @@
+package ntfs_ea
+
+import "fmt"
+
+// Names of standard OS/2 extended attributes.
+const (
+	LongNameEaName   = ".LONGNAME"   // EAT_ASCII, long name of the file on a FAT volume
+	TypeEaName       = ".TYPE"       // EAT_MVMT of EAT_ASCII, file types e.g. "Plain Text"
+	SubjectEaName    = ".SUBJECT"    // EAT_ASCII, short description
+	CommentsEaName   = ".COMMENTS"   // EAT_MVMT of EAT_ASCII, lines of comments
+	KeyphrasesEaName = ".KEYPHRASES" // EAT_MVMT of EAT_ASCII, key phrases for searching
+	HistoryEaName    = ".HISTORY"    // EAT_MVMT of EAT_ASCII, modification history
+	VersionEaName    = ".VERSION"    // EAT_ASCII, version of the file format
+	IconEaName       = ".ICON"       // EAT_ICON, icon of the file
+)
+
+// OS/2 accessors
+//
+// Get functions return ErrEaNotFound if the EA does not exist, Set functions remove the EA when given an empty value.
+// DefaultStore() is used if store is nil. Strings are kept as bytes in the code page of the writer.
+
+func getTypedEa(path string, followReparsePoint bool, store EaStore, name string) (TypedValue, error) {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return TypedValue{}, err
+	}
+
+	ea, err := queryEa(store, path, followReparsePoint, name)
+	if err != nil {
+		return TypedValue{}, err
+	}
+
+	v, err := ea.TypedValue()
+	if err != nil {
+		return TypedValue{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return v, nil
+}
+
+func setTypedEa(path string, followReparsePoint bool, store EaStore, name string, v *TypedValue) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	ea := EaInfo{EaName: name}
+	if v != nil {
+		if ea, err = NewTypedEa(name, 0, *v); err != nil {
+			return err
+		}
+	}
+
+	return store.EaWriteFile(path, followReparsePoint, ea)
+}
+
+func getStringEa(path string, followReparsePoint bool, store EaStore, name string) (string, error) {
+	v, err := getTypedEa(path, followReparsePoint, store, name)
+	if err != nil {
+		return "", err
+	}
+
+	return v.Text("\n"), nil
+}
+
+func setStringEa(path string, followReparsePoint bool, store EaStore, name, s string) error {
+	if s == "" {
+		return setTypedEa(path, followReparsePoint, store, name, nil)
+	}
+
+	v := ASCIIValue(s)
+
+	return setTypedEa(path, followReparsePoint, store, name, &v)
+}
+
+// getStringsEa returns each value of a multi-valued EA, a single valued EA is returned as a slice with one string.
+func getStringsEa(path string, followReparsePoint bool, store EaStore, name string) ([]string, error) {
+	v, err := getTypedEa(path, followReparsePoint, store, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !v.Type.IsMultiValued() {
+		return []string{string(v.Data)}, nil
+	}
+
+	strs := make([]string, 0, len(v.Values))
+	for _, value := range v.Values {
+		strs = append(strs, value.Text("\n"))
+	}
+
+	return strs, nil
+}
+
+func setStringsEa(path string, followReparsePoint bool, store EaStore, name string, strs []string) error {
+	if len(strs) == 0 {
+		return setTypedEa(path, followReparsePoint, store, name, nil)
+	}
+
+	values := make([]TypedValue, 0, len(strs))
+	for _, s := range strs {
+		values = append(values, ASCIIValue(s))
+	}
+	v := MVMTValue(values...)
+
+	return setTypedEa(path, followReparsePoint, store, name, &v)
+}
+
+// GetLongName returns .LONGNAME of the file in path.
+func GetLongName(path string, followReparsePoint bool, store EaStore) (string, error) {
+	return getStringEa(path, followReparsePoint, store, LongNameEaName)
+}
+
+// SetLongName writes .LONGNAME into the file in path.
+func SetLongName(path string, followReparsePoint bool, store EaStore, name string) error {
+	return setStringEa(path, followReparsePoint, store, LongNameEaName, name)
+}
+
+// GetSubject returns .SUBJECT of the file in path.
+func GetSubject(path string, followReparsePoint bool, store EaStore) (string, error) {
+	return getStringEa(path, followReparsePoint, store, SubjectEaName)
+}
+
+// SetSubject writes .SUBJECT into the file in path.
+func SetSubject(path string, followReparsePoint bool, store EaStore, subject string) error {
+	return setStringEa(path, followReparsePoint, store, SubjectEaName, subject)
+}
+
+// GetVersion returns .VERSION of the file in path.
+func GetVersion(path string, followReparsePoint bool, store EaStore) (string, error) {
+	return getStringEa(path, followReparsePoint, store, VersionEaName)
+}
+
+// SetVersion writes .VERSION into the file in path.
+func SetVersion(path string, followReparsePoint bool, store EaStore, version string) error {
+	return setStringEa(path, followReparsePoint, store, VersionEaName, version)
+}
+
+// GetTypes returns file types in .TYPE of the file in path.
+func GetTypes(path string, followReparsePoint bool, store EaStore) ([]string, error) {
+	return getStringsEa(path, followReparsePoint, store, TypeEaName)
+}
+
+// SetTypes writes file types into .TYPE of the file in path.
+func SetTypes(path string, followReparsePoint bool, store EaStore, types []string) error {
+	return setStringsEa(path, followReparsePoint, store, TypeEaName, types)
+}
+
+// GetComments returns lines in .COMMENTS of the file in path.
+func GetComments(path string, followReparsePoint bool, store EaStore) ([]string, error) {
+	return getStringsEa(path, followReparsePoint, store, CommentsEaName)
+}
+
+// SetComments writes lines into .COMMENTS of the file in path.
+func SetComments(path string, followReparsePoint bool, store EaStore, comments []string) error {
+	return setStringsEa(path, followReparsePoint, store, CommentsEaName, comments)
+}
+
+// GetKeyphrases returns .KEYPHRASES of the file in path.
+func GetKeyphrases(path string, followReparsePoint bool, store EaStore) ([]string, error) {
+	return getStringsEa(path, followReparsePoint, store, KeyphrasesEaName)
+}
+
+// SetKeyphrases writes .KEYPHRASES into the file in path.
+func SetKeyphrases(path string, followReparsePoint bool, store EaStore, keyphrases []string) error {
+	return setStringsEa(path, followReparsePoint, store, KeyphrasesEaName, keyphrases)
+}
+
+// GetHistory returns entries in .HISTORY of the file in path.
+func GetHistory(path string, followReparsePoint bool, store EaStore) ([]string, error) {
+	return getStringsEa(path, followReparsePoint, store, HistoryEaName)
+}
+
+// SetHistory writes entries into .HISTORY of the file in path.
+func SetHistory(path string, followReparsePoint bool, store EaStore, history []string) error {
+	return setStringsEa(path, followReparsePoint, store, HistoryEaName, history)
+}
+
+// GetIcon returns the raw icon data in .ICON of the file in path.
+func GetIcon(path string, followReparsePoint bool, store EaStore) ([]byte, error) {
+	v, err := getTypedEa(path, followReparsePoint, store, IconEaName)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Type != EatIcon {
+		return nil, fmt.Errorf("%w: %s has %s instead of EAT_ICON", ErrTypedValue, IconEaName, v.Type)
+	}
+
+	return v.Data, nil
+}
+
+// SetIcon writes the raw icon data into .ICON of the file in path.
+func SetIcon(path string, followReparsePoint bool, store EaStore, icon []byte) error {
+	if len(icon) == 0 {
+		return setTypedEa(path, followReparsePoint, store, IconEaName, nil)
+	}
+
+	v := TypedValue{Type: EatIcon, Data: icon}
+
+	return setTypedEa(path, followReparsePoint, store, IconEaName, &v)
+}
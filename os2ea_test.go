@@ -0,0 +1,66 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOS2Accessors(t *testing.T) {
+	root := createTestTree(t, "README.TXT")
+	target := filepath.Join(root, "README.TXT")
+	store := NewMemStore()
+
+	if _, err := GetLongName(target, false, store); !errors.Is(err, ErrEaNotFound) {
+		t.Fatalf("Expected ErrEaNotFound, got %v", err)
+	}
+
+	if err := SetLongName(target, false, store, "Read me first.txt"); err != nil {
+		t.Fatalf("SetLongName failed: %v", err)
+	}
+	if err := SetTypes(target, false, store, []string{"Plain Text", "DOS Command File"}); err != nil {
+		t.Fatalf("SetTypes failed: %v", err)
+	}
+	if err := SetIcon(target, false, store, []byte("icon data")); err != nil {
+		t.Fatalf("SetIcon failed: %v", err)
+	}
+
+	name, err := GetLongName(target, false, store)
+	if err != nil || name != "Read me first.txt" {
+		t.Fatalf("Unexpected .LONGNAME: %q, %v", name, err)
+	}
+
+	types, err := GetTypes(target, false, store)
+	if err != nil || !reflect.DeepEqual(types, []string{"Plain Text", "DOS Command File"}) {
+		t.Fatalf("Unexpected .TYPE: %q, %v", types, err)
+	}
+
+	icon, err := GetIcon(target, false, store)
+	if err != nil || !bytes.Equal(icon, []byte("icon data")) {
+		t.Fatalf("Unexpected .ICON: %q, %v", icon, err)
+	}
+
+	raw, _ := store.QueryFileEa(target, false, ".LONGNAME")
+	if !bytes.Equal(raw[0].EaValue, append([]byte{0xfd, 0xff, 0x11, 0x00}, "Read me first.txt"...)) {
+		t.Fatalf("Unexpected .LONGNAME value: % x", raw[0].EaValue)
+	}
+
+	// a single valued .COMMENTS written by other tools is returned as one line
+	v := ASCIIValue("single comment")
+	if err = setTypedEa(target, false, store, CommentsEaName, &v); err != nil {
+		t.Fatalf("setTypedEa failed: %v", err)
+	}
+	comments, err := GetComments(target, false, store)
+	if err != nil || !reflect.DeepEqual(comments, []string{"single comment"}) {
+		t.Fatalf("Unexpected .COMMENTS: %q, %v", comments, err)
+	}
+
+	if err = SetLongName(target, false, store, ""); err != nil {
+		t.Fatalf("SetLongName failed: %v", err)
+	}
+	if _, err = GetLongName(target, false, store); !errors.Is(err, ErrEaNotFound) {
+		t.Fatalf("Expected .LONGNAME to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// EaType is the type of an OS/2 typed EA value, stored as the first 2 bytes of the value in little endian.
+type EaType uint16
+
+// OS/2 EA types, see EAT_* in bsedos.h of OS/2 toolkit.
+const (
+	EatBinary   EaType = 0xfffe // length preceded binary data
+	EatASCII    EaType = 0xfffd // length preceded ASCII text, not null terminated
+	EatBitmap   EaType = 0xfffb // length preceded bitmap
+	EatMetafile EaType = 0xfffa // length preceded metafile
+	EatIcon     EaType = 0xfff9 // length preceded icon
+	EatEA       EaType = 0xffee // length preceded ASCII name of an associated EA
+	EatMVMT     EaType = 0xffdf // multi-valued, multi-typed field
+	EatMVST     EaType = 0xffde // multi-valued, single-typed field
+	EatASN1     EaType = 0xffdd // length preceded ASN.1 field
+)
+
+// maxTypedValueDepth limits nesting of multi-valued fields when decoding.
+const maxTypedValueDepth = 16
+
+// ErrTypedValue is returned when an OS/2 typed EA value can not be decoded or encoded.
+var ErrTypedValue = errors.New("invalid OS/2 typed EA value")
+
+func (t EaType) String() string {
+	switch t {
+	case EatBinary:
+		return "EAT_BINARY"
+	case EatASCII:
+		return "EAT_ASCII"
+	case EatBitmap:
+		return "EAT_BITMAP"
+	case EatMetafile:
+		return "EAT_METAFILE"
+	case EatIcon:
+		return "EAT_ICON"
+	case EatEA:
+		return "EAT_EA"
+	case EatMVMT:
+		return "EAT_MVMT"
+	case EatMVST:
+		return "EAT_MVST"
+	case EatASN1:
+		return "EAT_ASN1"
+	}
+
+	return fmt.Sprintf("EaType(0x%04x)", uint16(t))
+}
+
+// IsMultiValued reports whether t is EAT_MVMT or EAT_MVST.
+func (t EaType) IsMultiValued() bool {
+	return t == EatMVMT || t == EatMVST
+}
+
+// TypedValue is an OS/2 typed EA value.
+//
+// Values other than EAT_MVMT and EAT_MVST are stored as type, 2 bytes length and Data.
+// EAT_MVMT is stored as type, CodePage, 2 bytes count of Values and each value with its own type.
+// EAT_MVST is stored as type, CodePage, 2 bytes count of Values, the type shared by all Values and each value without type.
+// Multi-valued fields can be nested in both of them.
+type TypedValue struct {
+	Type     EaType
+	Data     []byte
+	CodePage uint16       // code page of multi-valued fields, 0 for the default
+	Values   []TypedValue // values of multi-valued fields
+}
+
+// ASCIIValue returns EAT_ASCII value with s.
+func ASCIIValue(s string) TypedValue {
+	return TypedValue{Type: EatASCII, Data: []byte(s)}
+}
+
+// BinaryValue returns EAT_BINARY value with b.
+func BinaryValue(b []byte) TypedValue {
+	return TypedValue{Type: EatBinary, Data: b}
+}
+
+// MVMTValue returns EAT_MVMT value with values of any type.
+func MVMTValue(values ...TypedValue) TypedValue {
+	return TypedValue{Type: EatMVMT, Values: values}
+}
+
+// MVSTValue returns EAT_MVST value with values, all of them should have the same type.
+func MVSTValue(values ...TypedValue) TypedValue {
+	return TypedValue{Type: EatMVST, Values: values}
+}
+
+// Text returns Data as string, or Data of each value joined with sep for multi-valued fields.
+func (v TypedValue) Text(sep string) string {
+	if !v.Type.IsMultiValued() {
+		return string(v.Data)
+	}
+
+	var buf bytes.Buffer
+	for i, value := range v.Values {
+		if i != 0 {
+			buf.WriteString(sep)
+		}
+		buf.WriteString(value.Text(sep))
+	}
+
+	return buf.String()
+}
+
+// Encode returns v in the OS/2 typed EA value format.
+func (v TypedValue) Encode() ([]byte, error) {
+	buf := binary.LittleEndian.AppendUint16(nil, uint16(v.Type))
+
+	return v.appendBody(buf)
+}
+
+// appendBody appends v without its type.
+func (v TypedValue) appendBody(buf []byte) ([]byte, error) {
+	if !v.Type.IsMultiValued() {
+		if len(v.Data) > 0xffff {
+			return nil, fmt.Errorf("%w: %s data of %d bytes is too long", ErrTypedValue, v.Type, len(v.Data))
+		}
+
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(v.Data)))
+
+		return append(buf, v.Data...), nil
+	}
+
+	if len(v.Values) > 0xffff {
+		return nil, fmt.Errorf("%w: too many values in %s", ErrTypedValue, v.Type)
+	}
+
+	buf = binary.LittleEndian.AppendUint16(buf, v.CodePage)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(v.Values)))
+
+	if v.Type == EatMVST {
+		var elemType EaType
+		if len(v.Values) != 0 {
+			elemType = v.Values[0].Type
+		}
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(elemType))
+
+		for _, value := range v.Values {
+			if value.Type != elemType {
+				return nil, fmt.Errorf("%w: EAT_MVST has values of %s and %s", ErrTypedValue, elemType, value.Type)
+			}
+
+			var err error
+			if buf, err = value.appendBody(buf); err != nil {
+				return nil, err
+			}
+		}
+
+		return buf, nil
+	}
+
+	for _, value := range v.Values {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(value.Type))
+
+		var err error
+		if buf, err = value.appendBody(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf, nil
+}
+
+// DecodeTypedValue decodes b in the OS/2 typed EA value format, b should not have trailing bytes.
+func DecodeTypedValue(b []byte) (TypedValue, error) {
+	if len(b) < 2 {
+		return TypedValue{}, fmt.Errorf("%w: too short for type", ErrTypedValue)
+	}
+
+	v, n, err := decodeTypedBody(EaType(binary.LittleEndian.Uint16(b)), b[2:], 0)
+	if err != nil {
+		return TypedValue{}, err
+	}
+	if 2+n != len(b) {
+		return TypedValue{}, fmt.Errorf("%w: %d trailing bytes", ErrTypedValue, len(b)-2-n)
+	}
+
+	return v, nil
+}
+
+// decodeTypedBody decodes the value of type t at the start of b and returns the number of bytes read.
+func decodeTypedBody(t EaType, b []byte, depth int) (TypedValue, int, error) {
+	v := TypedValue{Type: t}
+
+	if !t.IsMultiValued() {
+		if len(b) < 2 {
+			return v, 0, fmt.Errorf("%w: too short for length of %s", ErrTypedValue, t)
+		}
+
+		l := int(binary.LittleEndian.Uint16(b))
+		if len(b) < 2+l {
+			return v, 0, fmt.Errorf("%w: %s data of %d bytes exceeds the value", ErrTypedValue, t, l)
+		}
+		v.Data = append([]byte(nil), b[2:2+l]...)
+
+		return v, 2 + l, nil
+	}
+
+	if depth >= maxTypedValueDepth {
+		return v, 0, fmt.Errorf("%w: multi-valued fields are nested too deep", ErrTypedValue)
+	}
+
+	hdrLen := 4
+	if t == EatMVST {
+		hdrLen = 6
+	}
+	if len(b) < hdrLen {
+		return v, 0, fmt.Errorf("%w: too short for header of %s", ErrTypedValue, t)
+	}
+
+	v.CodePage = binary.LittleEndian.Uint16(b)
+	count := int(binary.LittleEndian.Uint16(b[2:]))
+	n := hdrLen
+
+	var elemType EaType
+	if t == EatMVST {
+		elemType = EaType(binary.LittleEndian.Uint16(b[4:]))
+	}
+
+	for i := 0; i < count; i++ {
+		if t == EatMVMT {
+			if len(b) < n+2 {
+				return v, 0, fmt.Errorf("%w: too short for type of value %d in %s", ErrTypedValue, i, t)
+			}
+			elemType = EaType(binary.LittleEndian.Uint16(b[n:]))
+			n += 2
+		}
+
+		value, l, err := decodeTypedBody(elemType, b[n:], depth+1)
+		if err != nil {
+			return v, 0, err
+		}
+
+		v.Values = append(v.Values, value)
+		n += l
+	}
+
+	return v, n, nil
+}
+
+// TypedValue decodes EaValue as OS/2 typed EA value.
+func (ea EaInfo) TypedValue() (TypedValue, error) {
+	return DecodeTypedValue(ea.EaValue)
+}
+
+// NewTypedEa returns EaInfo with v encoded as OS/2 typed EA value.
+func NewTypedEa(name string, flags uint8, v TypedValue) (EaInfo, error) {
+	value, err := v.Encode()
+	if err != nil {
+		return EaInfo{}, err
+	}
+
+	return EaInfo{Flags: flags, EaName: name, EaValue: value}, nil
+}
@@ -0,0 +1,68 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTypedValue(t *testing.T) {
+	// .TYPE with two types as written by OS/2 Workplace Shell
+	typeEa := []byte{
+		0xdf, 0xff, 0x00, 0x00, 0x02, 0x00,
+		0xfd, 0xff, 0x0a, 0x00, 'P', 'l', 'a', 'i', 'n', ' ', 'T', 'e', 'x', 't',
+		0xfd, 0xff, 0x03, 0x00, 'C', 'm', 'd',
+	}
+
+	v, err := DecodeTypedValue(typeEa)
+	if err != nil {
+		t.Fatalf("DecodeTypedValue failed: %v", err)
+	}
+
+	expected := MVMTValue(ASCIIValue("Plain Text"), ASCIIValue("Cmd"))
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Decoded value mismatch: got %+v", v)
+	}
+	if v.Text(",") != "Plain Text,Cmd" {
+		t.Fatalf("Unexpected text: %q", v.Text(","))
+	}
+
+	encoded, err := expected.Encode()
+	if err != nil || !bytes.Equal(encoded, typeEa) {
+		t.Fatalf("Encoded value mismatch: % x, %v", encoded, err)
+	}
+
+	nested := MVMTValue(
+		BinaryValue([]byte{1, 2, 3}),
+		TypedValue{Type: EatMVST, CodePage: 437, Values: []TypedValue{ASCIIValue("a"), ASCIIValue("bc")}},
+		TypedValue{Type: EatASN1, Data: []byte{0x02, 0x01, 0x05}},
+	)
+
+	ea, err := NewTypedEa(".HISTORY", NeedEa, nested)
+	if err != nil {
+		t.Fatalf("NewTypedEa failed: %v", err)
+	}
+
+	decoded, err := ea.TypedValue()
+	if err != nil || !reflect.DeepEqual(decoded, nested) {
+		t.Fatalf("Nested value mismatch: got %+v, %v", decoded, err)
+	}
+}
+
+func TestTypedValueErrors(t *testing.T) {
+	for _, b := range [][]byte{
+		{0xfd},
+		{0xfd, 0xff, 0x05, 0x00, 'a'},
+		{0xfd, 0xff, 0x01, 0x00, 'a', 'b'},
+		{0xdf, 0xff, 0x00, 0x00, 0x02, 0x00, 0xfd, 0xff, 0x00, 0x00},
+	} {
+		if _, err := DecodeTypedValue(b); !errors.Is(err, ErrTypedValue) {
+			t.Fatalf("Expected ErrTypedValue for % x, got %v", b, err)
+		}
+	}
+
+	if _, err := MVSTValue(ASCIIValue("a"), BinaryValue([]byte("b"))).Encode(); !errors.Is(err, ErrTypedValue) {
+		t.Fatalf("Expected ErrTypedValue for EAT_MVST with mixed types, got %v", err)
+	}
+}
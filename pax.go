@@ -0,0 +1,184 @@
+package ntfs_ea
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PAX records for EAs
+//
+// Each EA is stored in "NTFSEA.ea.<EA name>" with the value in standard base64, and its flags in "NTFSEA.flags.<EA name>"
+// in decimal when they are not 0. EA names can not have '=' or control characters, so they are used in keys as they are.
+//
+// Archivers on Linux store the whole EA set of files in ntfs-3g mounts as the system.ntfs_ea extended attribute,
+// in "SCHILY.xattr.system.ntfs_ea" as raw bytes by GNU tar and in "LIBARCHIVE.xattr.system.ntfs_ea" as base64 by bsdtar.
+// Both of them are read if there is no NTFSEA record, and the former is written with PaxEaOptions.Ntfs3gXattr
+// so that GNU tar --xattrs restores EAs into an ntfs-3g mount.
+const (
+	PaxEaPrefix      = "NTFSEA.ea."
+	PaxEaFlagsPrefix = "NTFSEA.flags."
+
+	paxSchilyXattrPrefix     = "SCHILY.xattr."
+	paxLibarchiveXattrPrefix = "LIBARCHIVE.xattr."
+	ntfs3gEaXattr            = "system.ntfs_ea" // the same as XattrNtfsEa, which is only defined for Linux
+)
+
+// PaxEaOptions configures SetTarHeaderEas.
+type PaxEaOptions struct {
+	Ntfs3gXattr bool // also store the EA set in SCHILY.xattr.system.ntfs_ea
+}
+
+// SetTarHeaderEas stores eas into PAXRecords of hdr and sets hdr.Format to PAX, EAs with empty value are skipped.
+// NTFSEA records already in hdr are replaced.
+func SetTarHeaderEas(hdr *tar.Header, eas []EaInfo, opts *PaxEaOptions) error {
+	if opts == nil {
+		opts = &PaxEaOptions{}
+	}
+
+	var set []EaInfo
+	for _, ea := range eas {
+		if len(ea.EaValue) == 0 {
+			continue
+		}
+		if err := ValidateEaName(ea.EaName); err != nil {
+			return err
+		}
+		set = append(set, ea)
+	}
+
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, PaxEaPrefix) || strings.HasPrefix(key, PaxEaFlagsPrefix) {
+			delete(hdr.PAXRecords, key)
+		}
+	}
+
+	if len(set) == 0 {
+		return nil
+	}
+
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = make(map[string]string)
+	}
+
+	for _, ea := range set {
+		hdr.PAXRecords[PaxEaPrefix+ea.EaName] = base64.StdEncoding.EncodeToString(ea.EaValue)
+		if ea.Flags != 0 {
+			hdr.PAXRecords[PaxEaFlagsPrefix+ea.EaName] = strconv.Itoa(int(ea.Flags))
+		}
+	}
+
+	if opts.Ntfs3gXattr {
+		buf, err := convertToFullInfoBuf(set)
+		if err != nil {
+			return err
+		}
+		hdr.PAXRecords[paxSchilyXattrPrefix+ntfs3gEaXattr] = string(buf)
+	}
+
+	hdr.Format = tar.FormatPAX
+
+	return nil
+}
+
+// TarHeaderEas returns EAs stored in PAXRecords of hdr sorted by name, see SetTarHeaderEas.
+// The EA set of ntfs-3g stored by GNU tar or bsdtar is returned if there is no NTFSEA record.
+func TarHeaderEas(hdr *tar.Header) ([]EaInfo, error) {
+	var eas []EaInfo
+
+	for key, value := range hdr.PAXRecords {
+		name := strings.TrimPrefix(key, PaxEaPrefix)
+		if name == key {
+			continue
+		}
+
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PAX record %s: %w", key, err)
+		}
+
+		ea := EaInfo{EaName: name, EaValue: b}
+		if flags, ok := hdr.PAXRecords[PaxEaFlagsPrefix+name]; ok {
+			f, err := strconv.ParseUint(flags, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PAX record %s: %w", PaxEaFlagsPrefix+name, err)
+			}
+			ea.Flags = uint8(f)
+		}
+
+		eas = append(eas, ea)
+	}
+
+	if len(eas) == 0 {
+		return ntfs3gEasFromPAXRecords(hdr.PAXRecords)
+	}
+
+	sort.Slice(eas, func(i, j int) bool {
+		return eaNameKey(eas[i].EaName) < eaNameKey(eas[j].EaName)
+	})
+
+	return eas, nil
+}
+
+// ntfs3gEasFromPAXRecords returns the EA set in system.ntfs_ea stored by GNU tar or bsdtar.
+func ntfs3gEasFromPAXRecords(records map[string]string) ([]EaInfo, error) {
+	if value, ok := records[paxSchilyXattrPrefix+ntfs3gEaXattr]; ok {
+		return parseFullInfoBuf([]byte(value))
+	}
+
+	for key, value := range records {
+		name := strings.TrimPrefix(key, paxLibarchiveXattrPrefix)
+		if name == key {
+			continue
+		}
+		// bsdtar escapes names with percent encoding and omits padding of base64
+		if name, err := url.PathUnescape(name); err != nil || name != ntfs3gEaXattr {
+			continue
+		}
+
+		b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PAX record %s: %w", key, err)
+		}
+
+		return parseFullInfoBuf(b)
+	}
+
+	return nil, nil
+}
+
+// AddFileEasToTarHeader queries EAs of the file in path and stores them into hdr with SetTarHeaderEas.
+// DefaultStore() is used if store is nil.
+func AddFileEasToTarHeader(hdr *tar.Header, path string, followReparsePoint bool, store EaStore, opts *PaxEaOptions) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	eas, err := store.QueryFileEa(path, followReparsePoint)
+	if err != nil {
+		return err
+	}
+
+	return SetTarHeaderEas(hdr, eas, opts)
+}
+
+// RestoreTarHeaderEas writes EAs stored in hdr into the extracted file in path, nothing is written if hdr has no EA.
+// DefaultStore() is used if store is nil.
+func RestoreTarHeaderEas(hdr *tar.Header, path string, followReparsePoint bool, store EaStore) error {
+	eas, err := TarHeaderEas(hdr)
+	if err != nil || len(eas) == 0 {
+		return err
+	}
+
+	store, err = storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	return store.EaWriteFile(path, followReparsePoint, eas...)
+}
@@ -0,0 +1,119 @@
+package ntfs_ea
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestTarHeaderEas(t *testing.T) {
+	eas := []EaInfo{
+		{EaName: "APPVERSION", EaValue: []byte("1.0")},
+		{Flags: NeedEa, EaName: ".LONGNAME", EaValue: []byte{0xfd, 0xff, 2, 0, 'a', 0}},
+		{EaName: "EMPTY"},
+	}
+
+	hdr := &tar.Header{Name: "file.txt", Mode: 0644, Size: 4, Typeflag: tar.TypeReg}
+	if err := SetTarHeaderEas(hdr, eas, &PaxEaOptions{Ntfs3gXattr: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if hdr.PAXRecords["NTFSEA.ea.APPVERSION"] != "MS4w" || hdr.PAXRecords["NTFSEA.flags..LONGNAME"] != "128" {
+		t.Fatalf("Unexpected PAX records: %q", hdr.PAXRecords)
+	}
+	if _, ok := hdr.PAXRecords["NTFSEA.flags.APPVERSION"]; ok {
+		t.Fatal("Flags of 0 should not be stored")
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("test"))
+	tw.Close()
+
+	read, err := tar.NewReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := TarHeaderEas(read)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []EaInfo{eas[1], eas[0]}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("Unexpected EAs: %v", decoded)
+	}
+
+	// the same EA set as read by ntfs-3g through GNU tar
+	delete(read.PAXRecords, "NTFSEA.ea.APPVERSION")
+	delete(read.PAXRecords, "NTFSEA.ea..LONGNAME")
+	if decoded, err = TarHeaderEas(read); err != nil || !reflect.DeepEqual(decoded, []EaInfo{eas[0], eas[1]}) {
+		t.Fatalf("Unexpected EAs from SCHILY.xattr: %v, %v", decoded, err)
+	}
+
+	// bsdtar
+	ntfsEa := read.PAXRecords["SCHILY.xattr.system.ntfs_ea"]
+	libarchive := &tar.Header{PAXRecords: map[string]string{
+		"LIBARCHIVE.xattr.system.ntfs%5Fea": base64.RawStdEncoding.EncodeToString([]byte(ntfsEa)),
+	}}
+	if decoded, err = TarHeaderEas(libarchive); err != nil || !reflect.DeepEqual(decoded, []EaInfo{eas[0], eas[1]}) {
+		t.Fatalf("Unexpected EAs from LIBARCHIVE.xattr: %v, %v", decoded, err)
+	}
+
+	if err = SetTarHeaderEas(hdr, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hdr.PAXRecords["NTFSEA.ea.APPVERSION"]; ok {
+		t.Fatal("NTFSEA records should be replaced")
+	}
+}
+
+func TestTarHeaderEasErrors(t *testing.T) {
+	if err := SetTarHeaderEas(&tar.Header{}, []EaInfo{{EaName: "A=B", EaValue: []byte{1}}}, nil); err == nil {
+		t.Fatal("Expected error for invalid EA name")
+	}
+
+	for _, records := range []map[string]string{
+		{"NTFSEA.ea.A": "!"},
+		{"NTFSEA.ea.A": "AQ==", "NTFSEA.flags.A": "256"},
+		{"SCHILY.xattr.system.ntfs_ea": "\x01"},
+	} {
+		if _, err := TarHeaderEas(&tar.Header{PAXRecords: records}); err == nil {
+			t.Fatalf("Expected error for %q", records)
+		}
+	}
+}
+
+func TestRestoreTarHeaderEas(t *testing.T) {
+	src, dst := NewMemStore(), NewMemStore()
+	eas := []EaInfo{{Flags: NeedEa, EaName: "APPVERSION", EaValue: []byte("1.0")}}
+	if err := src.EaWriteFile("/src/file", false, eas...); err != nil {
+		t.Fatal(err)
+	}
+
+	hdr := &tar.Header{Name: "file"}
+	if err := AddFileEasToTarHeader(hdr, "/src/file", false, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreTarHeaderEas(hdr, "/dst/file", false, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := dst.QueryFileEa("/dst/file", false)
+	if err != nil || !reflect.DeepEqual(restored, eas) {
+		t.Fatalf("Unexpected EAs: %v, %v", restored, err)
+	}
+
+	if err = RestoreTarHeaderEas(&tar.Header{Name: "other"}, "/dst/other", false, dst); err != nil {
+		t.Fatal(err)
+	}
+	if paths := dst.Paths(); len(paths) != 1 {
+		t.Fatalf("Nothing should be written without EA, got %v", paths)
+	}
+}
@@ -0,0 +1,110 @@
+package ntfs_ea
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Samba stores EAs written by SMB clients as extended attributes in the "user." namespace with the EA name as sent by the client,
+// and returns extended attributes of the namespace to clients without the prefix. EA flags are not stored.
+// Names of other namespaces, private attributes of Samba and names which are invalid for Windows are not exposed to clients.
+
+// SambaXattrPrefix is the extended attribute namespace Samba stores EAs in.
+const SambaXattrPrefix = "user."
+
+// sambaPrivateXattrs are extended attributes Samba keeps for itself, compared case-insensitively.
+var sambaPrivateXattrs = []string{
+	"user.SAMBA_PAI",        // POSIX ACL inheritance
+	"user.DOSATTRIB",        // DOS attributes and creation time
+	"user.SAMBA_STREAMS",    // marker of vfs_streams_xattr
+	"security.NTACL",        // NT ACL of vfs_acl_xattr
+	"org.netatalk.Metadata", // AFP info of vfs_fruit
+}
+
+const sambaStreamXattrPrefix = "user.DosStream." // alternate data streams of vfs_streams_xattr
+
+// IsSambaPrivateXattr reports whether the extended attribute is used by Samba itself and never exposed as EA.
+func IsSambaPrivateXattr(xattr string) bool {
+	for _, name := range sambaPrivateXattrs {
+		if strings.EqualFold(name, xattr) {
+			return true
+		}
+	}
+
+	return len(xattr) >= len(sambaStreamXattrPrefix) && strings.EqualFold(xattr[:len(sambaStreamXattrPrefix)], sambaStreamXattrPrefix)
+}
+
+// SambaXattrToEaName returns the EA name Samba exposes for the extended attribute, false if it is not exposed.
+func SambaXattrToEaName(xattr string) (string, bool) {
+	if !strings.HasPrefix(xattr, SambaXattrPrefix) || IsSambaPrivateXattr(xattr) {
+		return "", false
+	}
+
+	name := xattr[len(SambaXattrPrefix):]
+	if ValidateEaName(name) != nil {
+		return "", false
+	}
+
+	return name, true
+}
+
+// EaNameToSambaXattr returns the extended attribute Samba stores the EA in. Like Samba, an existing extended attribute
+// whose name matches case-insensitively is reused, so the case of the stored name is kept.
+func EaNameToSambaXattr(name string, existing map[string][]byte) string {
+	for xattr := range existing {
+		if eaName, ok := SambaXattrToEaName(xattr); ok && eaNameKey(eaName) == eaNameKey(name) {
+			return xattr
+		}
+	}
+
+	return SambaXattrPrefix + name
+}
+
+// SambaXattrsToEas returns the EAs Samba exposes to clients for the extended attributes, sorted by upper case name.
+func SambaXattrsToEas(xattrs map[string][]byte) []EaInfo {
+	var eas []EaInfo
+	for xattr, value := range xattrs {
+		if name, ok := SambaXattrToEaName(xattr); ok && len(value) != 0 {
+			eas = append(eas, EaInfo{EaName: name, EaValue: value})
+		}
+	}
+
+	sort.Slice(eas, func(i, j int) bool {
+		return eaNameKey(eas[i].EaName) < eaNameKey(eas[j].EaName)
+	})
+
+	return eas
+}
+
+// ApplyEasToSambaXattrs returns the extended attributes after writing eas as Samba does, an EA with empty value removes
+// the extended attribute. Private attributes and other namespaces in existing are kept.
+func ApplyEasToSambaXattrs(existing map[string][]byte, eas []EaInfo) (map[string][]byte, error) {
+	xattrs := make(map[string][]byte, len(existing)+len(eas))
+	for xattr, value := range existing {
+		xattrs[xattr] = value
+	}
+
+	for _, ea := range eas {
+		if err := ValidateEaName(ea.EaName); err != nil {
+			return nil, err
+		}
+
+		xattr := EaNameToSambaXattr(ea.EaName, xattrs)
+		if IsSambaPrivateXattr(xattr) {
+			return nil, fmt.Errorf("EA %s is reserved by Samba", ea.EaName)
+		}
+
+		if len(ea.EaValue) == 0 {
+			delete(xattrs, xattr)
+		} else {
+			xattrs[xattr] = ea.EaValue
+		}
+	}
+
+	if _, err := convertToFullInfoBuf(SambaXattrsToEas(xattrs)); err != nil {
+		return nil, err
+	}
+
+	return xattrs, nil
+}
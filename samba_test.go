@@ -0,0 +1,92 @@
+package ntfs_ea
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSambaXattrNames(t *testing.T) {
+	for _, tc := range []struct {
+		xattr  string
+		eaName string
+		ok     bool
+	}{
+		{"user.AppVersion", "AppVersion", true},
+		{"user..LONGNAME", ".LONGNAME", true},
+		{"user.DOSATTRIB", "", false},
+		{"user.dosattrib", "", false},
+		{"user.SAMBA_PAI", "", false},
+		{"user.DosStream.Zone.Identifier:$DATA", "", false},
+		{"security.NTACL", "", false},
+		{"trusted.foo", "", false},
+		{"system.posix_acl_access", "", false},
+		{"user.a:b", "", false},
+	} {
+		name, ok := SambaXattrToEaName(tc.xattr)
+		if name != tc.eaName || ok != tc.ok {
+			t.Fatalf("%q mapped to %q(%v), expected %q(%v)", tc.xattr, name, ok, tc.eaName, tc.ok)
+		}
+	}
+
+	existing := map[string][]byte{"user.AppVersion": []byte("1.0")}
+	if xattr := EaNameToSambaXattr("APPVERSION", existing); xattr != "user.AppVersion" {
+		t.Fatalf("Expected the existing name to be reused, got %q", xattr)
+	}
+	if xattr := EaNameToSambaXattr("NEWEA", existing); xattr != "user.NEWEA" {
+		t.Fatalf("Unexpected xattr %q", xattr)
+	}
+}
+
+func TestSambaXattrs(t *testing.T) {
+	existing := map[string][]byte{
+		"user.DOSATTRIB":       []byte("0x20"),
+		"user.SAMBA_PAI":       {2, 0},
+		"user.AppVersion":      []byte("1.0"),
+		"user.Comment":         []byte("old"),
+		"security.NTACL":       {1},
+		"user.DosStream.s:$DA": []byte("stream"),
+	}
+
+	eas := SambaXattrsToEas(existing)
+	expected := []EaInfo{
+		{EaName: "AppVersion", EaValue: []byte("1.0")},
+		{EaName: "Comment", EaValue: []byte("old")},
+	}
+	if !reflect.DeepEqual(eas, expected) {
+		t.Fatalf("Unexpected EAs: %v", eas)
+	}
+
+	updated, err := ApplyEasToSambaXattrs(existing, []EaInfo{
+		{EaName: "APPVERSION", EaValue: []byte("2.0")},
+		{EaName: "COMMENT"},
+		{Flags: NeedEa, EaName: "Added", EaValue: []byte("x")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedXattrs := map[string][]byte{
+		"user.DOSATTRIB":       []byte("0x20"),
+		"user.SAMBA_PAI":       {2, 0},
+		"user.AppVersion":      []byte("2.0"),
+		"user.Added":           []byte("x"),
+		"security.NTACL":       {1},
+		"user.DosStream.s:$DA": []byte("stream"),
+	}
+	if !reflect.DeepEqual(updated, expectedXattrs) {
+		t.Fatalf("Unexpected xattrs: %q", updated)
+	}
+	if _, ok := existing["user.Comment"]; !ok {
+		t.Fatal("existing xattrs should not be modified")
+	}
+
+	for _, ea := range []EaInfo{{EaName: "DOSATTRIB", EaValue: []byte("x")}, {EaName: "a*b", EaValue: []byte("x")}} {
+		if _, err = ApplyEasToSambaXattrs(existing, []EaInfo{ea}); err == nil {
+			t.Fatalf("Expected error for %q", ea.EaName)
+		}
+	}
+
+	if _, err = ApplyEasToSambaXattrs(nil, []EaInfo{{EaName: "BIG", EaValue: make([]byte, maxEaSetSize)}}); err == nil {
+		t.Fatal("Expected error for EA set over 64KB")
+	}
+}
@@ -0,0 +1,423 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value types of EaFieldSchema.Type, each of them is decoded the same way as the codec with the similar name.
+const (
+	SchemaBinary   = "binary" // any bytes, allowed values are written in hex
+	SchemaUTF8     = "utf8"   // UTF8Codec
+	SchemaUTF16    = "utf16"  // UTF16Codec without NUL terminator
+	SchemaUTF16Z   = "utf16z" // UTF16Codec with NUL terminator
+	SchemaInt8     = "int8"   // IntCodec of the width for this and the following integer types, allowed values are written in decimal or 0x hex
+	SchemaInt16    = "int16"
+	SchemaInt32    = "int32"
+	SchemaInt64    = "int64"
+	SchemaUint8    = "uint8"
+	SchemaUint16   = "uint16"
+	SchemaUint32   = "uint32"
+	SchemaUint64   = "uint64"
+	SchemaBool     = "bool"     // a byte of 0 or 1 as MarshalEas, allowed values are "true" and "false"
+	SchemaFiletime = "filetime" // FiletimeCodec, allowed values are written in RFC 3339
+	SchemaGUID     = "guid"     // GUIDCodec, allowed values are written as GUID.String
+	SchemaJSON     = "json"     // any JSON value, allowed values are compared in compact form
+	SchemaOS2      = "os2"      // OS/2 typed value, allowed values are compared with TypedValue.Text("\n")
+)
+
+// EaFieldSchema describes an EA expected in a file.
+type EaFieldSchema struct {
+	Name        string   `json:"name"`
+	GoName      string   `json:"goName,omitempty"` // name of accessors made by gen_ea_accessors, derived from Name if empty
+	Description string   `json:"description,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Type        string   `json:"type,omitempty"`    // one of Schema* types, SchemaBinary if empty
+	MinSize     int      `json:"minSize,omitempty"` // bounds of the value size in bytes, 0 for no bound
+	MaxSize     int      `json:"maxSize,omitempty"`
+	NeedEa      *bool    `json:"needEa,omitempty"`  // NeedEa flag should be set if true and should not be set if false
+	Allowed     []string `json:"allowed,omitempty"` // allowed values in the text form of Type, any value if empty
+}
+
+// EaSchema describes the EA set which an application expects in a file.
+// EAs with empty value are treated as missing, the same way as EaWriteFile removes them.
+type EaSchema struct {
+	Fields       []EaFieldSchema `json:"fields"`
+	AllowUnknown bool            `json:"allowUnknown,omitempty"` // allow EAs which are not in Fields
+}
+
+// EaFieldError is a violation of EaSchema by an EA, Name is empty for violations by the whole EA set.
+type EaFieldError struct {
+	Name   string
+	Reason string
+}
+
+func (e *EaFieldError) Error() string {
+	if e.Name == "" {
+		return e.Reason
+	}
+
+	return e.Name + ": " + e.Reason
+}
+
+// EaSchemaError collects violations from EaSchema.Validate.
+type EaSchemaError struct {
+	Errors []*EaFieldError
+}
+
+func (e *EaSchemaError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d EA schema violations:", len(e.Errors))
+	for _, err := range e.Errors {
+		sb.WriteString("\n\t")
+		sb.WriteString(err.Error())
+	}
+
+	return sb.String()
+}
+
+func (e *EaSchemaError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// ParseEaSchema parses a schema in JSON and checks it with Check, unknown keys are refused to catch typos.
+func ParseEaSchema(b []byte) (*EaSchema, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	s := &EaSchema{}
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("invalid EA schema: %w", err)
+	}
+
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// LoadEaSchema reads a schema in JSON from the file in path, see ParseEaSchema.
+func LoadEaSchema(path string) (*EaSchema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := ParseEaSchema(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Check reports errors in the schema itself, such as invalid names, unknown types and allowed values which can not be parsed.
+func (s *EaSchema) Check() error {
+	var errs []*EaFieldError
+	seen := make(map[string]bool)
+
+	for _, f := range s.Fields {
+		fail := func(format string, a ...any) {
+			errs = append(errs, &EaFieldError{Name: f.Name, Reason: fmt.Sprintf(format, a...)})
+		}
+
+		if err := ValidateEaName(f.Name); err != nil {
+			fail("%v", err)
+		}
+		if seen[eaNameKey(f.Name)] {
+			fail("defined more than once")
+		}
+		seen[eaNameKey(f.Name)] = true
+
+		if f.MinSize < 0 || f.MaxSize < 0 || (f.MaxSize != 0 && f.MinSize > f.MaxSize) {
+			fail("invalid size bounds %d to %d", f.MinSize, f.MaxSize)
+		}
+
+		if !schemaTypes[schemaTypeName(f.Type)] {
+			fail("unknown type %q", f.Type)
+			continue
+		}
+
+		for _, allowed := range f.Allowed {
+			if _, err := normalizeSchemaText(f.Type, allowed); err != nil {
+				fail("invalid allowed value %q: %v", allowed, err)
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return &EaSchemaError{Errors: errs}
+	}
+
+	return nil
+}
+
+// Validate checks eas against the schema and returns *EaSchemaError with every violation, nil if eas conforms to it.
+// eas can be the result of QueryFileEa or EAs to be written.
+func (s *EaSchema) Validate(eas []EaInfo) error {
+	var errs []*EaFieldError
+	fail := func(name, format string, a ...any) {
+		errs = append(errs, &EaFieldError{Name: name, Reason: fmt.Sprintf(format, a...)})
+	}
+
+	present := make(map[string]EaInfo)
+	var set []EaInfo
+	for _, ea := range eas {
+		if len(ea.EaValue) == 0 {
+			continue
+		}
+
+		key := eaNameKey(ea.EaName)
+		if _, ok := present[key]; ok {
+			fail(ea.EaName, "appears more than once")
+			continue
+		}
+		present[key] = ea
+		set = append(set, ea)
+	}
+
+	if size, err := eaSetSize(set); err != nil {
+		fail("", "%v", err)
+	} else if size > maxEaSetSize {
+		fail("", "EA set of %d bytes exceeds %d bytes", size, maxEaSetSize)
+	}
+
+	known := make(map[string]bool, len(s.Fields))
+	for _, f := range s.Fields {
+		key := eaNameKey(f.Name)
+		known[key] = true
+
+		ea, ok := present[key]
+		if !ok {
+			if f.Required {
+				fail(f.Name, "required EA is missing")
+			}
+			continue
+		}
+
+		size := len(ea.EaValue)
+		if size < f.MinSize {
+			fail(f.Name, "value of %d bytes is shorter than %d bytes", size, f.MinSize)
+		}
+		if f.MaxSize != 0 && size > f.MaxSize {
+			fail(f.Name, "value of %d bytes is longer than %d bytes", size, f.MaxSize)
+		}
+
+		if f.NeedEa != nil && *f.NeedEa != (ea.Flags&NeedEa != 0) {
+			if *f.NeedEa {
+				fail(f.Name, "NeedEa flag is not set")
+			} else {
+				fail(f.Name, "NeedEa flag should not be set")
+			}
+		}
+
+		text, err := schemaValueText(f.Type, ea.EaValue)
+		if err != nil {
+			fail(f.Name, "invalid %s value: %v", schemaTypeName(f.Type), err)
+			continue
+		}
+
+		if len(f.Allowed) != 0 && !f.allows(text) {
+			fail(f.Name, "value %q is not one of %q", text, f.Allowed)
+		}
+	}
+
+	if !s.AllowUnknown {
+		for _, ea := range set {
+			if !known[eaNameKey(ea.EaName)] {
+				fail(ea.EaName, "unknown EA")
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return &EaSchemaError{Errors: errs}
+	}
+
+	return nil
+}
+
+func (f *EaFieldSchema) allows(text string) bool {
+	for _, allowed := range f.Allowed {
+		if normalized, err := normalizeSchemaText(f.Type, allowed); err == nil && normalized == text {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateFile queries EAs of the file in path and validates them, DefaultStore() is used if store is nil.
+func (s *EaSchema) ValidateFile(path string, followReparsePoint bool, store EaStore) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	eas, err := store.QueryFileEa(path, followReparsePoint)
+	if err != nil {
+		return err
+	}
+
+	return s.Validate(eas)
+}
+
+var schemaTypes = map[string]bool{
+	SchemaBinary: true, SchemaUTF8: true, SchemaUTF16: true, SchemaUTF16Z: true,
+	SchemaInt8: true, SchemaInt16: true, SchemaInt32: true, SchemaInt64: true,
+	SchemaUint8: true, SchemaUint16: true, SchemaUint32: true, SchemaUint64: true,
+	SchemaBool: true, SchemaFiletime: true, SchemaGUID: true, SchemaJSON: true, SchemaOS2: true,
+}
+
+func schemaTypeName(t string) string {
+	if t == "" {
+		return SchemaBinary
+	}
+
+	return t
+}
+
+// schemaValueText decodes b as value of type t and returns its text form.
+func schemaValueText(t string, b []byte) (string, error) {
+	var (
+		s   string
+		err error
+	)
+
+	switch t {
+	case "", SchemaBinary:
+		return hex.EncodeToString(b), nil
+	case SchemaUTF8:
+		return UTF8Codec{}.Decode(b)
+	case SchemaUTF16:
+		return UTF16Codec{}.Decode(b)
+	case SchemaUTF16Z:
+		return UTF16Codec{NulTerminated: true}.Decode(b)
+	case SchemaInt8, SchemaInt16, SchemaInt32, SchemaInt64:
+		s, err = intText(b, schemaIntSize(t), true)
+	case SchemaUint8, SchemaUint16, SchemaUint32, SchemaUint64:
+		s, err = intText(b, schemaIntSize(t), false)
+	case SchemaBool:
+		var v bool
+		if v, err = (BoolCodec{}).Decode(b); err == nil {
+			s = strconv.FormatBool(v)
+		}
+	case SchemaFiletime:
+		var ts time.Time
+		if ts, err = (FiletimeCodec{}).Decode(b); err == nil {
+			s = ts.Format(time.RFC3339Nano)
+		}
+	case SchemaGUID:
+		var g GUID
+		if g, err = (GUIDCodec{}).Decode(b); err == nil {
+			s = g.String()
+		}
+	case SchemaJSON:
+		var buf bytes.Buffer
+		if err = json.Compact(&buf, b); err == nil {
+			s = buf.String()
+		}
+	case SchemaOS2:
+		var v TypedValue
+		if v, err = (TypedValueCodec{}).Decode(b); err == nil {
+			s = v.Text("\n")
+		}
+	default:
+		return "", fmt.Errorf("unknown type %q", t)
+	}
+
+	return s, err
+}
+
+func schemaIntSize(t string) int {
+	switch strings.TrimPrefix(t, "u") {
+	case SchemaInt8:
+		return 1
+	case SchemaInt16:
+		return 2
+	case SchemaInt32:
+		return 4
+	}
+
+	return 8
+}
+
+func intText(b []byte, size int, signed bool) (string, error) {
+	if len(b) != size {
+		return "", fmt.Errorf("should be %d bytes, got %d", size, len(b))
+	}
+
+	v := uintLE(b)
+	if signed {
+		shift := 64 - 8*size
+		return strconv.FormatInt(int64(v<<shift)>>shift, 10), nil
+	}
+
+	return strconv.FormatUint(v, 10), nil
+}
+
+// normalizeSchemaText parses an allowed value written in the text form of type t and returns it as schemaValueText does.
+func normalizeSchemaText(t, s string) (string, error) {
+	switch t {
+	case "", SchemaBinary:
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(b), nil
+	case SchemaInt8, SchemaInt16, SchemaInt32, SchemaInt64:
+		v, err := strconv.ParseInt(s, 0, 8*schemaIntSize(t))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(v, 10), nil
+	case SchemaUint8, SchemaUint16, SchemaUint32, SchemaUint64:
+		v, err := strconv.ParseUint(s, 0, 8*schemaIntSize(t))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatUint(v, 10), nil
+	case SchemaBool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(v), nil
+	case SchemaFiletime:
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return "", err
+		}
+		return ts.UTC().Format(time.RFC3339Nano), nil
+	case SchemaGUID:
+		g, err := ParseGUID(s)
+		if err != nil {
+			return "", err
+		}
+		return g.String(), nil
+	case SchemaJSON:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(s)); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	return s, nil
+}
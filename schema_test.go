@@ -0,0 +1,137 @@
+package ntfs_ea
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+	"fields": [
+		{"name": "APPVERSION", "required": true, "type": "utf8", "maxSize": 16, "needEa": true},
+		{"name": "CHANNEL", "type": "utf16z", "allowed": ["stable", "beta"]},
+		{"name": "BUILD", "type": "uint32", "allowed": ["0x10", "42"]},
+		{"name": "OWNER", "type": "guid"},
+		{"name": "SETTINGS", "type": "json", "allowed": ["{ \"debug\": false }"]},
+		{"name": "BLOB", "minSize": 2}
+	]
+}`
+
+func schemaViolations(err error) []string {
+	var schemaErr *EaSchemaError
+	if !errors.As(err, &schemaErr) {
+		return nil
+	}
+
+	var violations []string
+	for _, e := range schemaErr.Errors {
+		violations = append(violations, e.Error())
+	}
+
+	return violations
+}
+
+func TestEaSchemaValidate(t *testing.T) {
+	s, err := ParseEaSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel, _ := UTF16Codec{NulTerminated: true}.Encode("beta")
+	owner, _ := GUIDCodec{}.Encode(GUID{Data1: 1})
+	valid := []EaInfo{
+		{Flags: NeedEa, EaName: "AppVersion", EaValue: []byte("1.0")},
+		{EaName: "CHANNEL", EaValue: channel},
+		{EaName: "BUILD", EaValue: []byte{16, 0, 0, 0}},
+		{EaName: "OWNER", EaValue: owner},
+		{EaName: "SETTINGS", EaValue: []byte(`{"debug":false}`)},
+		{EaName: "BLOB", EaValue: []byte{1, 2}},
+		{EaName: "REMOVED"},
+	}
+	if err = s.Validate(valid); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	invalid := []EaInfo{
+		{EaName: "APPVERSION", EaValue: []byte("1.0.0.0.0.0.0.0.0")},
+		{EaName: "CHANNEL", EaValue: []byte("beta")},
+		{EaName: "BUILD", EaValue: []byte{1, 0, 0, 0}},
+		{EaName: "OWNER", EaValue: []byte{1}},
+		{EaName: "SETTINGS", EaValue: []byte(`{"debug":true}`)},
+		{EaName: "BLOB", EaValue: []byte{1}},
+		{EaName: "blob", EaValue: []byte{1, 2}},
+		{EaName: "EXTRA", EaValue: []byte{1}},
+	}
+
+	expected := []string{
+		"blob: appears more than once",
+		"APPVERSION: value of 17 bytes is longer than 16 bytes",
+		"APPVERSION: NeedEa flag is not set",
+		"CHANNEL: invalid utf16z value: invalid EA value for codec: UTF-16 value is not NUL terminated",
+		`BUILD: value "1" is not one of ["0x10" "42"]`,
+		"OWNER: invalid guid value: invalid EA value for codec: GUID should be 16 bytes, got 1",
+		`SETTINGS: value "{\"debug\":true}" is not one of ["{ \"debug\": false }"]`,
+		"BLOB: value of 1 bytes is shorter than 2 bytes",
+		"EXTRA: unknown EA",
+	}
+
+	violations := schemaViolations(s.Validate(invalid))
+	if strings.Join(violations, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Unexpected violations:\n%s\nexpected:\n%s", strings.Join(violations, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if violations = schemaViolations(s.Validate(nil)); len(violations) != 1 || violations[0] != "APPVERSION: required EA is missing" {
+		t.Fatalf("Unexpected violations: %q", violations)
+	}
+
+	s.AllowUnknown = true
+	if err = s.Validate(append(valid, EaInfo{EaName: "EXTRA", EaValue: []byte{1}})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if violations = schemaViolations(s.Validate(append(valid, EaInfo{EaName: "BIG", EaValue: make([]byte, maxEaSetSize)}))); len(violations) != 1 {
+		t.Fatalf("Expected a violation for the EA set size, got %q", violations)
+	}
+}
+
+func TestEaSchemaCheck(t *testing.T) {
+	for _, src := range []string{
+		`{"fields": [{"name": "A*B"}]}`,
+		`{"fields": [{"name": "A"}, {"name": "a"}]}`,
+		`{"fields": [{"name": "A", "type": "float"}]}`,
+		`{"fields": [{"name": "A", "minSize": 4, "maxSize": 2}]}`,
+		`{"fields": [{"name": "A", "type": "uint8", "allowed": ["256"]}]}`,
+		`{"fields": [{"name": "A", "type": "binary", "allowed": ["xyz"]}]}`,
+		`{"fields": [{"name": "A", "requird": true}]}`,
+	} {
+		if _, err := ParseEaSchema([]byte(src)); err == nil {
+			t.Fatalf("Expected error for %s", src)
+		}
+	}
+}
+
+func TestEaSchemaValidateFile(t *testing.T) {
+	schemaPath := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(schemaPath, []byte(testSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadEaSchema(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemStore()
+	if err = store.EaWriteFile("/file", false, EaInfo{Flags: NeedEa, EaName: "APPVERSION", EaValue: []byte("1.0")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.ValidateFile("/file", false, store); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = s.ValidateFile("/other", false, store); len(schemaViolations(err)) != 1 {
+		t.Fatalf("Expected a missing EA, got %v", err)
+	}
+}
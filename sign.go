@@ -0,0 +1,435 @@
+package ntfs_ea
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Signed EA values
+//
+// Signatures are stored as JSON of eaSignatures in the companion EA named SignatureEaName. Each signature covers the canonical form of
+// an EA, or of the whole EA set sorted by upper case name, together with the signing time, so the time can not be changed without
+// invalidating the signatures. The companion EA itself is never signed, instead a manifest signature covers the sign mode and the
+// names of the signed EAs, so signatures can not be dropped from it to hide removed EAs.
+
+// SignatureEaName is the name of the companion EA holding signatures of the other EAs in the file.
+const SignatureEaName = "EASIGNATURE"
+
+const (
+	signatureVersion = 1
+	signatureDomain  = "ntfs-ea signature v1"
+)
+
+// SignMode selects what SignEas signs.
+type SignMode int
+
+const (
+	SignEntries SignMode = 1 << iota // sign each EA separately, so changes can be reported per EA
+	SignSet                          // sign the whole EA set, so added or removed EAs invalidate it
+)
+
+// EaSigner signs canonical EA data, HMACKey and Ed25519Signer implement it.
+type EaSigner interface {
+	Algorithm() string
+	KeyID() string
+	Sign(msg []byte) ([]byte, error)
+}
+
+// EaVerifier verifies signatures made by the according EaSigner, HMACKey and Ed25519Verifier implement it.
+type EaVerifier interface {
+	Algorithm() string
+	KeyID() string
+	Verify(msg, sig []byte) bool
+}
+
+// HMACKey signs and verifies with HMAC-SHA256.
+type HMACKey struct {
+	ID  string
+	Key []byte
+}
+
+func (k HMACKey) Algorithm() string { return "hmac-sha256" }
+func (k HMACKey) KeyID() string     { return k.ID }
+
+func (k HMACKey) Sign(msg []byte) ([]byte, error) {
+	if len(k.Key) == 0 {
+		return nil, errors.New("HMAC key is empty")
+	}
+
+	mac := hmac.New(sha256.New, k.Key)
+	mac.Write(msg)
+
+	return mac.Sum(nil), nil
+}
+
+func (k HMACKey) Verify(msg, sig []byte) bool {
+	expected, err := k.Sign(msg)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(expected, sig)
+}
+
+// Ed25519Signer signs with an Ed25519 private key.
+type Ed25519Signer struct {
+	ID  string
+	Key ed25519.PrivateKey
+}
+
+func (s Ed25519Signer) Algorithm() string { return "ed25519" }
+func (s Ed25519Signer) KeyID() string     { return s.ID }
+
+func (s Ed25519Signer) Sign(msg []byte) ([]byte, error) {
+	if len(s.Key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid Ed25519 private key")
+	}
+
+	return ed25519.Sign(s.Key, msg), nil
+}
+
+// Ed25519Verifier verifies with an Ed25519 public key.
+type Ed25519Verifier struct {
+	ID  string
+	Key ed25519.PublicKey
+}
+
+func (v Ed25519Verifier) Algorithm() string { return "ed25519" }
+func (v Ed25519Verifier) KeyID() string     { return v.ID }
+
+func (v Ed25519Verifier) Verify(msg, sig []byte) bool {
+	return len(v.Key) == ed25519.PublicKeySize && ed25519.Verify(v.Key, msg, sig)
+}
+
+type eaEntrySignature struct {
+	Name      string `json:"name"`
+	Signature []byte `json:"sig"`
+}
+
+type eaSignatures struct {
+	Version   int                `json:"version"`
+	Algorithm string             `json:"alg"`
+	KeyID     string             `json:"keyId,omitempty"`
+	SignedAt  int64              `json:"signedAt"` // unix time in seconds
+	Mode      SignMode           `json:"mode"`
+	Entries   []eaEntrySignature `json:"entries,omitempty"`
+	Set       []byte             `json:"set,omitempty"`
+	Manifest  []byte             `json:"manifest"` // signature of canonicalManifest
+}
+
+func appendCanonicalEa(msg []byte, ea EaInfo) []byte {
+	name := eaNameKey(ea.EaName)
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(name)))
+	msg = append(msg, name...)
+	msg = append(msg, ea.Flags)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(len(ea.EaValue)))
+
+	return append(msg, ea.EaValue...)
+}
+
+func canonicalHeader(kind string, signedAt int64) []byte {
+	msg := append([]byte(signatureDomain), 0)
+	msg = append(msg, kind...)
+	msg = append(msg, 0)
+
+	return binary.LittleEndian.AppendUint64(msg, uint64(signedAt))
+}
+
+func canonicalEntry(ea EaInfo, signedAt int64) []byte {
+	return appendCanonicalEa(canonicalHeader("entry", signedAt), ea)
+}
+
+// canonicalSet returns the canonical form of eas without the signature EA, sorted by upper case name.
+func canonicalSet(eas []EaInfo, signedAt int64) []byte {
+	sorted := unsignedEas(eas)
+	sort.Slice(sorted, func(i, j int) bool {
+		return eaNameKey(sorted[i].EaName) < eaNameKey(sorted[j].EaName)
+	})
+
+	msg := canonicalHeader("set", signedAt)
+	for _, ea := range sorted {
+		msg = appendCanonicalEa(msg, ea)
+	}
+
+	return msg
+}
+
+// canonicalManifest returns the canonical form of the sign mode and the names of EAs with their own signature, sorted.
+func canonicalManifest(sigs *eaSignatures) []byte {
+	names := make([]string, len(sigs.Entries))
+	for i, e := range sigs.Entries {
+		names[i] = eaNameKey(e.Name)
+	}
+	sort.Strings(names)
+
+	msg := canonicalHeader("manifest", sigs.SignedAt)
+	msg = append(msg, byte(sigs.Mode))
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(len(names)))
+	for _, name := range names {
+		msg = binary.LittleEndian.AppendUint16(msg, uint16(len(name)))
+		msg = append(msg, name...)
+	}
+
+	return msg
+}
+
+func unsignedEas(eas []EaInfo) []EaInfo {
+	var unsigned []EaInfo
+	for _, ea := range eas {
+		if eaNameKey(ea.EaName) != SignatureEaName && len(ea.EaValue) != 0 {
+			unsigned = append(unsigned, ea)
+		}
+	}
+
+	return unsigned
+}
+
+// SignEas signs eas with signer and returns the signature EA to be written with them, an existing signature EA in eas is ignored.
+func SignEas(eas []EaInfo, signer EaSigner, mode SignMode) (EaInfo, error) {
+	if mode&(SignEntries|SignSet) == 0 {
+		return EaInfo{}, errors.New("nothing to sign, mode should have SignEntries or SignSet")
+	}
+
+	sigs := eaSignatures{
+		Version:   signatureVersion,
+		Algorithm: signer.Algorithm(),
+		KeyID:     signer.KeyID(),
+		SignedAt:  time.Now().Unix(),
+		Mode:      mode & (SignEntries | SignSet),
+	}
+
+	if mode&SignEntries != 0 {
+		for _, ea := range unsignedEas(eas) {
+			sig, err := signer.Sign(canonicalEntry(ea, sigs.SignedAt))
+			if err != nil {
+				return EaInfo{}, err
+			}
+
+			sigs.Entries = append(sigs.Entries, eaEntrySignature{Name: eaNameKey(ea.EaName), Signature: sig})
+		}
+	}
+
+	if mode&SignSet != 0 {
+		sig, err := signer.Sign(canonicalSet(eas, sigs.SignedAt))
+		if err != nil {
+			return EaInfo{}, err
+		}
+
+		sigs.Set = sig
+	}
+
+	sig, err := signer.Sign(canonicalManifest(&sigs))
+	if err != nil {
+		return EaInfo{}, err
+	}
+	sigs.Manifest = sig
+
+	value, err := json.Marshal(sigs)
+	if err != nil {
+		return EaInfo{}, err
+	}
+
+	return EaInfo{EaName: SignatureEaName, EaValue: value}, nil
+}
+
+// SignatureStatus is the result of verifying a signature.
+type SignatureStatus int
+
+const (
+	SignatureValid   SignatureStatus = iota
+	SignatureMissing                 // the EA or EA set has no signature
+	SignatureInvalid                 // the signature does not match, the EA was changed or signed with another key
+	SignatureStale                   // the signed EA does not exist anymore, or the signature is older than VerifyOptions.MaxAge
+)
+
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureValid:
+		return "valid"
+	case SignatureMissing:
+		return "missing"
+	case SignatureInvalid:
+		return "invalid"
+	case SignatureStale:
+		return "stale"
+	}
+
+	return fmt.Sprintf("SignatureStatus(%d)", int(s))
+}
+
+// EntryVerification is the verification result of an EA.
+type EntryVerification struct {
+	Name   string
+	Status SignatureStatus
+}
+
+// VerifyReport is the result of VerifyEas.
+type VerifyReport struct {
+	KeyID    string
+	SignedAt time.Time
+	Entries  []EntryVerification // per EA results, empty if the EAs were not signed with SignEntries
+	Set      SignatureStatus     // SignatureMissing if the EA set was not signed with SignSet
+	Manifest SignatureStatus     // result of the signature over the sign mode and names of signed EAs
+}
+
+// Valid reports whether every signature in the report is valid, a missing set signature is allowed if every EA is signed and vice versa.
+// The manifest signature should be valid, so a missing set signature or entry is only allowed if the EAs were signed that way.
+func (r *VerifyReport) Valid() bool {
+	if r.Manifest != SignatureValid {
+		return false
+	}
+	if r.Set != SignatureValid && r.Set != SignatureMissing {
+		return false
+	}
+
+	for _, e := range r.Entries {
+		if e.Status != SignatureValid {
+			return false
+		}
+	}
+
+	return r.Set == SignatureValid || len(r.Entries) != 0
+}
+
+// VerifyOptions configures VerifyEas.
+type VerifyOptions struct {
+	MaxAge time.Duration // signatures older than MaxAge are reported as stale, no limit if zero
+}
+
+// VerifyEas verifies eas with the signature EA in them, without the signature EA every EA is reported as missing signature.
+// An error is returned if the EAs were signed with another algorithm, or with another key ID when both key IDs are set.
+func VerifyEas(eas []EaInfo, verifier EaVerifier, opts *VerifyOptions) (*VerifyReport, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+
+	report := &VerifyReport{Set: SignatureMissing, Manifest: SignatureMissing}
+	unsigned := unsignedEas(eas)
+
+	var sigValue []byte
+	for _, ea := range eas {
+		if eaNameKey(ea.EaName) == SignatureEaName {
+			sigValue = ea.EaValue
+		}
+	}
+
+	if len(sigValue) == 0 {
+		for _, ea := range unsigned {
+			report.Entries = append(report.Entries, EntryVerification{Name: ea.EaName, Status: SignatureMissing})
+		}
+
+		return report, nil
+	}
+
+	var sigs eaSignatures
+	if err := json.Unmarshal(sigValue, &sigs); err != nil {
+		return nil, fmt.Errorf("invalid signature EA: %w", err)
+	}
+	if sigs.Version != signatureVersion {
+		return nil, fmt.Errorf("unsupported signature EA version %d", sigs.Version)
+	}
+	if sigs.Algorithm != verifier.Algorithm() {
+		return nil, fmt.Errorf("EAs are signed with %s, can not verify with %s", sigs.Algorithm, verifier.Algorithm())
+	}
+	if sigs.KeyID != "" && verifier.KeyID() != "" && sigs.KeyID != verifier.KeyID() {
+		return nil, fmt.Errorf("EAs are signed with key %q, can not verify with key %q", sigs.KeyID, verifier.KeyID())
+	}
+
+	report.KeyID = sigs.KeyID
+	report.SignedAt = time.Unix(sigs.SignedAt, 0)
+
+	stale := opts.MaxAge > 0 && time.Since(report.SignedAt) > opts.MaxAge
+	checked := func(ok bool) SignatureStatus {
+		switch {
+		case !ok:
+			return SignatureInvalid
+		case stale:
+			return SignatureStale
+		}
+		return SignatureValid
+	}
+
+	if len(sigs.Manifest) != 0 {
+		report.Manifest = checked(verifier.Verify(canonicalManifest(&sigs), sigs.Manifest))
+	}
+
+	if len(sigs.Entries) != 0 {
+		byName := make(map[string][]byte, len(sigs.Entries))
+		for _, e := range sigs.Entries {
+			byName[eaNameKey(e.Name)] = e.Signature
+		}
+
+		for _, ea := range unsigned {
+			key := eaNameKey(ea.EaName)
+			sig, ok := byName[key]
+			if !ok {
+				report.Entries = append(report.Entries, EntryVerification{Name: ea.EaName, Status: SignatureMissing})
+				continue
+			}
+			delete(byName, key)
+
+			report.Entries = append(report.Entries, EntryVerification{
+				Name:   ea.EaName,
+				Status: checked(verifier.Verify(canonicalEntry(ea, sigs.SignedAt), sig)),
+			})
+		}
+
+		for _, e := range sigs.Entries {
+			if _, ok := byName[eaNameKey(e.Name)]; ok {
+				report.Entries = append(report.Entries, EntryVerification{Name: e.Name, Status: SignatureStale})
+			}
+		}
+	}
+
+	switch {
+	case len(sigs.Set) != 0:
+		report.Set = checked(verifier.Verify(canonicalSet(eas, sigs.SignedAt), sigs.Set))
+	case sigs.Mode&SignSet != 0:
+		// the set signature was removed
+		report.Set = SignatureInvalid
+	}
+
+	return report, nil
+}
+
+// SignFileEa signs EAs of the file in path and writes the signature EA into it, DefaultStore() is used if store is nil.
+func SignFileEa(path string, followReparsePoint bool, signer EaSigner, mode SignMode, store EaStore) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	eas, err := store.QueryFileEa(path, followReparsePoint)
+	if err != nil {
+		return err
+	}
+
+	sigEa, err := SignEas(eas, signer, mode)
+	if err != nil {
+		return err
+	}
+
+	return store.EaWriteFile(path, followReparsePoint, sigEa)
+}
+
+// VerifyFileEa verifies EAs of the file in path with the signature EA in it, DefaultStore() is used if store is nil.
+func VerifyFileEa(path string, followReparsePoint bool, verifier EaVerifier, opts *VerifyOptions, store EaStore) (*VerifyReport, error) {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return nil, err
+	}
+
+	eas, err := store.QueryFileEa(path, followReparsePoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return VerifyEas(eas, verifier, opts)
+}
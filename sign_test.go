@@ -0,0 +1,168 @@
+package ntfs_ea
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignFileEa(t *testing.T) {
+	root := createTestTree(t, "licensed.txt")
+	target := filepath.Join(root, "licensed.txt")
+	store := NewMemStore()
+	key := HMACKey{ID: "test", Key: []byte("secret key")}
+
+	err := store.EaWriteFile(target, false,
+		EaInfo{EaName: "LICENSE", EaValue: []byte("licensed to test")},
+		EaInfo{Flags: NeedEa, EaName: "EXPIRES", EaValue: []byte("2030-01-01")},
+	)
+	if err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+
+	if err = SignFileEa(target, false, key, SignEntries|SignSet, store); err != nil {
+		t.Fatalf("SignFileEa failed: %v", err)
+	}
+
+	report, err := VerifyFileEa(target, false, key, nil, store)
+	if err != nil {
+		t.Fatalf("VerifyFileEa failed: %v", err)
+	}
+	if !report.Valid() || len(report.Entries) != 2 || report.KeyID != "test" {
+		t.Fatalf("Expected valid signatures, got %+v", report)
+	}
+
+	// tamper the value, remove an EA and add an unsigned one
+	err = store.EaWriteFile(target, false,
+		EaInfo{EaName: "LICENSE", EaValue: []byte("licensed to someone else")},
+		EaInfo{EaName: "EXPIRES"},
+		EaInfo{EaName: "ADDED", EaValue: []byte("unsigned")},
+	)
+	if err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+
+	report, err = VerifyFileEa(target, false, key, nil, store)
+	if err != nil {
+		t.Fatalf("VerifyFileEa failed: %v", err)
+	}
+
+	expected := map[string]SignatureStatus{
+		"LICENSE": SignatureInvalid,
+		"ADDED":   SignatureMissing,
+		"EXPIRES": SignatureStale,
+	}
+	for _, e := range report.Entries {
+		if expected[e.Name] != e.Status {
+			t.Fatalf("Expected %s for %s, got %s", expected[e.Name], e.Name, e.Status)
+		}
+		delete(expected, e.Name)
+	}
+	if len(expected) != 0 || report.Set != SignatureInvalid || report.Valid() {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+}
+
+func TestSignEasEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	eas := []EaInfo{{EaName: "VERSION", EaValue: []byte("1.0")}}
+
+	sigEa, err := SignEas(eas, Ed25519Signer{Key: priv}, SignSet)
+	if err != nil {
+		t.Fatalf("SignEas failed: %v", err)
+	}
+	eas = append(eas, sigEa)
+
+	report, err := VerifyEas(eas, Ed25519Verifier{Key: pub}, nil)
+	if err != nil || !report.Valid() || len(report.Entries) != 0 {
+		t.Fatalf("Expected valid set signature, got %+v, %v", report, err)
+	}
+
+	time.Sleep(time.Millisecond)
+	if report, _ = VerifyEas(eas, Ed25519Verifier{Key: pub}, &VerifyOptions{MaxAge: time.Nanosecond}); report.Set != SignatureStale {
+		t.Fatalf("Expected stale signature, got %s", report.Set)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	if report, _ = VerifyEas(eas, Ed25519Verifier{Key: otherPub}, nil); report.Set != SignatureInvalid {
+		t.Fatalf("Expected invalid signature with another key, got %s", report.Set)
+	}
+
+	if _, err = VerifyEas(eas, HMACKey{Key: []byte("key")}, nil); err == nil {
+		t.Fatalf("Expected error for algorithm mismatch")
+	}
+}
+
+func TestSignKeyErrors(t *testing.T) {
+	eas := []EaInfo{{EaName: "VERSION", EaValue: []byte("1.0")}}
+
+	if _, err := SignEas(eas, HMACKey{ID: "empty"}, SignSet); err == nil {
+		t.Fatal("Expected error for empty HMAC key")
+	}
+
+	sigEa, err := SignEas(eas, HMACKey{ID: "a", Key: []byte("key")}, SignSet)
+	if err != nil {
+		t.Fatalf("SignEas failed: %v", err)
+	}
+	eas = append(eas, sigEa)
+
+	if _, err = VerifyEas(eas, HMACKey{ID: "b", Key: []byte("key")}, nil); err == nil {
+		t.Fatal("Expected error for key ID mismatch")
+	}
+	if report, err := VerifyEas(eas, HMACKey{Key: []byte("key")}, nil); err != nil || !report.Valid() {
+		t.Fatalf("Expected valid signature with a verifier without key ID, got %+v, %v", report, err)
+	}
+}
+
+func TestSignatureRemovalDetected(t *testing.T) {
+	key := HMACKey{ID: "test", Key: []byte("secret key")}
+	eas := []EaInfo{
+		{EaName: "KEEP", EaValue: []byte("kept")},
+		{EaName: "X", EaValue: []byte("removed later")},
+	}
+
+	sigEa, err := SignEas(eas, key, SignEntries|SignSet)
+	if err != nil {
+		t.Fatalf("SignEas failed: %v", err)
+	}
+
+	// remove X, its entry signature and the set signature
+	var sigs eaSignatures
+	if err = json.Unmarshal(sigEa.EaValue, &sigs); err != nil {
+		t.Fatal(err)
+	}
+	sigs.Entries = sigs.Entries[:1]
+	sigs.Set = nil
+	if sigEa.EaValue, err = json.Marshal(sigs); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyEas([]EaInfo{eas[0], sigEa}, key, nil)
+	if err != nil {
+		t.Fatalf("VerifyEas failed: %v", err)
+	}
+	if report.Valid() || report.Manifest != SignatureInvalid || report.Set != SignatureInvalid {
+		t.Fatalf("Expected removal to be detected, got %+v", report)
+	}
+
+	// the mode can not be changed either
+	sigs.Mode = SignEntries
+	if sigEa.EaValue, err = json.Marshal(sigs); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ = VerifyEas([]EaInfo{eas[0], sigEa}, key, nil); report.Valid() {
+		t.Fatalf("Expected changed mode to be detected, got %+v", report)
+	}
+}
+
+func TestHMACKeyEmpty(t *testing.T) {
+	if (HMACKey{}).Verify([]byte("message"), []byte{}) || (HMACKey{}).Verify([]byte("message"), nil) {
+		t.Fatal("Empty HMAC key should not verify any signature")
+	}
+}
@@ -0,0 +1,378 @@
+package ntfs_ea
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EA snapshots
+//
+// Snapshots of a tree are kept in a directory as "<name>.snapshot.json", each holding the fingerprint of the EA set of every path
+// with EAs at the time it was taken. A full snapshot has all EA sets, while an incremental snapshot is based on another snapshot
+// and only has EA sets of paths added or changed since then and the paths whose EAs were removed. EA sets are stored in the
+// export format of MarshalEaSetsJSON, and a snapshot is restored by applying its chain from the full snapshot.
+
+// SnapshotVersion is the version of the snapshot format written by this package.
+const SnapshotVersion = 1
+
+const snapshotExt = ".snapshot.json"
+
+// ErrSnapshot is returned when a snapshot is malformed or its chain is broken.
+var ErrSnapshot = errors.New("invalid EA snapshot")
+
+// Snapshot is EA sets of a tree at a point, see TakeSnapshot.
+type Snapshot struct {
+	Name         string
+	Base         string // name of the snapshot this one is based on, empty for a full snapshot
+	CreatedAt    time.Time
+	Root         string
+	Fingerprints map[string]string   // EaSetFingerprint of every path with EAs, keyed by slash separated path relative to Root
+	Changed      map[string][]EaInfo // EA sets of paths added or changed since Base, every EA set for a full snapshot
+	Removed      []string            // paths whose EAs were removed since Base
+	Failed       []string            // paths which could not be walked, see SnapshotOptions.AllowErrors
+}
+
+type snapshotFile struct {
+	Version      int               `json:"version"`
+	Name         string            `json:"name"`
+	Base         string            `json:"base,omitempty"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	Root         string            `json:"root,omitempty"`
+	Fingerprints map[string]string `json:"fingerprints"`
+	Removed      []string          `json:"removed,omitempty"`
+	Failed       []string          `json:"failed,omitempty"`
+	Sets         json.RawMessage   `json:"sets"`
+}
+
+// EaSetFingerprint returns the SHA-256 hex of the canonical form of eas, which does not depend on the order and case of names.
+// EAs with empty value are ignored.
+func EaSetFingerprint(eas []EaInfo) string {
+	var sorted []EaInfo
+	for _, ea := range eas {
+		if len(ea.EaValue) != 0 {
+			sorted = append(sorted, ea)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return eaNameKey(sorted[i].EaName) < eaNameKey(sorted[j].EaName)
+	})
+
+	h := sha256.New()
+	for _, ea := range sorted {
+		h.Write(appendCanonicalEa(nil, ea))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func snapshotPath(dir, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+
+	return filepath.Join(dir, name+snapshotExt), nil
+}
+
+// SnapshotOptions is options for TakeSnapshot.
+type SnapshotOptions struct {
+	Walk *WalkOptions // options to walk the tree with
+
+	// AllowRootChange allows a base snapshot taken from another root, e.g. after the tree was moved.
+	// Paths are compared relative to each root.
+	AllowRootChange bool
+
+	// AllowErrors takes the snapshot even if some paths can not be walked, e.g. files without access on a large share.
+	// The failed paths are recorded in Snapshot.Failed, and they and paths under them keep their fingerprints in the base snapshot.
+	// Otherwise the *WalkError is returned and no snapshot is taken.
+	AllowErrors bool
+}
+
+// TakeSnapshot walks the tree rooted at root with CollectEaSets and saves a snapshot named name into dir.
+// If base is not empty, the snapshot only stores changes since the snapshot named base, otherwise all EA sets are stored.
+// The base snapshot should be taken from the same root unless opts.AllowRootChange is set.
+// A path which can not be walked fails the snapshot unless opts.AllowErrors is set.
+func TakeSnapshot(dir, name, root, base string, opts *SnapshotOptions) (*Snapshot, error) {
+	if opts == nil {
+		opts = &SnapshotOptions{}
+	}
+
+	p, err := snapshotPath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(p); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", name)
+	}
+
+	var baseSnap *Snapshot
+	if base != "" {
+		if baseSnap, err = LoadSnapshot(dir, base); err != nil {
+			return nil, err
+		}
+		if !opts.AllowRootChange && filepath.Clean(baseSnap.Root) != filepath.Clean(root) {
+			return nil, fmt.Errorf("%w: base %s was taken from %s, not %s", ErrSnapshot, base, baseSnap.Root, root)
+		}
+	}
+
+	sets, err := CollectEaSets(root, opts.Walk)
+	var failed []string
+	if err != nil {
+		var walkErr *WalkError
+		if !opts.AllowErrors || !errors.As(err, &walkErr) || walkErr != err {
+			return nil, err
+		}
+		if failed, err = failedSnapshotPaths(root, walkErr); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Snapshot{
+		Name:         name,
+		Base:         base,
+		CreatedAt:    time.Now().UTC(),
+		Root:         root,
+		Fingerprints: make(map[string]string, len(sets)),
+		Changed:      make(map[string][]EaInfo),
+		Failed:       failed,
+	}
+
+	for path, eas := range sets {
+		fp := EaSetFingerprint(eas)
+		s.Fingerprints[path] = fp
+
+		if baseSnap == nil || baseSnap.Fingerprints[path] != fp {
+			s.Changed[path] = eas
+		}
+	}
+	if baseSnap != nil {
+		for path, fp := range baseSnap.Fingerprints {
+			if _, ok := sets[path]; ok {
+				continue
+			}
+			// EAs of a path which could not be walked are taken as unchanged
+			if underSnapshotPaths(path, failed) {
+				s.Fingerprints[path] = fp
+				continue
+			}
+			s.Removed = append(s.Removed, path)
+		}
+		sort.Strings(s.Removed)
+	}
+
+	if err = writeSnapshot(p, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// failedSnapshotPaths returns the sorted slash separated paths relative to root of errors in walkErr.
+func failedSnapshotPaths(root string, walkErr *WalkError) ([]string, error) {
+	failed := make([]string, 0, len(walkErr.Errors))
+	for _, e := range walkErr.Errors {
+		rel, err := filepath.Rel(root, e.Path)
+		if err != nil {
+			return nil, err
+		}
+		failed = append(failed, filepath.ToSlash(rel))
+	}
+	sort.Strings(failed)
+
+	return failed, nil
+}
+
+// underSnapshotPaths reports whether p is one of paths or under one of them.
+func underSnapshotPaths(p string, paths []string) bool {
+	for _, f := range paths {
+		if f == "." || p == f || strings.HasPrefix(p, f+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeSnapshot(p string, s *Snapshot) error {
+	sets, err := MarshalEaSetsJSON(s.Changed, nil)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(&snapshotFile{
+		Version:      SnapshotVersion,
+		Name:         s.Name,
+		Base:         s.Base,
+		CreatedAt:    s.CreatedAt,
+		Root:         s.Root,
+		Fingerprints: s.Fingerprints,
+		Removed:      s.Removed,
+		Failed:       s.Failed,
+		Sets:         sets,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write into a temporary file first, so a snapshot is never left half written
+	tmp := p + ".tmp"
+	if err = os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// LoadSnapshot reads the snapshot named name from dir.
+func LoadSnapshot(dir, name string) (*Snapshot, error) {
+	p, err := snapshotPath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var f snapshotFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrSnapshot, name, err)
+	}
+	if f.Version != SnapshotVersion {
+		return nil, fmt.Errorf("%w: %s: unsupported version %d", ErrSnapshot, name, f.Version)
+	}
+	if f.Name != name {
+		return nil, fmt.Errorf("%w: %s has name %q", ErrSnapshot, name, f.Name)
+	}
+
+	changed, err := UnmarshalEaSetsJSON(f.Sets)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrSnapshot, name, err)
+	}
+
+	return &Snapshot{
+		Name:         f.Name,
+		Base:         f.Base,
+		CreatedAt:    f.CreatedAt,
+		Root:         f.Root,
+		Fingerprints: f.Fingerprints,
+		Changed:      changed,
+		Removed:      f.Removed,
+		Failed:       f.Failed,
+	}, nil
+}
+
+// ListSnapshots returns names of snapshots in dir sorted by name.
+func ListSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if name := strings.TrimSuffix(e.Name(), snapshotExt); name != e.Name() && e.Type().IsRegular() {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// SnapshotChain returns the snapshots needed to restore the snapshot named name, from the full snapshot to it.
+func SnapshotChain(dir, name string) ([]*Snapshot, error) {
+	var chain []*Snapshot
+	seen := make(map[string]bool)
+
+	for next := name; next != ""; {
+		if seen[next] {
+			return nil, fmt.Errorf("%w: chain of %s has a cycle at %s", ErrSnapshot, name, next)
+		}
+		seen[next] = true
+
+		s, err := LoadSnapshot(dir, next)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, s)
+		next = s.Base
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	return chain, nil
+}
+
+// ResolveSnapshot applies the chain of the snapshot named name and returns EA sets of the tree at the snapshot.
+// Paths whose EAs were removed somewhere in the chain and not added back have empty EA sets.
+// The result is checked against fingerprints in the snapshot.
+func ResolveSnapshot(dir, name string) (map[string][]EaInfo, error) {
+	chain, err := SnapshotChain(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveChain(chain)
+}
+
+func resolveChain(chain []*Snapshot) (map[string][]EaInfo, error) {
+	sets := make(map[string][]EaInfo)
+	for _, s := range chain {
+		for path, eas := range s.Changed {
+			sets[path] = eas
+		}
+		for _, path := range s.Removed {
+			sets[path] = []EaInfo{}
+		}
+	}
+
+	last := chain[len(chain)-1]
+	name := last.Name
+	for path, eas := range sets {
+		fp, ok := last.Fingerprints[path]
+		if !ok && len(eas) == 0 {
+			continue
+		}
+		if fp != EaSetFingerprint(eas) {
+			return nil, fmt.Errorf("%w: EA set of %s does not match the fingerprint in %s", ErrSnapshot, path, name)
+		}
+	}
+	for path := range last.Fingerprints {
+		if _, ok := sets[path]; !ok {
+			return nil, fmt.Errorf("%w: EA set of %s is missing in the chain of %s", ErrSnapshot, path, name)
+		}
+	}
+
+	return sets, nil
+}
+
+// RestoreSnapshot writes EA sets at the snapshot named name into paths under root with RestoreBundle.
+// Set opts.Exact to also remove EAs added after the snapshot, paths which are not in the chain up to the snapshot are left as they are.
+func RestoreSnapshot(dir, name, root string, opts *RestoreOptions) (*RestoreReport, error) {
+	chain, err := SnapshotChain(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	sets, err := resolveChain(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	s := chain[len(chain)-1]
+	return RestoreBundle(&Bundle{Version: BundleVersion, CreatedAt: s.CreatedAt, Root: s.Root, Sets: sets}, root, opts)
+}
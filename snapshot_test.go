@@ -0,0 +1,188 @@
+package ntfs_ea
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshots(t *testing.T) {
+	root := createTestTree(t, "a.txt", "b.txt", "sub/c.txt")
+	dir := t.TempDir()
+	store := NewMemStore()
+	opts := &WalkOptions{Store: store}
+	snapOpts := &SnapshotOptions{Walk: opts}
+
+	write := func(f string, eas ...EaInfo) {
+		t.Helper()
+		if err := store.EaWriteFile(filepath.Join(root, filepath.FromSlash(f)), false, eas...); err != nil {
+			t.Fatalf("EaWriteFile failed: %v", err)
+		}
+	}
+
+	write("a.txt", EaInfo{EaName: "A", EaValue: []byte("1")})
+	write("b.txt", EaInfo{EaName: "B", EaValue: []byte("1")})
+	full, err := TakeSnapshot(dir, "day1", root, "", snapOpts)
+	if err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+	if len(full.Changed) != 2 || len(full.Fingerprints) != 2 {
+		t.Fatalf("Unexpected full snapshot: %+v", full)
+	}
+	day1, _ := CollectEaSets(root, opts)
+
+	// change a.txt, remove EAs of b.txt and add sub/c.txt
+	write("a.txt", EaInfo{EaName: "A", EaValue: []byte("2")})
+	write("b.txt", EaInfo{EaName: "B"})
+	write("sub/c.txt", EaInfo{EaName: "C", EaValue: []byte("1")})
+	incr, err := TakeSnapshot(dir, "day2", root, "day1", snapOpts)
+	if err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+	if len(incr.Changed) != 2 || incr.Changed["a.txt"] == nil || incr.Changed["sub/c.txt"] == nil ||
+		!reflect.DeepEqual(incr.Removed, []string{"b.txt"}) {
+		t.Fatalf("Unexpected incremental snapshot: %+v", incr)
+	}
+
+	// nothing changed
+	same, err := TakeSnapshot(dir, "day3", root, "day2", snapOpts)
+	if err != nil || len(same.Changed) != 0 || len(same.Removed) != 0 {
+		t.Fatalf("Unexpected snapshot: %+v, %v", same, err)
+	}
+	if _, err = TakeSnapshot(dir, "day3", root, "day2", snapOpts); err == nil {
+		t.Fatal("Expected error for existing snapshot")
+	}
+
+	// a base taken from another root
+	other := createTestTree(t, "a.txt")
+	if _, err = TakeSnapshot(dir, "moved", other, "day3", snapOpts); !errors.Is(err, ErrSnapshot) {
+		t.Fatalf("Expected ErrSnapshot for base from another root, got %v", err)
+	}
+	if _, err = TakeSnapshot(dir, "moved", other, "day3", &SnapshotOptions{Walk: opts, AllowRootChange: true}); err != nil {
+		t.Fatalf("TakeSnapshot with AllowRootChange failed: %v", err)
+	}
+	if err = os.Remove(filepath.Join(dir, "moved.snapshot.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if names, err := ListSnapshots(dir); err != nil || !reflect.DeepEqual(names, []string{"day1", "day2", "day3"}) {
+		t.Fatalf("Unexpected snapshots: %v, %v", names, err)
+	}
+
+	sets, err := ResolveSnapshot(dir, "day3")
+	if err != nil || len(sets["b.txt"]) != 0 || string(sets["a.txt"][0].EaValue) != "2" || len(sets["sub/c.txt"]) != 1 {
+		t.Fatalf("Unexpected sets: %v, %v", sets, err)
+	}
+
+	// restore the tree to day1
+	report, err := RestoreSnapshot(dir, "day1", root, &RestoreOptions{Store: store, Exact: true, Verify: true})
+	if err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v, %+v", err, report)
+	}
+	if restored, _ := CollectEaSets(root, opts); !reflect.DeepEqual(restored["a.txt"], day1["a.txt"]) || !reflect.DeepEqual(restored["b.txt"], day1["b.txt"]) {
+		t.Fatalf("Unexpected sets after restore: %v", restored)
+	}
+
+	// and back to day3, removing EAs of b.txt
+	if _, err = RestoreSnapshot(dir, "day3", root, &RestoreOptions{Store: store, Exact: true, Verify: true}); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+	if restored, _ := CollectEaSets(root, opts); !reflect.DeepEqual(restored, map[string][]EaInfo{"a.txt": sets["a.txt"], "sub/c.txt": sets["sub/c.txt"]}) {
+		t.Fatalf("Unexpected sets after restore: %v", restored)
+	}
+
+	// a broken chain
+	if err = os.Remove(filepath.Join(dir, "day2.snapshot.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ResolveSnapshot(dir, "day3"); err == nil {
+		t.Fatal("Expected error for broken chain")
+	}
+}
+
+func TestResolveSnapshotMismatch(t *testing.T) {
+	dir := t.TempDir()
+	s := &Snapshot{
+		Name:         "bad",
+		Fingerprints: map[string]string{"a": EaSetFingerprint([]EaInfo{{EaName: "A", EaValue: []byte("1")}})},
+		Changed:      map[string][]EaInfo{"a": {{EaName: "A", EaValue: []byte("2")}}},
+	}
+	p, _ := snapshotPath(dir, s.Name)
+	if err := writeSnapshot(p, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ResolveSnapshot(dir, "bad"); !errors.Is(err, ErrSnapshot) {
+		t.Fatalf("Expected ErrSnapshot, got %v", err)
+	}
+	if _, err := LoadSnapshot(dir, "../bad"); err == nil {
+		t.Fatal("Expected error for invalid name")
+	}
+}
+
+func TestEaSetFingerprint(t *testing.T) {
+	a := []EaInfo{{EaName: "a", EaValue: []byte("1")}, {EaName: "B", EaValue: []byte("2")}, {EaName: "EMPTY"}}
+	b := []EaInfo{{EaName: "B", EaValue: []byte("2")}, {EaName: "A", EaValue: []byte("1")}}
+	if EaSetFingerprint(a) != EaSetFingerprint(b) {
+		t.Fatal("Fingerprint should not depend on order, case and empty EAs")
+	}
+
+	b[0].Flags = NeedEa
+	if EaSetFingerprint(a) == EaSetFingerprint(b) {
+		t.Fatal("Fingerprint should depend on flags")
+	}
+}
+
+// deniedStore fails to query EAs of the path denied.
+type deniedStore struct {
+	EaStore
+	denied string
+}
+
+func (s deniedStore) QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]EaInfo, error) {
+	if path == s.denied {
+		return nil, fs.ErrPermission
+	}
+
+	return s.EaStore.QueryFileEa(path, followReparsePoint, queryName...)
+}
+
+func TestTakeSnapshotAllowErrors(t *testing.T) {
+	root := createTestTree(t, "a.txt", "denied.txt")
+	dir := t.TempDir()
+	store := NewMemStore()
+
+	for _, f := range []string{"a.txt", "denied.txt"} {
+		if err := store.EaWriteFile(filepath.Join(root, f), false, EaInfo{EaName: "A", EaValue: []byte(f)}); err != nil {
+			t.Fatalf("EaWriteFile failed: %v", err)
+		}
+	}
+	if _, err := TakeSnapshot(dir, "day1", root, "", &SnapshotOptions{Walk: &WalkOptions{Store: store}}); err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+
+	walk := &WalkOptions{Store: deniedStore{EaStore: store, denied: filepath.Join(root, "denied.txt")}}
+	var walkErr *WalkError
+	if _, err := TakeSnapshot(dir, "day2", root, "day1", &SnapshotOptions{Walk: walk}); !errors.As(err, &walkErr) {
+		t.Fatalf("Expected *WalkError, got %v", err)
+	}
+
+	s, err := TakeSnapshot(dir, "day2", root, "day1", &SnapshotOptions{Walk: walk, AllowErrors: true})
+	if err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+	if !reflect.DeepEqual(s.Failed, []string{"denied.txt"}) || len(s.Removed) != 0 || len(s.Fingerprints) != 2 {
+		t.Fatalf("Expected the denied path to be kept as unchanged, got %+v", s)
+	}
+
+	loaded, err := LoadSnapshot(dir, "day2")
+	if err != nil || !reflect.DeepEqual(loaded.Failed, s.Failed) {
+		t.Fatalf("Unexpected loaded snapshot: %+v, %v", loaded, err)
+	}
+	if sets, err := ResolveSnapshot(dir, "day2"); err != nil || string(sets["denied.txt"][0].EaValue) != "denied.txt" {
+		t.Fatalf("Unexpected sets: %v, %v", sets, err)
+	}
+}
@@ -0,0 +1,181 @@
+package ntfs_ea
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// EaStore is a backend which can query and write EAs of files, the methods have the same semantics as QueryFileEa and EaWriteFile.
+type EaStore interface {
+	QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]EaInfo, error)
+	EaWriteFile(dstPath string, followReparsePoint bool, eaInfo ...EaInfo) error
+}
+
+var (
+	// ErrNoDefaultStore is returned when no EA store is given and the platform does not provide a default one.
+	ErrNoDefaultStore = errors.New("no default EA store for this platform")
+	// ErrEaNotFound is returned when the EA with the requested name does not exist.
+	ErrEaNotFound = errors.New("EA not found")
+)
+
+// DefaultStore returns the EA store for the current platform, FileStore for Windows and XattrStore for Linux(ntfs-3g), nil otherwise.
+func DefaultStore() EaStore {
+	return defaultStore()
+}
+
+func storeOrDefault(store EaStore) (EaStore, error) {
+	if store != nil {
+		return store, nil
+	}
+
+	if store = defaultStore(); store == nil {
+		return nil, ErrNoDefaultStore
+	}
+
+	return store, nil
+}
+
+// queryEa queries a single EA with name from path, ErrEaNotFound is returned if it does not exist.
+func queryEa(store EaStore, path string, followReparsePoint bool, name string) (EaInfo, error) {
+	eas, err := store.QueryFileEa(path, followReparsePoint, name)
+	if err != nil {
+		return EaInfo{}, err
+	}
+
+	for _, ea := range eas {
+		if eaNameKey(ea.EaName) == eaNameKey(name) && len(ea.EaValue) != 0 {
+			return ea, nil
+		}
+	}
+
+	return EaInfo{}, fmt.Errorf("%w: %s in %s", ErrEaNotFound, name, path)
+}
+
+// MemStore is an in-memory EA store keyed by absolute path, mainly for testing and for inspecting EA sets without touching the file system.
+//
+// EA names are stored in upper case as NTFS does, and the 64KB limit of EA data per file is enforced when writing.
+// followReparsePoint is ignored as MemStore does not resolve paths.
+type MemStore struct {
+	mu  sync.RWMutex
+	eas map[string][]EaInfo
+}
+
+// NewMemStore creates an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		eas: make(map[string][]EaInfo),
+	}
+}
+
+func memStoreKey(path string) string {
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+
+	return filepath.Clean(path)
+}
+
+// eaNameKey returns the key to compare EA names with, NTFS stores EA names in upper case.
+func eaNameKey(name string) string {
+	return strings.ToUpper(name)
+}
+
+func cloneEaInfo(ea EaInfo) EaInfo {
+	ea.EaValue = append([]byte(nil), ea.EaValue...)
+
+	return ea
+}
+
+// QueryFileEa returns the EAs stored for path, for names in queryName which do not exist, an EaInfo with empty EaValue is returned as NtQueryEaFile does.
+func (s *MemStore) QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]EaInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var eaInfoArr []EaInfo
+	for _, ea := range filterEaInfo(s.eas[memStoreKey(path)], queryName) {
+		eaInfoArr = append(eaInfoArr, cloneEaInfo(ea))
+	}
+
+	return eaInfoArr, nil
+}
+
+// EaWriteFile adds or replaces EAs for dstPath, an EaInfo with empty EaValue removes the EA with the according EaName.
+func (s *MemStore) EaWriteFile(dstPath string, followReparsePoint bool, eaInfo ...EaInfo) error {
+	if len(eaInfo) == 0 {
+		return errors.New("EA to write is empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memStoreKey(dstPath)
+
+	merged, err := mergeEaInfo(s.eas[key], eaInfo)
+	if err != nil {
+		return err
+	}
+
+	if len(merged) == 0 {
+		delete(s.eas, key)
+	} else {
+		s.eas[key] = merged
+	}
+
+	return nil
+}
+
+// Paths returns the paths which have EAs in the store.
+func (s *MemStore) Paths() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	paths := make([]string, 0, len(s.eas))
+	for path := range s.eas {
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+// mergeEaInfo applies updates to current the way NtSetEaFile does and checks that the result still fits in 64KB.
+func mergeEaInfo(current []EaInfo, updates []EaInfo) ([]EaInfo, error) {
+	merged := make([]EaInfo, 0, len(current)+len(updates))
+	for _, ea := range current {
+		merged = append(merged, cloneEaInfo(ea))
+	}
+
+	for _, ea := range updates {
+		ea = cloneEaInfo(ea)
+		ea.EaName = eaNameKey(ea.EaName)
+
+		idx := -1
+		for i := range merged {
+			if merged[i].EaName == ea.EaName {
+				idx = i
+				break
+			}
+		}
+
+		switch {
+		case len(ea.EaValue) == 0 && idx >= 0:
+			merged = append(merged[:idx], merged[idx+1:]...)
+		case len(ea.EaValue) == 0:
+			// nothing to remove
+		case idx >= 0:
+			merged[idx] = ea
+		default:
+			merged = append(merged, ea)
+		}
+	}
+
+	if len(merged) != 0 {
+		if _, err := convertToFullInfoBuf(merged); err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,231 @@
+//go:build linux
+// +build linux
+
+package ntfs_ea
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// XattrNtfsEa is the extended attribute which ntfs-3g uses to expose the whole EA set of a file as chained FILE_FULL_EA_INFORMATION entries.
+const XattrNtfsEa = "system.ntfs_ea"
+
+// XattrStore is an EA store for NTFS volumes mounted with ntfs-3g, it reads and writes the system.ntfs_ea extended attribute.
+type XattrStore struct{}
+
+func getXattr(path, attr string, followReparsePoint bool) ([]byte, error) {
+	get := unix.Lgetxattr
+	if followReparsePoint {
+		get = unix.Getxattr
+	}
+
+	for {
+		sz, err := get(path, attr, nil)
+		if err != nil {
+			return nil, err
+		}
+		if sz == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, sz)
+		n, err := get(path, attr, buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue // grown since the size query
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return buf[:n], nil
+	}
+}
+
+func (XattrStore) QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]EaInfo, error) {
+	buf, err := getXattr(path, XattrNtfsEa, followReparsePoint)
+	if errors.Is(err, unix.ENODATA) {
+		buf, err = nil, nil
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+
+	eas, err := parseFullInfoBuf(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterEaInfo(eas, queryName), nil
+}
+
+func (s XattrStore) EaWriteFile(dstPath string, followReparsePoint bool, eaInfo ...EaInfo) error {
+	if len(eaInfo) == 0 {
+		return errors.New("EA to write is empty")
+	}
+
+	current, err := s.QueryFileEa(dstPath, followReparsePoint)
+	if err != nil {
+		return err
+	}
+
+	merged, err := mergeEaInfo(current, eaInfo)
+	if err != nil {
+		return err
+	}
+
+	if len(merged) == 0 {
+		remove := unix.Lremovexattr
+		if followReparsePoint {
+			remove = unix.Removexattr
+		}
+
+		err = remove(dstPath, XattrNtfsEa)
+		if err != nil && !errors.Is(err, unix.ENODATA) {
+			return &fs.PathError{Op: "removexattr", Path: dstPath, Err: err}
+		}
+
+		return nil
+	}
+
+	buf, err := convertToFullInfoBuf(merged)
+	if err != nil {
+		return err
+	}
+
+	set := unix.Lsetxattr
+	if followReparsePoint {
+		set = unix.Setxattr
+	}
+
+	if err = set(dstPath, XattrNtfsEa, buf, 0); err != nil {
+		return &fs.PathError{Op: "setxattr", Path: dstPath, Err: err}
+	}
+
+	return nil
+}
+
+func defaultStore() EaStore {
+	return XattrStore{}
+}
+
+// SambaStore is an EA store for the local disk of a Samba server, it reads and writes EAs as Samba does, see SambaXattrsToEas.
+type SambaStore struct{}
+
+func listXattr(path string, followReparsePoint bool) ([]string, error) {
+	list := unix.Llistxattr
+	if followReparsePoint {
+		list = unix.Listxattr
+	}
+
+	for {
+		sz, err := list(path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if sz == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, sz)
+		n, err := list(path, buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, name := range bytes.Split(buf[:n], []byte{0}) {
+			if len(name) != 0 {
+				names = append(names, string(name))
+			}
+		}
+
+		return names, nil
+	}
+}
+
+// sambaXattrs returns the extended attributes of path in the namespace Samba stores EAs in, including private ones.
+func sambaXattrs(path string, followReparsePoint bool) (map[string][]byte, error) {
+	names, err := listXattr(path, followReparsePoint)
+	if err != nil {
+		return nil, &fs.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range names {
+		if !strings.HasPrefix(name, SambaXattrPrefix) {
+			continue
+		}
+
+		value, err := getXattr(path, name, followReparsePoint)
+		if errors.Is(err, unix.ENODATA) {
+			continue // removed since listed
+		}
+		if err != nil {
+			return nil, &fs.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		xattrs[name] = value
+	}
+
+	return xattrs, nil
+}
+
+func (SambaStore) QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]EaInfo, error) {
+	xattrs, err := sambaXattrs(path, followReparsePoint)
+	if err != nil {
+		return nil, err
+	}
+
+	eas := SambaXattrsToEas(xattrs)
+	return filterEaInfo(eas, queryName), nil
+}
+
+func (SambaStore) EaWriteFile(dstPath string, followReparsePoint bool, eaInfo ...EaInfo) error {
+	if len(eaInfo) == 0 {
+		return errors.New("EA to write is empty")
+	}
+
+	current, err := sambaXattrs(dstPath, followReparsePoint)
+	if err != nil {
+		return err
+	}
+
+	updated, err := ApplyEasToSambaXattrs(current, eaInfo)
+	if err != nil {
+		return err
+	}
+
+	set, remove := unix.Lsetxattr, unix.Lremovexattr
+	if followReparsePoint {
+		set, remove = unix.Setxattr, unix.Removexattr
+	}
+
+	for name := range current {
+		if _, ok := updated[name]; ok {
+			continue
+		}
+
+		if err = remove(dstPath, name); err != nil && !errors.Is(err, unix.ENODATA) {
+			return &fs.PathError{Op: "removexattr", Path: dstPath, Err: err}
+		}
+	}
+
+	for name, value := range updated {
+		if old, ok := current[name]; ok && bytes.Equal(old, value) {
+			continue
+		}
+
+		if err = set(dstPath, name, value, 0); err != nil {
+			return &fs.PathError{Op: "setxattr", Path: dstPath, Err: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+//go:build linux
+// +build linux
+
+package ntfs_ea
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// NTFS_EA_TEST_DIR should point to a directory in an ntfs-3g mount to test XattrStore.
+func TestXattrStore(t *testing.T) {
+	dir := os.Getenv("NTFS_EA_TEST_DIR")
+	if dir == "" {
+		t.Skip("NTFS_EA_TEST_DIR is not set")
+	}
+
+	testFile := filepath.Join(dir, "xattrtest.txt")
+	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	defer os.Remove(testFile)
+
+	var store XattrStore
+
+	err := store.EaWriteFile(testFile, false, EaInfo{EaName: "TESTEA", EaValue: []byte("test value")})
+	if errors.Is(err, unix.ENOTSUP) {
+		t.Skip("system.ntfs_ea is not supported in", dir)
+	}
+	if err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+
+	err = WalkEas(testFile, func(path string, eas []EaInfo) error {
+		if len(eas) != 1 || eas[0].EaName != "TESTEA" || string(eas[0].EaValue) != "test value" {
+			t.Errorf("EA data mismatch: got %v", eas)
+		}
+		return nil
+	}, &WalkOptions{Store: store})
+	if err != nil {
+		t.Fatalf("WalkEas failed: %v", err)
+	}
+}
+
+func TestSambaStore(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "sambatest.txt")
+	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := unix.Setxattr(testFile, "user.DOSATTRIB", []byte("0x20"), 0); err != nil {
+		t.Skipf("user extended attributes are not supported: %v", err)
+	}
+
+	var store SambaStore
+
+	if err := store.EaWriteFile(testFile, false, EaInfo{EaName: "TestEa", EaValue: []byte("v1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.EaWriteFile(testFile, false, EaInfo{EaName: "TESTEA", EaValue: []byte("v2")}); err != nil {
+		t.Fatal(err)
+	}
+
+	eas, err := store.QueryFileEa(testFile, false)
+	if err != nil || len(eas) != 1 || eas[0].EaName != "TestEa" || string(eas[0].EaValue) != "v2" {
+		t.Fatalf("Unexpected EAs: %v, %v", eas, err)
+	}
+
+	eas, err = store.QueryFileEa(testFile, false, "testea", "missing")
+	if err != nil || len(eas) != 2 || string(eas[0].EaValue) != "v2" || eas[1].EaName != "MISSING" || len(eas[1].EaValue) != 0 {
+		t.Fatalf("Unexpected EAs: %v, %v", eas, err)
+	}
+
+	if err = store.EaWriteFile(testFile, false, EaInfo{EaName: "testea"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = unix.Getxattr(testFile, "user.TestEa", nil); !errors.Is(err, unix.ENODATA) {
+		t.Fatalf("Expected the xattr to be removed, got %v", err)
+	}
+	if _, err = unix.Getxattr(testFile, "user.DOSATTRIB", nil); err != nil {
+		t.Fatalf("Private xattr should be kept: %v", err)
+	}
+}
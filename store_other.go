@@ -0,0 +1,8 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package ntfs_ea
+
+func defaultStore() EaStore {
+	return nil
+}
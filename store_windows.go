@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package ntfs_ea
+
+// FileStore is an EA store which accesses EAs of files in NTFS with QueryFileEa and EaWriteFile.
+// Files without EA are queried as nil without printing a message, as trees are walked with the store.
+type FileStore struct{}
+
+func (FileStore) QueryFileEa(path string, followReparsePoint bool, queryName ...string) ([]EaInfo, error) {
+	return queryFileEa(path, followReparsePoint, true, queryName...)
+}
+
+func (FileStore) EaWriteFile(dstPath string, followReparsePoint bool, eaInfo ...EaInfo) error {
+	return EaWriteFile(dstPath, followReparsePoint, eaInfo...)
+}
+
+func defaultStore() EaStore {
+	return FileStore{}
+}
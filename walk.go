@@ -0,0 +1,242 @@
+package ntfs_ea
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ReparsePolicy decides how WalkEas and ApplyEas handle reparse points(symbolic links, junctions) found in the tree.
+// Directories reached through a reparse point are never descended into.
+type ReparsePolicy int
+
+const (
+	ReparseOpen   ReparsePolicy = iota // access EAs of the reparse point itself, same as followReparsePoint=false
+	ReparseFollow                      // access EAs of the target, same as followReparsePoint=true
+	ReparseSkip                        // do not visit reparse points
+)
+
+// WalkOptions configures WalkEas and ApplyEas, the zero value walks the tree with the default store.
+type WalkOptions struct {
+	Store       EaStore         // store to access EAs with, DefaultStore() if nil
+	Context     context.Context // stops the walk when done
+	Concurrency int             // number of workers querying or writing EAs, runtime.NumCPU() if not positive
+	Reparse     ReparsePolicy
+
+	// Progress is called after each path is processed, calls are serialized.
+	Progress func(WalkProgress)
+}
+
+// WalkProgress reports the state of WalkEas or ApplyEas after processing Path.
+type WalkProgress struct {
+	Path      string
+	Processed int64 // number of paths processed so far
+	Failed    int64 // number of paths failed so far
+}
+
+// WalkFunc is called by WalkEas with the EAs of each path in the tree, eas is empty if the path does not have any EA.
+// Returning fs.SkipAll stops the walk without error, other errors are collected in WalkError.
+type WalkFunc func(path string, eas []EaInfo) error
+
+// ApplyFunc is called by ApplyEas with the current EAs of each path in the tree and returns the EAs to write into the path.
+// Returning no EA leaves the path unchanged. Returning fs.SkipAll stops the walk without error, other errors are collected in WalkError.
+type ApplyFunc func(path string, eas []EaInfo) ([]EaInfo, error)
+
+// WalkError collects errors per path from WalkEas or ApplyEas.
+type WalkError struct {
+	Errors []*fs.PathError
+}
+
+func (e *WalkError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d paths failed:", len(e.Errors))
+	for _, err := range e.Errors {
+		sb.WriteString("\n\t")
+		sb.WriteString(err.Error())
+	}
+
+	return sb.String()
+}
+
+func (e *WalkError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// WalkEas walks the file tree rooted at root including root itself, queries EAs of each file and directory and calls fn with them.
+// fn is called from multiple goroutines when opts.Concurrency is not 1, so it must be safe for concurrent use.
+//
+// Errors for each path do not stop the walk, they are returned together as *WalkError after the whole tree is walked.
+func WalkEas(root string, fn WalkFunc, opts *WalkOptions) error {
+	return walkTree(root, opts, func(store EaStore, path string, followReparsePoint bool) (string, error) {
+		eas, err := store.QueryFileEa(path, followReparsePoint)
+		if err != nil {
+			return "query", err
+		}
+
+		return "walk", fn(path, eas)
+	})
+}
+
+// ApplyEas walks the file tree rooted at root like WalkEas and writes the EAs returned by fn into each path.
+// Writing follows the semantics of EaWriteFile, EAs not returned by fn are kept and EAs with empty EaValue are removed.
+func ApplyEas(root string, fn ApplyFunc, opts *WalkOptions) error {
+	return walkTree(root, opts, func(store EaStore, path string, followReparsePoint bool) (string, error) {
+		eas, err := store.QueryFileEa(path, followReparsePoint)
+		if err != nil {
+			return "query", err
+		}
+
+		toWrite, err := fn(path, eas)
+		if err != nil || len(toWrite) == 0 {
+			return "apply", err
+		}
+
+		return "write", store.EaWriteFile(path, followReparsePoint, toWrite...)
+	})
+}
+
+// walkTree feeds paths under root to a pool of workers running visit, visit returns the operation name used for its error.
+func walkTree(root string, opts *WalkOptions, visit func(store EaStore, path string, followReparsePoint bool) (string, error)) error {
+	if opts == nil {
+		opts = &WalkOptions{}
+	}
+
+	store, err := storeOrDefault(opts.Store)
+	if err != nil {
+		return err
+	}
+
+	parent := opts.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type walkEntry struct {
+		path   string
+		follow bool
+	}
+
+	var (
+		errMu   sync.Mutex
+		errs    []*fs.PathError
+		progMu  sync.Mutex
+		done    atomic.Int64
+		failed  atomic.Int64
+		skipAll atomic.Bool
+	)
+
+	addErr := func(op, path string, err error) {
+		errMu.Lock()
+		errs = append(errs, &fs.PathError{Op: op, Path: path, Err: err})
+		errMu.Unlock()
+	}
+
+	entries := make(chan walkEntry)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for ent := range entries {
+				op, err := visit(store, ent.path, ent.follow)
+				if errors.Is(err, fs.SkipAll) {
+					skipAll.Store(true)
+					cancel()
+					err = nil
+				}
+				if err != nil {
+					addErr(op, ent.path, err)
+					failed.Add(1)
+				}
+				processed := done.Add(1)
+
+				if opts.Progress != nil {
+					progMu.Lock()
+					opts.Progress(WalkProgress{
+						Path:      ent.path,
+						Processed: processed,
+						Failed:    failed.Load(),
+					})
+					progMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if err != nil {
+			addErr("walk", path, err)
+			failed.Add(1)
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		ent := walkEntry{path: path}
+		if isReparsePoint(d) {
+			switch opts.Reparse {
+			case ReparseSkip:
+				// a junction can be reported as a directory, which should not be walked into either
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			case ReparseFollow:
+				ent.follow = true
+			}
+		}
+
+		select {
+		case entries <- ent:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	close(entries)
+	wg.Wait()
+
+	var result []error
+	if walkErr != nil && !skipAll.Load() {
+		result = append(result, walkErr)
+	}
+	if len(errs) != 0 {
+		result = append(result, &WalkError{Errors: errs})
+	}
+
+	if len(result) == 1 {
+		return result[0]
+	}
+
+	return errors.Join(result...)
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package ntfs_ea
+
+import "io/fs"
+
+// isReparsePoint reports whether d is a symbolic link, which is the only kind of reparse point outside of Windows.
+func isReparsePoint(d fs.DirEntry) bool {
+	return d.Type()&fs.ModeSymlink != 0
+}
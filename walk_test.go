@@ -0,0 +1,137 @@
+package ntfs_ea
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func createTestTree(t *testing.T, files ...string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte("test content"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	return root
+}
+
+func TestWalkEas(t *testing.T) {
+	root := createTestTree(t, "a.txt", "sub/b.txt", "sub/deep/c.txt")
+	store := NewMemStore()
+
+	err := store.EaWriteFile(filepath.Join(root, "sub", "b.txt"), false, EaInfo{EaName: "walkea", EaValue: []byte("b value")})
+	if err != nil {
+		t.Fatalf("EaWriteFile failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	found := make(map[string][]EaInfo)
+	var progress int64
+
+	err = WalkEas(root, func(path string, eas []EaInfo) error {
+		mu.Lock()
+		found[path] = eas
+		mu.Unlock()
+		return nil
+	}, &WalkOptions{
+		Store:       store,
+		Concurrency: 4,
+		Progress: func(p WalkProgress) {
+			progress = p.Processed
+		},
+	})
+	if err != nil {
+		t.Fatalf("WalkEas failed: %v", err)
+	}
+
+	// root, sub, sub/deep and three files
+	if len(found) != 6 || progress != 6 {
+		t.Fatalf("Expected 6 paths, got %d(progress %d)", len(found), progress)
+	}
+
+	eas := found[filepath.Join(root, "sub", "b.txt")]
+	if len(eas) != 1 || eas[0].EaName != "WALKEA" || string(eas[0].EaValue) != "b value" {
+		t.Fatalf("EA data mismatch: got %v", eas)
+	}
+}
+
+func TestWalkEasErrors(t *testing.T) {
+	root := createTestTree(t, "a.txt", "b.txt")
+
+	errFailed := errors.New("callback failed")
+
+	err := WalkEas(root, func(path string, eas []EaInfo) error {
+		if filepath.Base(path) == "b.txt" {
+			return errFailed
+		}
+		return nil
+	}, &WalkOptions{Store: NewMemStore()})
+
+	var walkErr *WalkError
+	if !errors.As(err, &walkErr) {
+		t.Fatalf("Expected WalkError, got %v", err)
+	}
+
+	if len(walkErr.Errors) != 1 || walkErr.Errors[0].Path != filepath.Join(root, "b.txt") || !errors.Is(err, errFailed) {
+		t.Fatalf("Unexpected errors: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = WalkEas(root, func(path string, eas []EaInfo) error {
+		return nil
+	}, &WalkOptions{Store: NewMemStore(), Context: ctx})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	visited := 0
+	err = WalkEas(root, func(path string, eas []EaInfo) error {
+		visited++
+		return fs.SkipAll
+	}, &WalkOptions{Store: NewMemStore(), Concurrency: 1})
+	if err != nil || visited != 1 {
+		t.Fatalf("Expected walk to stop after first path, visited %d, err %v", visited, err)
+	}
+}
+
+func TestApplyEas(t *testing.T) {
+	root := createTestTree(t, "a.txt", "sub/b.txt")
+	store := NewMemStore()
+
+	err := ApplyEas(root, func(path string, eas []EaInfo) ([]EaInfo, error) {
+		if filepath.Ext(path) != ".txt" {
+			return nil, nil
+		}
+		return []EaInfo{{Flags: NeedEa, EaName: "APPLIED", EaValue: []byte(filepath.Base(path))}}, nil
+	}, &WalkOptions{Store: store})
+	if err != nil {
+		t.Fatalf("ApplyEas failed: %v", err)
+	}
+
+	if paths := store.Paths(); len(paths) != 2 {
+		t.Fatalf("Expected EAs on 2 paths, got %v", paths)
+	}
+
+	eas, err := store.QueryFileEa(filepath.Join(root, "sub", "b.txt"), false, "applied")
+	if err != nil {
+		t.Fatalf("QueryFileEa failed: %v", err)
+	}
+
+	if len(eas) != 1 || eas[0].Flags != NeedEa || string(eas[0].EaValue) != "b.txt" {
+		t.Fatalf("EA data mismatch: got %v", eas)
+	}
+}
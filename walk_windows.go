@@ -0,0 +1,27 @@
+//go:build windows
+// +build windows
+
+package ntfs_ea
+
+import (
+	"io/fs"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// isReparsePoint reports whether d has FILE_ATTRIBUTE_REPARSE_POINT, which covers junctions and other name surrogates
+// as well as symbolic links.
+func isReparsePoint(d fs.DirEntry) bool {
+	if d.Type()&fs.ModeSymlink != 0 {
+		return true
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	attr, ok := info.Sys().(*syscall.Win32FileAttributeData)
+
+	return ok && attr.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0
+}
@@ -0,0 +1,214 @@
+package ntfs_ea
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+)
+
+// Names of EAs which WSL uses to store Linux metadata of files in DrvFs with the "metadata" mount option.
+const (
+	WslUIDEaName  = "$LXUID" // uint32, owner user id
+	WslGIDEaName  = "$LXGID" // uint32, owner group id
+	WslModeEaName = "$LXMOD" // uint32, st_mode with file type and permission bits
+	WslDevEaName  = "$LXDEV" // uint32 major and uint32 minor device numbers
+)
+
+// Unix st_mode bits used in $LXMOD.
+const (
+	unixModeTypeMask    = 0o170000
+	unixModeSocket      = 0o140000
+	unixModeSymlink     = 0o120000
+	unixModeRegular     = 0o100000
+	unixModeBlockDevice = 0o060000
+	unixModeDir         = 0o040000
+	unixModeCharDevice  = 0o020000
+	unixModeFIFO        = 0o010000
+	unixModeSetuid      = 0o4000
+	unixModeSetgid      = 0o2000
+	unixModeSticky      = 0o1000
+)
+
+// WslMetadata is Linux ownership, mode and device number of a file stored in $LXUID, $LXGID, $LXMOD and $LXDEV EAs, all values are little endian.
+// Has* fields report whether the according EA exists.
+type WslMetadata struct {
+	UID      uint32
+	GID      uint32
+	Mode     uint32 // Unix st_mode, see FileMode and SetFileMode
+	DevMajor uint32
+	DevMinor uint32
+
+	HasUID  bool
+	HasGID  bool
+	HasMode bool
+	HasDev  bool
+}
+
+// DecodeWslMetadata decodes WSL metadata from eas, EAs with other names are ignored.
+func DecodeWslMetadata(eas []EaInfo) (WslMetadata, error) {
+	var m WslMetadata
+
+	for _, ea := range eas {
+		if len(ea.EaValue) == 0 {
+			continue
+		}
+
+		name := eaNameKey(ea.EaName)
+		switch name {
+		case WslUIDEaName, WslGIDEaName, WslModeEaName:
+			if len(ea.EaValue) != 4 {
+				return m, fmt.Errorf("%s should be 4 bytes, got %d", name, len(ea.EaValue))
+			}
+			v := binary.LittleEndian.Uint32(ea.EaValue)
+
+			switch name {
+			case WslUIDEaName:
+				m.UID, m.HasUID = v, true
+			case WslGIDEaName:
+				m.GID, m.HasGID = v, true
+			case WslModeEaName:
+				m.Mode, m.HasMode = v, true
+			}
+		case WslDevEaName:
+			if len(ea.EaValue) != 8 {
+				return m, fmt.Errorf("%s should be 8 bytes, got %d", name, len(ea.EaValue))
+			}
+			m.DevMajor = binary.LittleEndian.Uint32(ea.EaValue)
+			m.DevMinor = binary.LittleEndian.Uint32(ea.EaValue[4:])
+			m.HasDev = true
+		}
+	}
+
+	return m, nil
+}
+
+func uint32Ea(name string, v uint32) EaInfo {
+	return EaInfo{EaName: name, EaValue: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+// Eas encodes the fields of m which are set into EAs.
+func (m WslMetadata) Eas() []EaInfo {
+	var eas []EaInfo
+
+	if m.HasUID {
+		eas = append(eas, uint32Ea(WslUIDEaName, m.UID))
+	}
+	if m.HasGID {
+		eas = append(eas, uint32Ea(WslGIDEaName, m.GID))
+	}
+	if m.HasMode {
+		eas = append(eas, uint32Ea(WslModeEaName, m.Mode))
+	}
+	if m.HasDev {
+		dev := binary.LittleEndian.AppendUint32(nil, m.DevMajor)
+		eas = append(eas, EaInfo{EaName: WslDevEaName, EaValue: binary.LittleEndian.AppendUint32(dev, m.DevMinor)})
+	}
+
+	return eas
+}
+
+// FileMode converts Mode into fs.FileMode.
+func (m WslMetadata) FileMode() fs.FileMode {
+	return UnixModeToFileMode(m.Mode)
+}
+
+// SetFileMode sets Mode from fs.FileMode.
+func (m *WslMetadata) SetFileMode(mode fs.FileMode) {
+	m.Mode, m.HasMode = FileModeToUnixMode(mode), true
+}
+
+// UnixModeToFileMode converts Unix st_mode into fs.FileMode the same way as os.Stat in Linux.
+func UnixModeToFileMode(mode uint32) fs.FileMode {
+	fm := fs.FileMode(mode & 0o777)
+
+	switch mode & unixModeTypeMask {
+	case unixModeBlockDevice:
+		fm |= fs.ModeDevice
+	case unixModeCharDevice:
+		fm |= fs.ModeDevice | fs.ModeCharDevice
+	case unixModeDir:
+		fm |= fs.ModeDir
+	case unixModeFIFO:
+		fm |= fs.ModeNamedPipe
+	case unixModeSymlink:
+		fm |= fs.ModeSymlink
+	case unixModeSocket:
+		fm |= fs.ModeSocket
+	}
+
+	if mode&unixModeSetuid != 0 {
+		fm |= fs.ModeSetuid
+	}
+	if mode&unixModeSetgid != 0 {
+		fm |= fs.ModeSetgid
+	}
+	if mode&unixModeSticky != 0 {
+		fm |= fs.ModeSticky
+	}
+
+	return fm
+}
+
+// FileModeToUnixMode converts fs.FileMode into Unix st_mode, a regular file is assumed if mode has no type bits.
+func FileModeToUnixMode(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+
+	switch {
+	case mode&fs.ModeDir != 0:
+		m |= unixModeDir
+	case mode&fs.ModeSymlink != 0:
+		m |= unixModeSymlink
+	case mode&fs.ModeNamedPipe != 0:
+		m |= unixModeFIFO
+	case mode&fs.ModeSocket != 0:
+		m |= unixModeSocket
+	case mode&fs.ModeCharDevice != 0:
+		m |= unixModeCharDevice
+	case mode&fs.ModeDevice != 0:
+		m |= unixModeBlockDevice
+	default:
+		m |= unixModeRegular
+	}
+
+	if mode&fs.ModeSetuid != 0 {
+		m |= unixModeSetuid
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= unixModeSetgid
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= unixModeSticky
+	}
+
+	return m
+}
+
+// GetWslMetadata queries WSL metadata of the file in path, DefaultStore() is used if store is nil.
+func GetWslMetadata(path string, followReparsePoint bool, store EaStore) (WslMetadata, error) {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return WslMetadata{}, err
+	}
+
+	eas, err := store.QueryFileEa(path, followReparsePoint, WslUIDEaName, WslGIDEaName, WslModeEaName, WslDevEaName)
+	if err != nil {
+		return WslMetadata{}, err
+	}
+
+	return DecodeWslMetadata(eas)
+}
+
+// SetWslMetadata writes the fields of m which are set as WSL metadata into the file in path, DefaultStore() is used if store is nil.
+func SetWslMetadata(path string, followReparsePoint bool, store EaStore, m WslMetadata) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	eas := m.Eas()
+	if len(eas) == 0 {
+		return fmt.Errorf("no WSL metadata to write")
+	}
+
+	return store.EaWriteFile(path, followReparsePoint, eas...)
+}
@@ -0,0 +1,61 @@
+package ntfs_ea
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestWslMetadata(t *testing.T) {
+	root := createTestTree(t, "dev/tty0")
+	target := filepath.Join(root, "dev", "tty0")
+	store := NewMemStore()
+
+	m := WslMetadata{UID: 1000, GID: 5, DevMajor: 4, DevMinor: 0, HasUID: true, HasGID: true, HasDev: true}
+	m.SetFileMode(fs.ModeDevice | fs.ModeCharDevice | 0o620)
+
+	if m.Mode != unixModeCharDevice|0o620 {
+		t.Fatalf("Unexpected st_mode: %o", m.Mode)
+	}
+
+	if err := SetWslMetadata(target, false, store, m); err != nil {
+		t.Fatalf("SetWslMetadata failed: %v", err)
+	}
+
+	raw, _ := store.QueryFileEa(target, false, "$LXUID", "$LXDEV")
+	if !bytes.Equal(raw[0].EaValue, []byte{0xe8, 0x03, 0, 0}) || !bytes.Equal(raw[1].EaValue, []byte{4, 0, 0, 0, 0, 0, 0, 0}) {
+		t.Fatalf("Unexpected EA values: % x, % x", raw[0].EaValue, raw[1].EaValue)
+	}
+
+	got, err := GetWslMetadata(target, false, store)
+	if err != nil {
+		t.Fatalf("GetWslMetadata failed: %v", err)
+	}
+	if got != m {
+		t.Fatalf("WSL metadata mismatch: got %+v, expected %+v", got, m)
+	}
+	if got.FileMode() != fs.ModeDevice|fs.ModeCharDevice|0o620 {
+		t.Fatalf("Unexpected file mode: %v", got.FileMode())
+	}
+
+	if _, err = DecodeWslMetadata([]EaInfo{{EaName: "$LXMOD", EaValue: []byte{1, 2}}}); err == nil {
+		t.Fatalf("Expected error for short $LXMOD")
+	}
+}
+
+func TestUnixModeConversion(t *testing.T) {
+	for _, mode := range []uint32{
+		unixModeRegular | 0o644,
+		unixModeDir | unixModeSticky | 0o777,
+		unixModeSymlink | 0o777,
+		unixModeRegular | unixModeSetuid | unixModeSetgid | 0o755,
+		unixModeFIFO | 0o600,
+		unixModeSocket | 0o755,
+		unixModeBlockDevice | 0o660,
+	} {
+		if got := FileModeToUnixMode(UnixModeToFileMode(mode)); got != mode {
+			t.Fatalf("Mode %o converted back to %o", mode, got)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package ntfs_ea
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WslTarEntry is an entry of a tar archive with the WSL metadata to be written into it.
+type WslTarEntry struct {
+	Path     string      `json:"path"` // slash separated path in the archive
+	Type     byte        `json:"type"` // tar.Header.Typeflag
+	Linkname string      `json:"linkname,omitempty"`
+	Metadata WslMetadata `json:"metadata"`
+}
+
+// WslTarPlan is the WSL metadata for every entry of a tar archive, it can be made and inspected in any platform.
+type WslTarPlan struct {
+	Entries []WslTarEntry `json:"entries"`
+}
+
+// EaSets returns the WSL metadata EAs of each entry keyed by its path.
+func (p *WslTarPlan) EaSets() map[string][]EaInfo {
+	sets := make(map[string][]EaInfo, len(p.Entries))
+	for _, e := range p.Entries {
+		sets[e.Path] = e.Metadata.Eas()
+	}
+
+	return sets
+}
+
+// WslMetadataFromTarHeader returns WSL metadata with the ownership, mode and device numbers in hdr.
+func WslMetadataFromTarHeader(hdr *tar.Header) WslMetadata {
+	m := WslMetadata{
+		UID:    uint32(hdr.Uid),
+		GID:    uint32(hdr.Gid),
+		HasUID: true,
+		HasGID: true,
+	}
+	m.SetFileMode(hdr.FileInfo().Mode())
+
+	if hdr.Typeflag == tar.TypeChar || hdr.Typeflag == tar.TypeBlock {
+		m.DevMajor, m.DevMinor, m.HasDev = uint32(hdr.Devmajor), uint32(hdr.Devminor), true
+	}
+
+	return m
+}
+
+// cleanTarPath returns the slash separated path of name relative to the root of the archive, names escaping the root are refused.
+func cleanTarPath(name string) (string, error) {
+	p := path.Clean(strings.TrimLeft(strings.ReplaceAll(name, "\\", "/"), "/"))
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("tar entry %q is outside of the archive root", name)
+	}
+
+	return p, nil
+}
+
+// checkTarTarget refuses the slash separated path p under dst if any existing component of it is a symbolic link,
+// so an entry can not be written outside of dst through a symbolic link extracted earlier.
+func checkTarTarget(dst, p string) error {
+	if err := checkSetTarget(dst, p, true); err != nil {
+		return fmt.Errorf("tar entry %q: %w", p, err)
+	}
+
+	return nil
+}
+
+// PlanWslTar reads the POSIX or PAX tar stream in r and returns the WSL metadata for every entry without extracting it.
+func PlanWslTar(r io.Reader) (*WslTarPlan, error) {
+	plan := &WslTarPlan{}
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return plan, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := cleanTarPath(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		plan.Entries = append(plan.Entries, WslTarEntry{
+			Path:     p,
+			Type:     hdr.Typeflag,
+			Linkname: hdr.Linkname,
+			Metadata: WslMetadataFromTarHeader(hdr),
+		})
+	}
+}
+
+// WslExtractOptions configures ExtractWslTar.
+type WslExtractOptions struct {
+	Store              EaStore // DefaultStore() if nil
+	FollowReparsePoint bool
+}
+
+// WslExtractReport reports the result of ExtractWslTar.
+type WslExtractReport struct {
+	Extracted int
+	Skipped   []string // entries which can not be created as files, e.g. devices, FIFOs and sockets
+}
+
+// ExtractWslTar extracts the tar stream in r into dst and writes WSL metadata of each entry into the extracted file.
+// Directories, regular files, symbolic links and hard links are extracted, other entries are reported as skipped
+// since WSL represents them with reparse points.
+func ExtractWslTar(r io.Reader, dst string, opts *WslExtractOptions) (*WslExtractReport, error) {
+	if opts == nil {
+		opts = &WslExtractOptions{}
+	}
+
+	store, err := storeOrDefault(opts.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &WslExtractReport{}
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+
+		p, err := cleanTarPath(hdr.Name)
+		if err != nil {
+			return report, err
+		}
+		if err = checkTarTarget(dst, p); err != nil {
+			return report, err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(p))
+
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return report, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = extractTarFile(tr, target)
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, target)
+		case tar.TypeLink:
+			var linkPath string
+			if linkPath, err = cleanTarPath(hdr.Linkname); err == nil {
+				err = checkTarTarget(dst, linkPath)
+			}
+			if err == nil {
+				err = os.Link(filepath.Join(dst, filepath.FromSlash(linkPath)), target)
+			}
+		default:
+			report.Skipped = append(report.Skipped, p)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		followReparsePoint := opts.FollowReparsePoint && hdr.Typeflag != tar.TypeSymlink
+		if err = SetWslMetadata(target, followReparsePoint, store, WslMetadataFromTarHeader(hdr)); err != nil {
+			return report, fmt.Errorf("failed to write WSL metadata into %s: %w", target, err)
+		}
+
+		report.Extracted++
+	}
+}
+
+func extractTarFile(r io.Reader, target string) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
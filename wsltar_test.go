@@ -0,0 +1,107 @@
+package ntfs_ea
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createTestTar(t *testing.T, extra ...*tar.Header) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	headers := append([]*tar.Header{
+		{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "etc/shadow", Typeflag: tar.TypeReg, Mode: 0o640, Uid: 0, Gid: 42, Size: 4, Format: tar.FormatPAX},
+		{Name: "home/user/", Typeflag: tar.TypeDir, Mode: 0o700, Uid: 1000, Gid: 1000},
+		{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0o666, Devmajor: 1, Devminor: 3},
+	}, extra...)
+
+	for _, hdr := range headers {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if hdr.Size != 0 {
+			tw.Write([]byte("root"))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close tar writer: %v", err)
+	}
+
+	return &buf
+}
+
+func TestPlanWslTar(t *testing.T) {
+	plan, err := PlanWslTar(createTestTar(t))
+	if err != nil {
+		t.Fatalf("PlanWslTar failed: %v", err)
+	}
+
+	if len(plan.Entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %d", len(plan.Entries))
+	}
+
+	shadow := plan.Entries[1].Metadata
+	if plan.Entries[1].Path != "etc/shadow" || shadow.GID != 42 || shadow.Mode != unixModeRegular|0o640 {
+		t.Fatalf("Unexpected metadata for etc/shadow: %+v", plan.Entries[1])
+	}
+
+	null := plan.EaSets()["dev/null"]
+	m, _ := DecodeWslMetadata(null)
+	if m.Mode != unixModeCharDevice|0o666 || !m.HasDev || m.DevMajor != 1 || m.DevMinor != 3 {
+		t.Fatalf("Unexpected metadata for dev/null: %+v", m)
+	}
+
+	if _, err = PlanWslTar(createTestTar(t, &tar.Header{Name: "../escape", Typeflag: tar.TypeReg})); err == nil {
+		t.Fatalf("Expected error for entry outside of the archive root")
+	}
+}
+
+func TestExtractWslTar(t *testing.T) {
+	dst := t.TempDir()
+	store := NewMemStore()
+
+	report, err := ExtractWslTar(createTestTar(t), dst, &WslExtractOptions{Store: store})
+	if err != nil {
+		t.Fatalf("ExtractWslTar failed: %v", err)
+	}
+
+	if report.Extracted != 3 || len(report.Skipped) != 1 || report.Skipped[0] != "dev/null" {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "etc", "shadow"))
+	if err != nil || string(content) != "root" {
+		t.Fatalf("Unexpected content of etc/shadow: %q, %v", content, err)
+	}
+
+	m, err := GetWslMetadata(filepath.Join(dst, "home", "user"), false, store)
+	if err != nil || m.UID != 1000 || m.Mode != unixModeDir|0o700 {
+		t.Fatalf("Unexpected metadata for home/user: %+v, %v", m, err)
+	}
+}
+
+func TestExtractWslTarThroughSymlink(t *testing.T) {
+	outside := t.TempDir()
+
+	for _, hdr := range []*tar.Header{
+		{Name: "a/passwd", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+		{Name: "a/sub/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "b", Typeflag: tar.TypeLink, Linkname: "a/passwd"},
+	} {
+		dst := t.TempDir()
+		tarball := createTestTar(t, &tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: outside}, hdr)
+
+		if _, err := ExtractWslTar(tarball, dst, &WslExtractOptions{Store: NewMemStore()}); err == nil {
+			t.Fatalf("Expected error for %s written through a symbolic link", hdr.Name)
+		}
+		if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+			t.Fatalf("%s was written outside of the destination: %v", hdr.Name, entries)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package ntfs_ea
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/nyaosorg/go-windows-mbcs"
+)
+
+// ZipOS2EaExtraID is the ID of the OS/2 extended attributes extra field defined by Info-ZIP, which is laid out in little endian as
+//
+//	uint16 ID(0x0009), uint16 size of the following data, uint32 uncompressed size of EA data,
+//	uint16 compression method of EA data(0 for stored, 8 for deflated), uint32 CRC-32 of uncompressed EA data, EA data
+//
+// The EA data is FEALIST of 16 bit OS/2, which Info-ZIP keeps even in its 32 bit OS/2 port: a uint32 size of the whole list followed by
+// packed entries of uint8 flags, uint8 name length, uint16 value length, the name with a null terminator and the value.
+// Info-ZIP writes the whole field only in the local header and just the uncompressed size in the central directory, while archive/zip
+// writes the same extra field in both of them, use ZipFileEas to read EAs from either.
+const ZipOS2EaExtraID = 0x0009
+
+const (
+	zipEaHeaderSize     = 10 // uncompressed size, compression method, CRC-32
+	zipExtraHeaderSize  = 4  // ID, size
+	maxZipEaExtraSize   = 0xffff
+	maxZipEaDataSize    = 1 << 20
+	zipEaMethodStored   = 0
+	zipEaMethodDeflated = 8
+	feaHeaderSize       = 4 // flags, name length, value length
+	zipLocalHeaderSize  = 30
+	zipLocalHeaderSig   = 0x04034b50
+)
+
+// EncodeZipEaExtra returns the OS/2 EA extra field with eas including its ID and size, EAs with empty value are skipped.
+// EA data is deflated when it gets smaller. nil is returned if there is no EA.
+func EncodeZipEaExtra(eas []EaInfo) ([]byte, error) {
+	var set []EaInfo
+	for _, ea := range eas {
+		if len(ea.EaValue) != 0 {
+			set = append(set, ea)
+		}
+	}
+	if len(set) == 0 {
+		return nil, nil
+	}
+
+	list, err := encodeFeaList(set)
+	if err != nil {
+		return nil, err
+	}
+
+	data, method := list, uint16(zipEaMethodStored)
+
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fw.Write(list); err != nil {
+		return nil, err
+	}
+	if err = fw.Close(); err != nil {
+		return nil, err
+	}
+	if compressed.Len() < len(list) {
+		data, method = compressed.Bytes(), zipEaMethodDeflated
+	}
+
+	size := zipEaHeaderSize + len(data)
+	if size > maxZipEaExtraSize {
+		return nil, fmt.Errorf("EA data of %d bytes does not fit into a ZIP extra field", len(data))
+	}
+
+	extra := binary.LittleEndian.AppendUint16(nil, ZipOS2EaExtraID)
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(size))
+	extra = binary.LittleEndian.AppendUint32(extra, uint32(len(list)))
+	extra = binary.LittleEndian.AppendUint16(extra, method)
+	extra = binary.LittleEndian.AppendUint32(extra, crc32.ChecksumIEEE(list))
+
+	return append(extra, data...), nil
+}
+
+// zipExtraFields calls fn with ID and data of each field in extra until fn returns false.
+func zipExtraFields(extra []byte, fn func(id uint16, data []byte, start, end int) bool) error {
+	for offset := 0; offset < len(extra); {
+		if len(extra)-offset < zipExtraHeaderSize {
+			return fmt.Errorf("ZIP extra field at offset %d is truncated", offset)
+		}
+
+		id := binary.LittleEndian.Uint16(extra[offset:])
+		size := int(binary.LittleEndian.Uint16(extra[offset+2:]))
+		end := offset + zipExtraHeaderSize + size
+		if end > len(extra) {
+			return fmt.Errorf("ZIP extra field 0x%04x at offset %d exceeds the extra data", id, offset)
+		}
+
+		if !fn(id, extra[offset+zipExtraHeaderSize:end], offset, end) {
+			return nil
+		}
+		offset = end
+	}
+
+	return nil
+}
+
+// DecodeZipEaExtra finds the OS/2 EA extra field in the extra data of a ZIP header and returns EAs in it.
+// nil is returned if there is no such field or it only has the uncompressed size as in the central directory of Info-ZIP.
+func DecodeZipEaExtra(extra []byte) ([]EaInfo, error) {
+	var field []byte
+	err := zipExtraFields(extra, func(id uint16, data []byte, _, _ int) bool {
+		if id == ZipOS2EaExtraID {
+			field = data
+			return false
+		}
+		return true
+	})
+	if err != nil || len(field) < zipEaHeaderSize {
+		return nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(field)
+	method := binary.LittleEndian.Uint16(field[4:])
+	crc := binary.LittleEndian.Uint32(field[6:])
+	data := field[zipEaHeaderSize:]
+
+	if size > maxZipEaDataSize {
+		return nil, fmt.Errorf("EA data of %d bytes in ZIP extra field is too large", size)
+	}
+
+	var list []byte
+	switch method {
+	case zipEaMethodStored:
+		list = data
+	case zipEaMethodDeflated:
+		if list, err = io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), int64(size)+1)); err != nil {
+			return nil, fmt.Errorf("failed to inflate EA data in ZIP extra field: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression method %d of EA data in ZIP extra field", method)
+	}
+
+	if uint32(len(list)) != size {
+		return nil, fmt.Errorf("EA data in ZIP extra field should be %d bytes, got %d", size, len(list))
+	}
+	if crc32.ChecksumIEEE(list) != crc {
+		return nil, errors.New("CRC-32 of EA data in ZIP extra field does not match")
+	}
+
+	return parseFeaList(list)
+}
+
+// encodeFeaList returns eas as FEALIST.
+func encodeFeaList(eas []EaInfo) ([]byte, error) {
+	list := make([]byte, 4)
+	for _, ea := range eas {
+		name, err := mbcs.Utf8ToAnsi(ea.EaName, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(name) > 0xff || len(ea.EaValue) > 0xffff {
+			return nil, fmt.Errorf("EA %s is too long for FEALIST", ea.EaName)
+		}
+
+		list = append(list, ea.Flags, byte(len(name)))
+		list = binary.LittleEndian.AppendUint16(list, uint16(len(ea.EaValue)))
+		list = append(list, name...)
+		list = append(list, 0)
+		list = append(list, ea.EaValue...)
+	}
+	binary.LittleEndian.PutUint32(list, uint32(len(list)))
+
+	return list, nil
+}
+
+// parseFeaList returns EAs in FEALIST.
+func parseFeaList(list []byte) ([]EaInfo, error) {
+	if len(list) < 4 || binary.LittleEndian.Uint32(list) != uint32(len(list)) {
+		return nil, errors.New("invalid size of FEALIST in ZIP extra field")
+	}
+
+	var eas []EaInfo
+	for offset := 4; offset < len(list); {
+		if len(list)-offset < feaHeaderSize {
+			return nil, fmt.Errorf("FEA at offset %d is truncated", offset)
+		}
+
+		nameLen := int(list[offset+1])
+		valueLen := int(binary.LittleEndian.Uint16(list[offset+2:]))
+		nameStart := offset + feaHeaderSize
+		valueStart := nameStart + nameLen + 1
+		if valueStart+valueLen > len(list) {
+			return nil, fmt.Errorf("FEA at offset %d exceeds the list", offset)
+		}
+		if list[valueStart-1] != 0 {
+			return nil, fmt.Errorf("name of FEA at offset %d is not null terminated", offset)
+		}
+
+		name, err := mbcs.AnsiToUtf8(list[nameStart:nameStart+nameLen], 0)
+		if err != nil {
+			return nil, fmt.Errorf("name of FEA at offset %d: %w", offset, err)
+		}
+
+		eas = append(eas, EaInfo{Flags: list[offset], EaName: name, EaValue: append([]byte{}, list[valueStart:valueStart+valueLen]...)})
+		offset = valueStart + valueLen
+	}
+
+	return eas, nil
+}
+
+// ZipFileEas returns EAs of f in the archive read from ra, as given to zip.NewReader. EAs are decoded from the central directory if the
+// whole field is there as written by this package, otherwise from the local header where Info-ZIP writes it.
+// nil is returned if f has no EA.
+func ZipFileEas(ra io.ReaderAt, f *zip.File) ([]EaInfo, error) {
+	eas, err := DecodeZipEaExtra(f.Extra)
+	if err != nil || eas != nil {
+		return eas, err
+	}
+
+	found := false
+	if err = zipExtraFields(f.Extra, func(id uint16, _ []byte, _, _ int) bool {
+		found = id == ZipOS2EaExtraID
+		return !found
+	}); err != nil || !found {
+		return nil, err
+	}
+
+	extra, err := zipLocalExtra(ra, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeZipEaExtra(extra)
+}
+
+// zipLocalExtra returns the extra data in the local header of f. archive/zip does not tell where the local header is, so it is searched
+// backward from the data: the header should end with the name and the extra data of its recorded lengths right at the data, have the CRC-32
+// of f unless it is in a data descriptor, and the extra data should be well formed. The name is not compared, as archive/zip does not
+// decode it. Small windows before the data are searched first, as the header is usually close to it.
+func zipLocalExtra(ra io.ReaderAt, f *zip.File) ([]byte, error) {
+	dataOffset, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	// the header is followed by a name and extra data of at most 64KB each
+	const maxDistance = zipLocalHeaderSize + 2*0xffff
+
+	// distance of the next position to search from the data, positions in smaller windows are not searched again
+	next := zipLocalHeaderSize
+	for window := int64(1024); ; window *= 2 {
+		if window > maxDistance {
+			window = maxDistance
+		}
+		start := dataOffset - window
+		if start < 0 {
+			start = 0
+		}
+		buf := make([]byte, dataOffset-start)
+		if _, err = ra.ReadAt(buf, start); err != nil {
+			return nil, err
+		}
+
+		for ; next <= len(buf); next++ {
+			if extra, ok := zipLocalHeaderAt(buf, len(buf)-next, f); ok {
+				return extra, nil
+			}
+		}
+
+		if start == 0 || window == maxDistance {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("local header of %s is not found", f.Name)
+}
+
+// zipLocalHeaderAt returns the extra data of the local header of f at offset hdr in buf which ends at the data of f.
+func zipLocalHeaderAt(buf []byte, hdr int, f *zip.File) ([]byte, bool) {
+	if binary.LittleEndian.Uint32(buf[hdr:]) != zipLocalHeaderSig {
+		return nil, false
+	}
+
+	nameLen := int(binary.LittleEndian.Uint16(buf[hdr+26:]))
+	extraLen := int(binary.LittleEndian.Uint16(buf[hdr+28:]))
+	if hdr+zipLocalHeaderSize+nameLen+extraLen != len(buf) {
+		return nil, false
+	}
+
+	// with bit 3 of the flags, CRC-32 and sizes are in the data descriptor after the data
+	if flags := binary.LittleEndian.Uint16(buf[hdr+6:]); flags&0x8 == 0 && binary.LittleEndian.Uint32(buf[hdr+14:]) != f.CRC32 {
+		return nil, false
+	}
+
+	extra := buf[len(buf)-extraLen:]
+	if zipExtraFields(extra, func(uint16, []byte, int, int) bool { return true }) != nil {
+		return nil, false
+	}
+
+	return extra, true
+}
+
+// SetZipHeaderEas replaces the OS/2 EA extra field in fh.Extra with eas, the field is removed if eas is empty.
+func SetZipHeaderEas(fh *zip.FileHeader, eas []EaInfo) error {
+	field, err := EncodeZipEaExtra(eas)
+	if err != nil {
+		return err
+	}
+
+	var extra []byte
+	err = zipExtraFields(fh.Extra, func(id uint16, _ []byte, start, end int) bool {
+		if id != ZipOS2EaExtraID {
+			extra = append(extra, fh.Extra[start:end]...)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	fh.Extra = append(extra, field...)
+
+	return nil
+}
+
+// ZipHeaderEas returns EAs in the OS/2 EA extra field of fh, see DecodeZipEaExtra.
+func ZipHeaderEas(fh *zip.FileHeader) ([]EaInfo, error) {
+	return DecodeZipEaExtra(fh.Extra)
+}
+
+// AddFileEasToZipHeader queries EAs of the file in path and stores them into fh with SetZipHeaderEas.
+// DefaultStore() is used if store is nil.
+func AddFileEasToZipHeader(fh *zip.FileHeader, path string, followReparsePoint bool, store EaStore) error {
+	store, err := storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	eas, err := store.QueryFileEa(path, followReparsePoint)
+	if err != nil {
+		return err
+	}
+
+	return SetZipHeaderEas(fh, eas)
+}
+
+// RestoreZipHeaderEas writes EAs stored in fh into the extracted file in path, nothing is written if fh has no EA.
+// DefaultStore() is used if store is nil.
+func RestoreZipHeaderEas(fh *zip.FileHeader, path string, followReparsePoint bool, store EaStore) error {
+	eas, err := ZipHeaderEas(fh)
+	if err != nil || len(eas) == 0 {
+		return err
+	}
+
+	store, err = storeOrDefault(store)
+	if err != nil {
+		return err
+	}
+
+	return store.EaWriteFile(path, followReparsePoint, eas...)
+}
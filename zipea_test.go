@@ -0,0 +1,187 @@
+package ntfs_ea
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestZipEaExtra(t *testing.T) {
+	eas := []EaInfo{
+		{EaName: "APPVERSION", EaValue: []byte("1.0")},
+		{Flags: NeedEa, EaName: "REPEATED", EaValue: bytes.Repeat([]byte("abcd"), 256)},
+	}
+
+	extra, err := EncodeZipEaExtra(eas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := binary.LittleEndian.Uint16(extra); id != ZipOS2EaExtraID {
+		t.Fatalf("Unexpected ID 0x%04x", id)
+	}
+	if method := binary.LittleEndian.Uint16(extra[8:]); method != zipEaMethodDeflated {
+		t.Fatalf("Repeated data should be deflated, got method %d", method)
+	}
+
+	decoded, err := DecodeZipEaExtra(extra)
+	if err != nil || !reflect.DeepEqual(decoded, eas) {
+		t.Fatalf("Unexpected EAs: %v, %v", decoded, err)
+	}
+
+	// stored EA data as Info-ZIP writes small EAs, preceded by another extra field
+	stored, _ := EncodeZipEaExtra(eas[:1])
+	if binary.LittleEndian.Uint16(stored[8:]) != zipEaMethodStored {
+		t.Fatal("Small EA data should be stored")
+	}
+	other := []byte{0x55, 0x54, 5, 0, 1, 2, 3, 4, 5}
+	if decoded, err = DecodeZipEaExtra(append(other, stored...)); err != nil || !reflect.DeepEqual(decoded, eas[:1]) {
+		t.Fatalf("Unexpected EAs: %v, %v", decoded, err)
+	}
+
+	// only the uncompressed size in the central directory of Info-ZIP
+	if decoded, err = DecodeZipEaExtra([]byte{9, 0, 4, 0, 0x20, 0, 0, 0}); err != nil || decoded != nil {
+		t.Fatalf("Unexpected EAs: %v, %v", decoded, err)
+	}
+
+	corrupted := append([]byte{}, stored...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	for _, extra := range [][]byte{corrupted, {9, 0, 10, 0}, stored[:len(stored)-1]} {
+		if _, err = DecodeZipEaExtra(extra); err == nil {
+			t.Fatalf("Expected error for %x", extra)
+		}
+	}
+}
+
+func TestZipHeaderEas(t *testing.T) {
+	src, dst := NewMemStore(), NewMemStore()
+	eas := []EaInfo{{Flags: NeedEa, EaName: "APPVERSION", EaValue: []byte("1.0")}}
+	if err := src.EaWriteFile("/src/file", false, eas...); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	fh := &zip.FileHeader{Name: "file", Method: zip.Deflate, Extra: []byte{0x55, 0x54, 1, 0, 0}}
+	if err := AddFileEasToZipHeader(fh, "/src/file", false, src); err != nil {
+		t.Fatal(err)
+	}
+	// replaced, not appended
+	if err := AddFileEasToZipHeader(fh, "/src/file", false, src); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("content"))
+	zw.Close()
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := zr.File[0]
+	if !bytes.HasPrefix(f.Extra, []byte{0x55, 0x54, 1, 0, 0}) {
+		t.Fatalf("Other extra fields should be kept: %x", f.Extra)
+	}
+	if err = RestoreZipHeaderEas(&f.FileHeader, "/dst/file", false, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := dst.QueryFileEa("/dst/file", false)
+	if err != nil || !reflect.DeepEqual(restored, eas) {
+		t.Fatalf("Unexpected EAs: %v, %v", restored, err)
+	}
+
+	if err = SetZipHeaderEas(fh, nil); err != nil || !bytes.Equal(fh.Extra, []byte{0x55, 0x54, 1, 0, 0}) {
+		t.Fatalf("EA extra field should be removed: %x, %v", fh.Extra, err)
+	}
+}
+
+// testdata/os2ea_infozip.zip is laid out as the OS/2 port of Info-ZIP writes EAs: FEALIST in the local header, stored for readme.txt
+// and deflated for data.bin, and only the uncompressed size in the central directory. "unzip -t" checks CRC-32 of the EA data.
+func TestZipFileEasInfoZip(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "os2ea_infozip.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asciiEa := func(s string) []byte {
+		return append(binary.LittleEndian.AppendUint16([]byte{0xfd, 0xff}, uint16(len(s))), s...)
+	}
+	want := map[string][]EaInfo{
+		"readme.txt": {{EaName: ".LONGNAME", EaValue: asciiEa("Read Me First")}, {Flags: NeedEa, EaName: ".SUBJECT", EaValue: asciiEa("greeting")}},
+		"data.bin":   {{EaName: ".COMMENTS", EaValue: asciiEa(strings.Repeat("abcd", 64))}},
+	}
+
+	for _, f := range zr.File {
+		if eas, _ := ZipHeaderEas(&f.FileHeader); eas != nil {
+			t.Fatalf("The central directory of %s should only have the size, got %v", f.Name, eas)
+		}
+
+		eas, err := ZipFileEas(bytes.NewReader(data), f)
+		if err != nil || !reflect.DeepEqual(eas, want[f.Name]) {
+			t.Fatalf("Unexpected EAs of %s: %v, %v", f.Name, eas, err)
+		}
+	}
+}
+
+func TestZipLocalExtra(t *testing.T) {
+	// the local name differs from the central directory
+	data, err := os.ReadFile(filepath.Join("testdata", "os2ea_infozip.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := bytes.Index(data, []byte("PK\x03\x04"))
+	name := bytes.Index(data[local:], []byte("readme.txt")) + local
+	copy(data[name:], "README.TXT")
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eas, err := ZipFileEas(bytes.NewReader(data), zr.File[0]); err != nil || len(eas) != 2 {
+		t.Fatalf("Unexpected EAs with a different local name: %v, %v", eas, err)
+	}
+
+	// extra data larger than the first window
+	eas := []EaInfo{{EaName: "BIG", EaValue: bytes.Repeat([]byte("0123456789"), 300)}}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fh := &zip.FileHeader{Name: "big.txt", Method: zip.Store}
+	if err = SetZipHeaderEas(fh, eas); err != nil {
+		t.Fatal(err)
+	}
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err = zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := zipLocalExtra(bytes.NewReader(buf.Bytes()), zr.File[0])
+	if err != nil || !bytes.Equal(extra, fh.Extra) {
+		t.Fatalf("Unexpected local extra of %d bytes: %v", len(extra), err)
+	}
+}